@@ -0,0 +1,299 @@
+// Package bank plans how generated assets fit in the ROM banks of the SMS.
+//
+// CVBasic with BANK ROM splits the cartridge into 16KB banks which are
+// switched in with BANK SELECT. The generated resources, (res2bas, masite,
+// fir2bas, abc2bas and pletter output), have to be spread over these banks
+// by hand. This package measures the size of every asset and packs them in
+// banks, so overflows are found before cvbasic or gasm80 fails.
+package bank
+
+import "bufio"
+import "fmt"
+import "io"
+import "os"
+import "path/filepath"
+import "slices"
+import "strings"
+import "unicode"
+
+// Size is the size of a ROM bank on the SMS using the Sega mapper.
+const Size = 16 * 1024
+
+// Sizes of the generated BASIC statements in bytes.
+// Data statements are exact. Other statements are compiled to code, of
+// which only the size of the END of a PROCEDURE is known, any other
+// statement is estimated at CodeSize, and reported as an estimate.
+const (
+	BitmapSize      = 4 // BITMAP, 8 pixels of 4 bits in 4 bit planes.
+	MusicSize       = 4 // MUSIC row, 3 tone channels and the drums.
+	MusicRepeatSize = 3 // MUSIC REPEAT, marker and address.
+	MusicStopSize   = 1 // MUSIC STOP, marker.
+	ReturnSize      = 1 // END of a PROCEDURE, a RET instruction.
+	CodeSize        = 8 // Any other statement, estimated code size.
+)
+
+// Asset is a generated file that has to be included in a bank.
+type Asset struct {
+	Name      string // Name of the file.
+	Label     string // Label for the bank constant in BASIC.
+	Size      int    // Size in bytes in ROM.
+	Estimated int    // Bytes of Size that are estimated code sizes.
+}
+
+// Bank is a ROM bank with the assets packed into it.
+type Bank struct {
+	Number int
+	Size   int
+	Assets []Asset
+}
+
+// Used returns the amount of bytes used in the bank.
+func (b Bank) Used() int {
+	used := 0
+	for _, asset := range b.Assets {
+		used += asset.Size
+	}
+	return used
+}
+
+// Estimated returns the amount of bytes used that are estimated.
+func (b Bank) Estimated() int {
+	estimated := 0
+	for _, asset := range b.Assets {
+		estimated += asset.Estimated
+	}
+	return estimated
+}
+
+// Free returns the amount of bytes still free in the bank.
+func (b Bank) Free() int {
+	return b.Size - b.Used()
+}
+
+// Label converts a file name to a label suitable for a BASIC constant.
+// For example ./map/m0003-church.xml.bas becomes M0003_CHURCH.
+func Label(name string) string {
+	base := filepath.Base(name)
+	for ext := filepath.Ext(base); ext != ""; ext = filepath.Ext(base) {
+		base = strings.TrimSuffix(base, ext)
+	}
+	label := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, base)
+	if label == "" || unicode.IsDigit(rune(label[0])) {
+		label = "A" + label
+	}
+	return label
+}
+
+// Measure returns the size of the named asset, and how much of it is
+// estimated. BASIC files are measured statement by statement,
+// anything else, such as pletter output, is binary and uses the file size.
+func Measure(name string) (size, estimated int, err error) {
+	if strings.ToLower(filepath.Ext(name)) != ".bas" {
+		info, err := os.Stat(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		return int(info.Size()), 0, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	size, estimated, err = MeasureBasic(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return size, estimated, nil
+}
+
+// MeasureBasic returns the size in ROM of the generated CVBasic source
+// read from rd, and how much of it is estimated.
+func MeasureBasic(rd io.Reader) (size, estimated int, err error) {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		stmt := Statement(scanner.Text())
+		if stmt == "" {
+			continue
+		}
+		n, guess, err := StatementSize(stmt)
+		if err != nil {
+			return size, estimated, fmt.Errorf("line %d: %w", line, err)
+		}
+		size += n
+		if guess {
+			estimated += n
+		}
+	}
+	return size, estimated, scanner.Err()
+}
+
+// Statement strips comments, labels and white space from a line of BASIC.
+func Statement(line string) string {
+	line = strings.TrimSpace(line)
+	upper := strings.ToUpper(line)
+	if strings.HasPrefix(line, "'") || strings.HasPrefix(upper, "REM ") || upper == "REM" {
+		return ""
+	}
+	if label, rest, ok := strings.Cut(line, ":"); ok && !strings.ContainsAny(label, " \t\"") {
+		line = strings.TrimSpace(rest)
+	}
+	return line
+}
+
+// StatementSize returns the size of a single BASIC statement, and true if
+// the size is an estimate.
+func StatementSize(stmt string) (size int, estimated bool, err error) {
+	keyword, rest, _ := strings.Cut(stmt, " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToUpper(keyword) {
+	case "BITMAP":
+		return BitmapSize, false, nil
+	case "MUSIC":
+		switch strings.ToUpper(rest) {
+		case "REPEAT":
+			return MusicRepeatSize, false, nil
+		case "STOP":
+			return MusicStopSize, false, nil
+		default:
+			return MusicSize, false, nil
+		}
+	case "END":
+		return ReturnSize, false, nil
+	case "PROCEDURE":
+		return 0, false, nil
+	case "DATA":
+		size, err := DataSize(rest)
+		return size, false, err
+	default:
+		return CodeSize, true, nil
+	}
+}
+
+// DataSize returns the size of the arguments of a DATA statement.
+// DATA BYTE stores one byte per item, or one per character for strings.
+// Plain DATA stores one word per item.
+func DataSize(args string) (int, error) {
+	width := 2
+	if kind, rest, ok := strings.Cut(args, " "); ok && strings.ToUpper(kind) == "BYTE" {
+		width = 1
+		args = rest
+	}
+	size := 0
+	for _, item := range SplitData(args) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return size, fmt.Errorf("empty DATA item")
+		}
+		if strings.HasPrefix(item, "\"") {
+			if width != 1 || len(item) < 2 || !strings.HasSuffix(item, "\"") {
+				return size, fmt.Errorf("bad DATA string: %s", item)
+			}
+			size += len(item) - 2
+		} else {
+			size += width
+		}
+	}
+	return size, nil
+}
+
+// SplitData splits the DATA items on commas that are not in a string.
+func SplitData(args string) []string {
+	res := []string{}
+	quoted := false
+	start := 0
+	for i, r := range args {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			res = append(res, args[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, args[start:])
+}
+
+// Pack packs the assets in banks of the given size using best fit
+// decreasing: the largest assets are placed first, each in the bank with
+// the least space left that can still hold it.
+// The banks are numbered starting from first.
+func Pack(assets []Asset, size, first int) ([]Bank, error) {
+	sorted := slices.Clone(assets)
+	slices.SortStableFunc(sorted, func(a, b Asset) int {
+		return b.Size - a.Size
+	})
+
+	banks := []Bank{}
+	for _, asset := range sorted {
+		if asset.Size > size {
+			return nil, fmt.Errorf("%s: %d bytes does not fit in a bank of %d bytes",
+				asset.Name, asset.Size, size)
+		}
+		best := -1
+		for i, bank := range banks {
+			free := bank.Free()
+			if free >= asset.Size && (best < 0 || free < banks[best].Free()) {
+				best = i
+			}
+		}
+		if best < 0 {
+			banks = append(banks, Bank{Number: first + len(banks), Size: size})
+			best = len(banks) - 1
+		}
+		banks[best].Assets = append(banks[best].Assets, asset)
+	}
+	return banks, nil
+}
+
+// approx returns ~ if a size includes estimated bytes, to mark it in the
+// report.
+func approx(estimated int) string {
+	if estimated > 0 {
+		return "~"
+	}
+	return ""
+}
+
+// Report writes a human readable report of the bank usage. Sizes that
+// include estimated code sizes are marked with ~.
+func Report(out io.Writer, banks []Bank) {
+	total, estimated := 0, 0
+	for _, bank := range banks {
+		used := bank.Used()
+		total += used
+		estimated += bank.Estimated()
+		mark := approx(bank.Estimated())
+		fmt.Fprintf(out, "bank %d: %s%d/%d bytes used, %s%d free (%s%d%%)\n",
+			bank.Number, mark, used, bank.Size, mark, bank.Free(), mark, used*100/bank.Size)
+		for _, asset := range bank.Assets {
+			size := approx(asset.Estimated) + fmt.Sprint(asset.Size)
+			fmt.Fprintf(out, "\t%-24s %7s %s\n", asset.Label, size, asset.Name)
+		}
+	}
+	fmt.Fprintf(out, "%d banks, %s%d bytes total\n", len(banks), approx(estimated), total)
+	if estimated > 0 {
+		fmt.Fprintf(out, "~ %d bytes are estimated, at %d bytes for each statement compiled to code\n",
+			estimated, CodeSize)
+	}
+}
+
+// Basic writes the bank constants as CVBasic CONST definitions,
+// named after the asset label with a _BANK suffix.
+func Basic(out io.Writer, banks []Bank) {
+	fmt.Fprintf(out, "' Generated with bankplan\n\n")
+	for _, bank := range banks {
+		fmt.Fprintf(out, "' Bank %d: %s%d/%d bytes used\n", bank.Number, approx(bank.Estimated()), bank.Used(), bank.Size)
+		for _, asset := range bank.Assets {
+			fmt.Fprintf(out, "CONST %s_BANK = %d\n", asset.Label, bank.Number)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package bank
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDataSize(t *testing.T) {
+	tests := []struct {
+		args string
+		want int
+		err  bool
+	}{
+		{"1, 2, 3", 6, false},
+		{"BYTE 1, 2, 3", 3, false},
+		{"byte $10,$20", 2, false},
+		{`BYTE "abc", 0`, 4, false},
+		{`BYTE "a,b", 1`, 4, false},
+		{`"abc"`, 0, true},
+		{`BYTE "abc`, 0, true},
+		{"1,,2", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := DataSize(tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("DataSize(%q) error %v, want error %v", tt.args, err, tt.err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("DataSize(%q) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSplitData(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"1", []string{"1"}},
+		{"1,2", []string{"1", "2"}},
+		{`"a,b",3`, []string{`"a,b"`, "3"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := SplitData(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitData(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestStatementSize(t *testing.T) {
+	tests := []struct {
+		stmt      string
+		want      int
+		estimated bool
+	}{
+		{`BITMAP "..XX..XX"`, BitmapSize, false},
+		{"MUSIC C4,E4,G4,M1", MusicSize, false},
+		{"MUSIC REPEAT", MusicRepeatSize, false},
+		{"music stop", MusicStopSize, false},
+		{"END", ReturnSize, false},
+		{"PROCEDURE", 0, false},
+		{"DATA BYTE 1,2", 2, false},
+		{"PRINT AT 0, \"hi\"", CodeSize, true},
+	}
+	for _, tt := range tests {
+		got, estimated, err := StatementSize(tt.stmt)
+		if err != nil {
+			t.Errorf("StatementSize(%q): %v", tt.stmt, err)
+			continue
+		}
+		if got != tt.want || estimated != tt.estimated {
+			t.Errorf("StatementSize(%q) = %d, %t, want %d, %t", tt.stmt, got, estimated, tt.want, tt.estimated)
+		}
+	}
+}
+
+func TestMeasureBasic(t *testing.T) {
+	src := "' generated\nmap:\n\tDATA BYTE 1,2,3\nPRINT \"x\"\n"
+	size, estimated, err := MeasureBasic(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 3+CodeSize || estimated != CodeSize {
+		t.Errorf("MeasureBasic = %d, %d, want %d, %d", size, estimated, 3+CodeSize, CodeSize)
+	}
+}
+
+// labels returns the labels of the assets in every bank.
+func labels(banks []Bank) [][]string {
+	res := [][]string{}
+	for _, bank := range banks {
+		names := []string{}
+		for _, asset := range bank.Assets {
+			names = append(names, asset.Label)
+		}
+		res = append(res, names)
+	}
+	return res
+}
+
+func TestPack(t *testing.T) {
+	tests := []struct {
+		name   string
+		sizes  map[string]int
+		order  []string
+		want   [][]string
+		errors bool
+	}{
+		{
+			name:  "largest first",
+			order: []string{"A", "B", "C"},
+			sizes: map[string]int{"A": 30, "B": 60, "C": 50},
+			want:  [][]string{{"B", "A"}, {"C"}},
+		},
+		{
+			name:  "best fit",
+			order: []string{"A", "B", "C", "D"},
+			sizes: map[string]int{"A": 5, "B": 15, "C": 80, "D": 90},
+			// A fits in both banks, with 10 and 5 free, and goes in the
+			// fuller one, where first fit would put it in the first.
+			want: [][]string{{"D"}, {"C", "B", "A"}},
+		},
+		{
+			name:   "does not fit",
+			order:  []string{"A", "B"},
+			sizes:  map[string]int{"A": 10, "B": 101},
+			errors: true,
+		},
+	}
+	for _, tt := range tests {
+		assets := []Asset{}
+		for _, label := range tt.order {
+			assets = append(assets, Asset{Name: label + ".bas", Label: label, Size: tt.sizes[label]})
+		}
+		banks, err := Pack(assets, 100, 4)
+		if (err != nil) != tt.errors {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.errors)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := labels(banks); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: banks %q, want %q", tt.name, got, tt.want)
+		}
+		for i, bank := range banks {
+			if bank.Number != 4+i || bank.Free() < 0 {
+				t.Errorf("%s: bank %d numbered %d with %d free", tt.name, i, bank.Number, bank.Free())
+			}
+		}
+	}
+}
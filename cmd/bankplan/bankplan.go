@@ -0,0 +1,71 @@
+// bankplan plans the ROM banks for the generated assets of the game.
+//
+// It measures the size of every generated BASIC file, (res2bas, masite,
+// fir2bas and abc2bas output), or binary file, (pletter output),
+// packs them into SMS ROM banks and writes a report on the bank usage,
+// as well as CVBasic CONST definitions for the bank of each asset.
+//
+// The assets are passed as arguments. By default the constant for an asset
+// is named after the file, for example ./map/m0003-church.xml.bas becomes
+// M0003_CHURCH_BANK. Use file=LABEL to choose another label.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xmasengine/lox/bank"
+)
+
+func errExit(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	var err error
+	var output string
+	var report string
+	size := bank.Size
+	first := 4
+
+	flag.StringVar(&output, "o", "-", "output bas file for the bank constants")
+	flag.StringVar(&report, "r", "-", "output file for the report, STDERR by default")
+	flag.IntVar(&size, "s", size, "size of a ROM bank in bytes")
+	flag.IntVar(&first, "b", first, "first bank number to pack assets in")
+	flag.Parse()
+
+	assets := []bank.Asset{}
+	for _, arg := range flag.Args() {
+		name, label, ok := strings.Cut(arg, "=")
+		if !ok {
+			label = bank.Label(name)
+		}
+		asize, estimated, err := bank.Measure(name)
+		errExit(err)
+		assets = append(assets, bank.Asset{Name: name, Label: label, Size: asize, Estimated: estimated})
+	}
+
+	banks, err := bank.Pack(assets, size, first)
+	errExit(err)
+
+	out := os.Stdout
+	if output != "-" {
+		out, err = os.Create(output)
+		errExit(err)
+		defer out.Close()
+	}
+	rep := os.Stderr
+	if report != "-" {
+		rep, err = os.Create(report)
+		errExit(err)
+		defer rep.Close()
+	}
+
+	bank.Report(rep, banks)
+	bank.Basic(out, banks)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/xmasengine/lox/masite"
+)
+
+// Subcommand is a command that works on map files without opening a window,
+// so it can be used from the Makefile.
+type Subcommand struct {
+	Usage string
+	Run   func(set *flag.FlagSet, args []string) error
+}
+
+var subcommands = map[string]Subcommand{
+	"export":     {"[-f format] [-o out] map...", exportMaps},
+	"convert":    {"in out", convertMap},
+	"resize":     {"-w width -h height map [out]", resizeMap},
+	"validate":   {"[-layout vram] map...", validateMaps},
+	"run-script": {"[-s out] map script", runScript},
+}
+
+// subcommandUsage describes the subcommands for the usage message.
+func subcommandUsage() string {
+	names := []string{}
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	res := ""
+	for _, name := range names {
+		res += fmt.Sprintf("  masite %s %s\n", name, subcommands[name].Usage)
+	}
+	return res
+}
+
+// runSubcommand runs the subcommand named by the first argument, if any.
+func runSubcommand(args []string) bool {
+	if len(args) < 1 {
+		return false
+	}
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		return false
+	}
+	set := flag.NewFlagSet("masite "+args[0], flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "usage: masite %s %s\n", args[0], cmd.Usage)
+		set.PrintDefaults()
+	}
+	errExit(cmd.Run(set, args[1:]))
+	return true
+}
+
+func exportMaps(set *flag.FlagSet, args []string) error {
+	format := string(masite.BasicFormat)
+	output := ""
+	set.StringVar(&format, "f", format, "format to export to: .bas, .json or .xml")
+	set.StringVar(&output, "o", output, "output file, only for a single map, map name plus format by default")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		return fmt.Errorf("export: no maps")
+	}
+	if output != "" && set.NArg() > 1 {
+		return fmt.Errorf("export: -o needs a single map")
+	}
+	if !strings.HasPrefix(format, ".") {
+		format = "." + format
+	}
+	for _, name := range set.Args() {
+		tm, err := masite.ReadMap(name)
+		if err != nil {
+			return err
+		}
+		to := output
+		if to == "" {
+			to = name + format
+		}
+		if err := tm.Export(to, masite.Format(format)); err != nil {
+			return fmt.Errorf("export: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func convertMap(set *flag.FlagSet, args []string) error {
+	set.Parse(args)
+	if set.NArg() != 2 {
+		set.Usage()
+		return fmt.Errorf("convert: needs an input and an output map")
+	}
+	tm, err := masite.ReadMap(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	return tm.Save(set.Arg(1))
+}
+
+func resizeMap(set *flag.FlagSet, args []string) error {
+	w, h := 0, 0
+	set.IntVar(&w, "w", w, "new width in tiles")
+	set.IntVar(&h, "h", h, "new height in tiles")
+	set.Parse(args)
+	if set.NArg() < 1 || set.NArg() > 2 {
+		set.Usage()
+		return fmt.Errorf("resize: needs a map and optionally an output map")
+	}
+	tm, err := masite.ReadMap(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := tm.Resize(w, h); err != nil {
+		return err
+	}
+	to := set.Arg(0)
+	if set.NArg() > 1 {
+		to = set.Arg(1)
+	}
+	return tm.Save(to)
+}
+
+func validateMaps(set *flag.FlagSet, args []string) error {
+	layout := masite.DefaultVRAM().String()
+	set.StringVar(&layout, "layout", layout, "VRAM layout as name=min-max,...")
+	set.Parse(args)
+	vram, err := masite.ParseVRAM(layout)
+	if err != nil {
+		return err
+	}
+	errs := vram.Check()
+	for _, name := range set.Args() {
+		tm, err := masite.ReadMap(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, err := range tm.Validate(vram) {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("validate: %d problems", len(errs))
+	}
+	return nil
+}
+
+func runScript(set *flag.FlagSet, args []string) error {
+	save := ""
+	set.StringVar(&save, "s", save, "save the map to this file after the script ran")
+	set.Parse(args)
+	if set.NArg() != 2 {
+		set.Usage()
+		return fmt.Errorf("run-script: needs a map and a script")
+	}
+	tm, err := masite.ReadMap(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	tila := masite.NewMapTila(masite.MapBinding{
+		Map: func() *masite.Map { return tm },
+		Load: func(name string) error {
+			m, err := masite.ReadMap(name)
+			if err == nil {
+				tm = m
+			}
+			return err
+		},
+	})
+	res := tila.RunFile(set.Arg(1))
+	os.Stdout.Write(tila.Out.Bytes())
+	os.Stderr.Write(tila.Err.Bytes())
+	if err, ok := res.(error); ok {
+		return fmt.Errorf("run-script: %w", err)
+	}
+	if save != "" {
+		return tm.Save(save)
+	}
+	return nil
+}
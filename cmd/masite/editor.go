@@ -0,0 +1,53 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/xmasengine/lox/masite"
+)
+
+// runEditor opens the map in the editor, or a new map of the tiles of
+// opts.from.
+func runEditor(opts editorOptions) {
+	hudRows, err := masite.ParseHUDRows(opts.hud)
+	errExit(err)
+
+	var tm *masite.Map
+	if opts.from != "" {
+		tm, err = masite.NewMap(opts.w, opts.h, opts.from)
+		errExit(err)
+	} else {
+		tm, err = masite.LoadMap(opts.name)
+		errExit(err)
+	}
+
+	if opts.theme != "" {
+		masite.ActiveTheme, err = masite.LoadTheme(opts.theme)
+		errExit(err)
+	}
+	if opts.font != "" {
+		loaded, err := masite.LoadFont(masite.FromName(opts.font), 8, 8)
+		errExit(err)
+		masite.DefaultFont = loaded // for themes picked later.
+		masite.ActiveTheme.SetFont(loaded)
+	}
+
+	sw, sh := ebiten.Monitor().Size()
+	ebiten.SetWindowSize(sw, sh)
+	ebiten.SetWindowTitle("mashite")
+	edit := masite.NewEditor(tm, opts.name, sw, sh, opts.scale)
+	edit.VRAM = opts.vram
+	edit.Overlays.HUDRows = hudRows
+	edit.RunStartup()
+	if opts.script != "" {
+		edit.RunScript(opts.script)
+	}
+	if err := ebiten.RunGame(edit); err != nil {
+		fmt.Printf("error: %s", err)
+		os.Exit(1)
+	}
+}
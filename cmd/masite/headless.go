@@ -0,0 +1,13 @@
+//go:build headless
+
+package main
+
+import (
+	"fmt"
+)
+
+// runEditor fails, as masite built with the headless tag has no editor,
+// only the subcommands, -vram and -world.
+func runEditor(opts editorOptions) {
+	errExit(fmt.Errorf("masite: built without the editor, use a subcommand, -vram or -world"))
+}
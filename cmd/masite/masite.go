@@ -1,16 +1,37 @@
 // masite is a Master System Tilemap Editor
 // It uses ebitengine and a very simplified widget system.
 // The maps are drastically simplified.
-// A map can only have one layer and one tile image,
+// A map has a base layer and optional extra tile and flag layers,
+// which are merged into one name table when exported, and one tile image,
 // however the editor can set all extended flags for the SMS.
+//
+// With -world masite numbers all maps in a directory, map by default,
+// resolves the exits to map numbers, exports every map to basic and
+// writes a map table with the bank of every map to world.bas.
+//
+// When the editor starts it runs masite.tila in the directory of the map,
+// if there is one, and then the script of -script.
+//
+// masite also has subcommands that work on map files without opening a
+// window, for use in the Makefile:
+//
+//	masite export [-f format] [-o out] map...
+//	masite convert in out
+//	masite resize -w width -h height map [out]
+//	masite validate [-layout vram] map...
+//	masite run-script [-s out] map script
+//
+// Built with -tags headless masite has only the subcommands, -vram and
+// -world, and builds without ebiten and a display stack.
 package main
 
 import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 
-	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/xmasengine/lox/bank"
 	"github.com/xmasengine/lox/masite"
 )
 
@@ -22,7 +43,6 @@ func errExit(err error) {
 }
 
 func main() {
-	var err error
 	name := ""
 	from := ""
 	w := 32
@@ -33,25 +53,126 @@ func main() {
 	flag.IntVar(&h, "h", h, "map height for new map")
 	flag.IntVar(&scale, "S", scale, "ui scale factor")
 	flag.StringVar(&from, "f", "", "tile source for new map")
+	vram := false
+	layout := masite.DefaultVRAM().String()
+	flag.BoolVar(&vram, "vram", vram, "report VRAM tile usage of the map and the map arguments, then exit")
+	flag.StringVar(&layout, "layout", layout, "VRAM layout as name=min-max,...")
+	world := false
+	output := "world.bas"
+	first := 4
+	flag.BoolVar(&world, "world", world, "number and export all maps in the directory argument, map by default, then exit")
+	flag.StringVar(&output, "o", output, "output file for the map table of -world")
+	flag.IntVar(&first, "b", first, "first ROM bank for the maps of -world")
+	hud := "23"
+	flag.StringVar(&hud, "hud", hud, "rows of the screen used by the HUD, separated by commas")
+	script := ""
+	flag.StringVar(&script, "script", script, "Tila script to run on the map when the editor starts")
+	font := ""
+	flag.StringVar(&font, "font", font, "image of an 8x8 font from space on, for the text of the editor")
+	theme := ""
+	flag.StringVar(&theme, "theme", theme, "theme of the editor, default, high-contrast or a theme JSON file")
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: masite [flags]\n%s", subcommandUsage())
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	var tm *masite.Map
+	if runSubcommand(flag.Args()) {
+		return
+	}
+
+	layoutVRAM, err := masite.ParseVRAM(layout)
+	errExit(err)
+
+	if vram {
+		reportVRAM(layoutVRAM, append([]string{name}, flag.Args()...))
+		return
+	}
+	if world {
+		dir := "map"
+		if flag.NArg() > 0 {
+			dir = flag.Arg(0)
+		}
+		exportWorld(dir, output, first)
+		return
+	}
+
+	runEditor(editorOptions{name: name, from: from, w: w, h: h, scale: scale,
+		vram: layoutVRAM, hud: hud, script: script, font: font, theme: theme})
+}
+
+// editorOptions are the flags that start the editor.
+type editorOptions struct {
+	name, from  string
+	w, h, scale int
+	vram        masite.VRAM
+	hud         string
+	script      string
+	font, theme string
+}
 
-	if from != "" {
-		tm, err = masite.NewMap(w, h, from)
+func reportVRAM(layout masite.VRAM, names []string) {
+	maps := []*masite.Map{}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		tm, err := masite.ReadMap(name)
 		errExit(err)
-	} else {
-		tm, err = masite.LoadMap(name)
+		maps = append(maps, tm)
+	}
+	errs := layout.Report(os.Stdout, maps...)
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func exportWorld(dir, output string, first int) {
+	w, err := masite.LoadWorld(dir)
+	errExit(err)
+
+	changed := w.Renumber()
+	resolved, _ := w.Resolve() // Validate reports the unresolved exits.
+	for _, name := range resolved {
+		if !slices.Contains(changed, name) {
+			changed = append(changed, name)
+		}
+	}
+	errExit(w.Save(changed...))
+	for _, name := range changed {
+		fmt.Fprintf(os.Stderr, "updated %s: number %d\n", w.Files[name], w.Maps[name].Number)
+	}
+
+	assets := []bank.Asset{}
+	for _, name := range w.Names {
+		file := w.Files[name] + string(masite.BasicFormat)
+		errExit(w.Maps[name].Export(file, masite.BasicFormat))
+		size, estimated, err := bank.Measure(file)
 		errExit(err)
+		assets = append(assets, bank.Asset{Name: file, Label: name, Size: size, Estimated: estimated})
+	}
+	banks, err := bank.Pack(assets, bank.Size, first)
+	errExit(err)
+	bankOf := map[string]int{}
+	for _, b := range banks {
+		for _, asset := range b.Assets {
+			bankOf[asset.Label] = b.Number
+		}
 	}
+	bank.Report(os.Stderr, banks)
+
+	out, err := os.Create(output)
+	errExit(err)
+	defer out.Close()
+	w.Basic(out, bankOf)
 
-	sw, sh := ebiten.Monitor().Size()
-	ebiten.SetWindowSize(sw, sh)
-	ebiten.SetWindowTitle("mashite")
-	edit := masite.NewEditor(tm, name, sw, sh, scale)
-	if err := ebiten.RunGame(edit); err != nil {
-		fmt.Printf("error: %s", err)
+	errs := w.Validate()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+	if len(errs) > 0 {
+		out.Close()
 		os.Exit(1)
 	}
 }
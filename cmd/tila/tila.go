@@ -0,0 +1,107 @@
+// tila runs Tila scripts against maps without opening a window.
+//
+// With script arguments it runs them in order and exits, otherwise it
+// reads commands from standard input. Blocks may span several lines.
+// The map of -m is read without its images, and saved to -s at the end
+// if -s is given.
+//
+//	tila -m map/m0003-church.xml -s out.xml wall.tila
+//
+// Build it with -tags headless to leave out ebiten and the editor, so it
+// builds without a display stack.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/xmasengine/lox/masite"
+)
+
+func errExit(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	name := ""
+	save := ""
+	loops := masite.TilaMaxLoops
+	flag.StringVar(&name, "m", name, "map to work on")
+	flag.StringVar(&save, "s", save, "save the map to this file at the end")
+	flag.IntVar(&loops, "loops", loops, "most rounds of a while or for loop, 0 for no limit")
+	flag.Parse()
+
+	var tm *masite.Map
+	if name != "" {
+		m, err := masite.ReadMap(name)
+		errExit(err)
+		tm = m
+	}
+	tila := masite.NewMapTila(masite.MapBinding{
+		Map: func() *masite.Map { return tm },
+		Load: func(name string) error {
+			m, err := masite.ReadMap(name)
+			if err == nil {
+				tm = m
+			}
+			return err
+		},
+	})
+	tila.MaxLoops = loops
+
+	if flag.NArg() > 0 {
+		for _, script := range flag.Args() {
+			res := tila.RunFile(script)
+			flush(tila)
+			if _, ok := res.(error); ok {
+				os.Exit(1)
+			}
+		}
+	} else {
+		repl(tila)
+	}
+
+	if save != "" {
+		if tm == nil {
+			errExit(fmt.Errorf("no map to save"))
+		}
+		errExit(tm.Save(save))
+	}
+}
+
+// repl reads commands until the end of the input. Lines are collected
+// until they form a complete script, so blocks can span lines.
+func repl(tila *masite.Tila) {
+	in := bufio.NewScanner(os.Stdin)
+	script := ""
+	fmt.Print("> ")
+	for in.Scan() {
+		script += in.Text() + "\n"
+		if _, err := tila.Parse(script); masite.IsIncomplete(err) {
+			fmt.Print("... ")
+			continue
+		}
+		tila.Run(script)
+		flush(tila)
+		script = ""
+		fmt.Print("> ")
+	}
+	fmt.Println()
+	if script != "" {
+		tila.Run(script)
+		flush(tila)
+	}
+	errExit(in.Err())
+}
+
+func flush(tila *masite.Tila) {
+	os.Stdout.Write(tila.Out.Bytes())
+	os.Stderr.Write(tila.Err.Bytes())
+	tila.Out.Reset()
+	tila.Err.Reset()
+}
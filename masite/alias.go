@@ -1,6 +1,5 @@
 package masite
 
-import "github.com/hajimehoshi/ebiten/v2"
 import "image"
 import "image/color"
 import "errors"
@@ -13,24 +12,25 @@ type (
 	Color           = color.Color
 	RGBA            = color.RGBA
 	Image           = image.Image
-	Surface         = ebiten.Image
-	Game            = ebiten.Game
 	Rectangle       = image.Rectangle
 	Point           = image.Point
-	Key             = ebiten.Key
 	TextMarshaler   = encoding.TextMarshaler
 	TextUnmarshaler = encoding.TextUnmarshaler
 )
 
+// Bounds returns the rectangle at x, y of w by h.
+func Bounds(x, y, w, h int) Rectangle {
+	return image.Rect(x, y, x+w, y+h)
+}
+
 type TextEncoding interface {
 	TextMarshaler
 	TextUnmarshaler
 }
 
 var (
-	Termination = ebiten.Termination
-	MidgetOK    = errors.New("OK")
-	MidgetTOP   = errors.New("TOP")
+	MidgetOK  = errors.New("OK")
+	MidgetTOP = errors.New("TOP")
 )
 
 func errExit(err error) {
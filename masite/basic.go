@@ -6,6 +6,7 @@ import "image/color"
 import "fmt"
 import "errors"
 import "bytes"
+import "strings"
 
 func col2b(col color.Color) byte {
 	cr, cb, cg, _ := col.RGBA()
@@ -96,23 +97,135 @@ func BitmapToBasic(out io.Writer, bitmap image.PalettedImage, pre string, cw, ch
 const SMS_SCREEN_TW = 32
 const SMS_SCREEN_TH = 24
 
-func (m *Map) Basic(out io.Writer) error {
-	fmt.Fprintf(out, "' Generated with masite\n\n")
-	fmt.Fprintf(out, "' Screen for tile map %s, offset: %d Size:%dx%d\n", m.Prefix, m.Offset, m.Width, m.Height)
-	fmt.Fprintf(out, "%s_map: \n", m.Prefix)
+// Scroll is how a map is split up when it is exported to basic.
+type Scroll string
+
+const (
+	ScrollScreens Scroll = ""        // A grid of screens, for flip screen areas.
+	ScrollColumns Scroll = "columns" // Columns, for horizontal hardware scrolling.
+	ScrollRows    Scroll = "rows"    // Rows, for vertical hardware scrolling.
+)
+
+// Screens returns the amount of screens the map needs horizontally and vertically.
+func (m *Map) Screens() (sw, sh int) {
+	sw = (m.Width + SMS_SCREEN_TW - 1) / SMS_SCREEN_TW
+	sh = (m.Height + SMS_SCREEN_TH - 1) / SMS_SCREEN_TH
+	return max(sw, 1), max(sh, 1)
+}
+
+// BasicCells writes the cells as a DATA BYTE statement,
+// with the tile index and the flags for every cell.
+func (m *Map) BasicCells(out io.Writer, cells []Cell) {
+	fmt.Fprintf(out, "DATA BYTE ")
+	for i, cell := range cells {
+		if i > 0 {
+			fmt.Fprintf(out, ",")
+		}
+		flag := byte(cell.Flag)
+		index := cell.Index + byte(m.Offset)
+		fmt.Fprintf(out, "$%02x,$%02x", byte(index), flag)
+	}
+	fmt.Fprintf(out, "\n")
+}
+
+// Strip returns w cells from the map starting at at, moving by step.
+// Cells outside of the map are empty.
+func (m *Map) Strip(at, step Point, w int) []Cell {
+	res := make([]Cell, w)
+	for i := range res {
+		res[i] = m.Get(at)
+		at = at.Add(step)
+	}
+	return res
+}
+
+// BasicScreen writes the screen at the tile position at.
+func (m *Map) BasicScreen(out io.Writer, label string, at Point) {
+	fmt.Fprintf(out, "%s: \n", label)
 	for y := 0; y < SMS_SCREEN_TH; y++ {
-		fmt.Fprintf(out, "DATA BYTE ")
-		for x := 0; x < SMS_SCREEN_TW; x++ {
-			if x > 0 {
-				fmt.Fprintf(out, ",")
-			}
-			cell := m.Get(image.Pt(x, y))
+		m.BasicCells(out, m.Strip(at.Add(image.Pt(0, y)), image.Pt(1, 0), SMS_SCREEN_TW))
+	}
+}
 
-			flag := byte(cell.Flag)
-			index := cell.Index + byte(m.Offset)
-			fmt.Fprintf(out, "$%02x,$%02x", byte(index), flag)
+// BasicTable writes a table with pointers to the labels.
+func BasicTable(out io.Writer, label string, labels []string, perLine int) {
+	fmt.Fprintf(out, "%s: \n", label)
+	for i := 0; i < len(labels); i += perLine {
+		line := labels[i:min(i+perLine, len(labels))]
+		fmt.Fprintf(out, "DATA VARPTR %s\n", strings.Join(line, ",VARPTR "))
+	}
+}
+
+// BasicMap writes the name table of the map.
+// A map that fits on a single screen is exported as one screen.
+// Larger maps are exported depending on m.Scroll as a grid of screens,
+// or as columns or rows for scrolling, with a lookup table of labels.
+func (m *Map) BasicMap(out io.Writer) error {
+	sw, sh := m.Screens()
+	pre := strings.ToUpper(m.Prefix)
+	switch m.Scroll {
+	case ScrollScreens:
+		if sw == 1 && sh == 1 {
+			m.BasicScreen(out, m.Prefix+"_map", image.Pt(0, 0))
+			return nil
+		}
+		fmt.Fprintf(out, "CONST %s_SCREENS_W = %d\n", pre, sw)
+		fmt.Fprintf(out, "CONST %s_SCREENS_H = %d\n\n", pre, sh)
+		labels := []string{}
+		for sy := 0; sy < sh; sy++ {
+			for sx := 0; sx < sw; sx++ {
+				label := fmt.Sprintf("%s_map_%d_%d", m.Prefix, sx, sy)
+				fmt.Fprintf(out, "' Screen %d,%d\n", sx, sy)
+				m.BasicScreen(out, label, image.Pt(sx*SMS_SCREEN_TW, sy*SMS_SCREEN_TH))
+				labels = append(labels, label)
+			}
 		}
-		fmt.Fprintf(out, "\n")
+		fmt.Fprintf(out, "' Screen lookup table, %d screens per row\n", sw)
+		BasicTable(out, m.Prefix+"_screens", labels, sw)
+	case ScrollColumns:
+		fmt.Fprintf(out, "CONST %s_COLUMNS = %d\n", pre, m.Width)
+		fmt.Fprintf(out, "CONST %s_COLUMN_LEN = %d\n\n", pre, m.Height)
+		labels := []string{}
+		for x := 0; x < m.Width; x++ {
+			label := fmt.Sprintf("%s_column_%d", m.Prefix, x)
+			fmt.Fprintf(out, "%s: \n", label)
+			m.BasicCells(out, m.Strip(image.Pt(x, 0), image.Pt(0, 1), m.Height))
+			labels = append(labels, label)
+		}
+		fmt.Fprintf(out, "' Column lookup table\n")
+		BasicTable(out, m.Prefix+"_columns", labels, 8)
+	case ScrollRows:
+		fmt.Fprintf(out, "CONST %s_ROWS = %d\n", pre, m.Height)
+		fmt.Fprintf(out, "CONST %s_ROW_LEN = %d\n\n", pre, m.Width)
+		labels := []string{}
+		for y := 0; y < m.Height; y++ {
+			label := fmt.Sprintf("%s_row_%d", m.Prefix, y)
+			fmt.Fprintf(out, "%s: \n", label)
+			m.BasicCells(out, m.Strip(image.Pt(0, y), image.Pt(1, 0), m.Width))
+			labels = append(labels, label)
+		}
+		fmt.Fprintf(out, "' Row lookup table\n")
+		BasicTable(out, m.Prefix+"_rows", labels, 8)
+	default:
+		return fmt.Errorf("Unknown scroll for map %s: %s", m.Prefix, m.Scroll)
+	}
+	return nil
+}
+
+func (m *Map) Basic(out io.Writer) error {
+	fmt.Fprintf(out, "' Generated with masite\n\n")
+	fmt.Fprintf(out, "' Screen for tile map %s, offset: %d Size:%dx%d\n", m.Prefix, m.Offset, m.Width, m.Height)
+	if err := m.Merged().BasicMap(out); err != nil {
+		return err
+	}
+	if m.Collision {
+		m.BasicCollision(out)
+	}
+	if err := m.BasicHeader(out); err != nil {
+		return err
+	}
+	if err := m.BasicPresences(out); err != nil {
+		return err
 	}
 	if m.From != "" {
 		pali, err := LoadPaletted(FromName(m.From))
@@ -127,6 +240,91 @@ func (m *Map) Basic(out io.Writer) error {
 	return nil
 }
 
+// BasicHeader writes the header table of the map, so the game can load
+// any map the same way. It has one byte for the map number, the border
+// color, the music index, the sprite sheet number and the amount of
+// presences, followed by the map numbers of the exits, one byte for every
+// direction from north to down. It returns an error if a value does not
+// fit in a byte.
+func (m *Map) BasicHeader(out io.Writer) error {
+	names := []string{"number", "border", "music", "sprites number"}
+	values := []int{m.Number, m.Border, m.Music, m.Sprites.Number}
+	for d := North; d < LastDirection; d++ {
+		names = append(names, d.String()+" exit number")
+		values = append(values, m.Exits.Exit(d).Number)
+	}
+	for i, value := range values {
+		if value < 0 || value > 255 {
+			return fmt.Errorf("header: %s %d not in 0-255", names[i], value)
+		}
+	}
+	fmt.Fprintf(out, "' Header: number, border, music, sprites, presences\n")
+	fmt.Fprintf(out, "' then exits: north, east, south, west, in, out, up, down\n")
+	fmt.Fprintf(out, "%s_header: \n", m.Prefix)
+	fmt.Fprintf(out, "DATA BYTE %d,%d,%d,%d,%d\n",
+		m.Number, m.Border, m.Music, m.Sprites.Number, len(m.Presences))
+	exits := []string{}
+	for d := North; d < LastDirection; d++ {
+		exits = append(exits, fmt.Sprintf("%d", m.Exits.Exit(d).Number))
+	}
+	fmt.Fprintf(out, "DATA BYTE %s\n", strings.Join(exits, ","))
+	return nil
+}
+
+// BasicPresences writes the presence table of the map. Every presence
+// has words for the kin, x, y, sprite offset, frames, item, money and
+// a pointer to its talk string, which is 0 if it has none.
+// The talk strings start with a length byte.
+func (m *Map) BasicPresences(out io.Writer) error {
+	fmt.Fprintf(out, "' Presences: kin, x, y, offset, frames, item, money, talk\n")
+	fmt.Fprintf(out, "%s_presences: \n", m.Prefix)
+	for i, p := range m.Presences {
+		talk := "0"
+		if p.Talk != "" {
+			talk = fmt.Sprintf("VARPTR %s_talk_%d", m.Prefix, i)
+		}
+		fmt.Fprintf(out, "DATA %d,%d,%d,%d,%d,%d,%d,%s\n",
+			p.Kin, p.X, p.Y, p.Offset, p.Frames, p.Item, p.Money, talk)
+	}
+	for i, p := range m.Presences {
+		if p.Talk == "" {
+			continue
+		}
+		fmt.Fprintf(out, "%s_talk_%d: \n", m.Prefix, i)
+		if err := BasicString(out, p.Talk); err != nil {
+			return fmt.Errorf("presence %d of map %s: %w", i, m.Prefix, err)
+		}
+	}
+	return nil
+}
+
+// BasicString writes the string as DATA BYTE with a length byte first.
+// Characters that cannot be in a CVBasic string are written as numbers.
+func BasicString(out io.Writer, str string) error {
+	if len(str) > 255 {
+		return fmt.Errorf("string too long: %d bytes, at most 255", len(str))
+	}
+	items := []string{fmt.Sprintf("%d", len(str))}
+	quoted := []byte{}
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c >= ' ' && c < 0x7f && c != '"' {
+			quoted = append(quoted, c)
+			continue
+		}
+		if len(quoted) > 0 {
+			items = append(items, `"`+string(quoted)+`"`)
+			quoted = quoted[:0]
+		}
+		items = append(items, fmt.Sprintf("%d", c))
+	}
+	if len(quoted) > 0 {
+		items = append(items, `"`+string(quoted)+`"`)
+	}
+	fmt.Fprintf(out, "DATA BYTE %s\n", strings.Join(items, ","))
+	return nil
+}
+
 type Basicer interface {
 	Basic(out io.Writer) error
 }
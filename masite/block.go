@@ -0,0 +1,169 @@
+package masite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Block is a rectangular block of cells, for copying and pasting
+// parts of maps, and for brushes.
+type Block struct {
+	XMLName xml.Name `json:"-" xml:"block"`
+	Width   int      `json:"width" xml:"width,attr"`
+	Height  int      `json:"height" xml:"height,attr"`
+	Rows    []Row    `json:"rows" xml:"rows"`
+}
+
+// NewBlock makes an empty block of w by h cells.
+func NewBlock(w, h int) *Block {
+	return &Block{Width: w, Height: h, Rows: MakeRows(w, h)}
+}
+
+// Get returns the cell at at in the block, or an empty cell if outside.
+func (b *Block) Get(at Point) Cell {
+	if at.X < 0 || at.Y < 0 || at.X >= b.Width || at.Y >= b.Height {
+		return Cell{}
+	}
+	return b.Rows[at.Y].Cells[at.X]
+}
+
+// Bounds returns the rectangle in tiles the block covers when placed at atTile.
+func (b *Block) Bounds(atTile Point) Rectangle {
+	return image.Rectangle{Min: atTile, Max: atTile.Add(image.Pt(b.Width, b.Height))}
+}
+
+// Clip returns the rectangle r in tiles clipped to the map.
+func (m *Map) Clip(r Rectangle) Rectangle {
+	return r.Canon().Intersect(image.Rect(0, 0, m.Width, m.Height))
+}
+
+// Copy copies the cells in the rectangle r of the active layer to a block.
+func (m *Map) Copy(r Rectangle) *Block {
+	r = r.Canon()
+	b := NewBlock(r.Dx(), r.Dy())
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			b.Rows[y].Cells[x] = m.Get(r.Min.Add(image.Pt(x, y)))
+		}
+	}
+	return b
+}
+
+// Clear clears the cells in the rectangle r of the active layer.
+func (m *Map) Clear(r Rectangle) {
+	r = m.Clip(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.Put(image.Pt(x, y), Cell{})
+		}
+	}
+}
+
+// Paste pastes the block in the active layer with its top left corner at atTile.
+// Cells outside of the map are skipped.
+func (m *Map) Paste(atTile Point, b *Block) {
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			m.Put(atTile.Add(image.Pt(x, y)), b.Rows[y].Cells[x])
+		}
+	}
+}
+
+// FlipHorizontal mirrors the block horizontally,
+// toggling the horizontal flip flag of every cell.
+func (b *Block) FlipHorizontal() {
+	for y := range b.Rows {
+		slices.Reverse(b.Rows[y].Cells)
+		for x := range b.Rows[y].Cells {
+			b.Rows[y].Cells[x].Flag ^= FlagHorizontalFlip
+		}
+	}
+}
+
+// FlipVertical mirrors the block vertically,
+// toggling the vertical flip flag of every cell.
+func (b *Block) FlipVertical() {
+	slices.Reverse(b.Rows)
+	for y := range b.Rows {
+		for x := range b.Rows[y].Cells {
+			b.Rows[y].Cells[x].Flag ^= FlagVerticalFlip
+		}
+	}
+}
+
+// Rotate rotates the block by 180 degrees.
+// The SMS can only flip tiles, so a rotation by 90 degrees is not possible.
+func (b *Block) Rotate() {
+	b.FlipHorizontal()
+	b.FlipVertical()
+}
+
+// BlockTextHeader starts the text form of a block.
+const BlockTextHeader = "masite block"
+
+// Text returns the block as text for the clipboard.
+// The first line is the header with the size, every following line is
+// a row of cells in the form index:flags separated by spaces.
+func (b *Block) Text() []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %d %d\n", BlockTextHeader, b.Width, b.Height)
+	for _, row := range b.Rows {
+		for x, cell := range row.Cells {
+			if x > 0 {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(buf, "%d:%s", cell.Index, cell.Flag)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// ParseText parses a block from text made with Text.
+func (b *Block) ParseText(text []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	if !scanner.Scan() {
+		return fmt.Errorf("block: empty text")
+	}
+	header, size, ok := strings.Cut(scanner.Text(), BlockTextHeader)
+	if !ok || header != "" {
+		return fmt.Errorf("block: header not found")
+	}
+	var w, h int
+	if _, err := fmt.Sscan(size, &w, &h); err != nil {
+		return fmt.Errorf("block: size: %w", err)
+	}
+	if w < 1 || h < 1 || w > MaxMapSize || h > MaxMapSize {
+		return fmt.Errorf("block: size %d %d not in 1-%d", w, h, MaxMapSize)
+	}
+	res := NewBlock(w, h)
+	for y := 0; y < h; y++ {
+		if !scanner.Scan() {
+			return fmt.Errorf("block: row %d missing", y)
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != w {
+			return fmt.Errorf("block: row %d has %d cells, expected %d", y, len(fields), w)
+		}
+		for x, field := range fields {
+			sidx, sflag, _ := strings.Cut(field, ":")
+			idx, err := strconv.ParseUint(sidx, 10, 8)
+			if err != nil {
+				return fmt.Errorf("block: cell %d,%d: %w", x, y, err)
+			}
+			var flag Flag
+			if err := flag.UnmarshalText([]byte(sflag)); err != nil {
+				return fmt.Errorf("block: cell %d,%d: %w", x, y, err)
+			}
+			res.Rows[y].Cells[x] = Cell{Index: byte(idx), Flag: flag}
+		}
+	}
+	*b = *res
+	return nil
+}
@@ -0,0 +1,32 @@
+package masite
+
+import (
+	"testing"
+)
+
+func TestBlockParseText(t *testing.T) {
+	tests := []struct {
+		text string
+		err  bool
+	}{
+		{BlockTextHeader + " 2 1\n1: 2:\n", false},
+		{BlockTextHeader + " 0 1\n", true},
+		{BlockTextHeader + " 1 -1\n", true},
+		{BlockTextHeader + " 100000 100000\n", true},
+		{BlockTextHeader + " 2 1\n1:\n", true},
+		{"2 1\n1: 2:\n", true},
+	}
+	for _, tt := range tests {
+		var b Block
+		err := b.ParseText([]byte(tt.text))
+		if (err != nil) != tt.err {
+			t.Errorf("ParseText(%q) error %v, want error %t", tt.text, err, tt.err)
+		}
+	}
+	b := NewBlock(2, 1)
+	b.Rows[0].Cells[1] = Cell{Index: 7}
+	var got Block
+	if err := got.ParseText(b.Text()); err != nil || got.Rows[0].Cells[1].Index != 7 {
+		t.Errorf("ParseText(Text()) = %v, %v", got.Rows, err)
+	}
+}
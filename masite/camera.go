@@ -0,0 +1,139 @@
+//go:build !headless
+
+package masite
+
+import (
+	"image"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Zoom levels of the map view, independent of the UI scale.
+const (
+	MinZoom = 1
+	MaxZoom = 4
+)
+
+// PanSpeed is the amount of pixels the camera pans per frame
+// while an arrow key is held.
+const PanSpeed = 4
+
+// ViewSize returns the size of the visible part of the map in pixels.
+func (e *Editor) ViewSize() Point {
+	scale := max(1, e.Scale)
+	zoom := max(MinZoom, e.Zoom)
+	return image.Pt(e.Size.X/scale/zoom, e.Size.Y/scale/zoom)
+}
+
+// MoveCamera moves the camera to show the map from at on,
+// keeping at least one tile of the map in view.
+func (e *Editor) MoveCamera(at Point) {
+	if e.Map != nil {
+		at.X = min(at.X, e.Map.Width*e.Map.Tw-e.Map.Tw)
+		at.Y = min(at.Y, e.Map.Height*e.Map.Th-e.Map.Th)
+	}
+	at.X = max(at.X, 0)
+	at.Y = max(at.Y, 0)
+	e.Camera = image.Rectangle{Min: at, Max: at.Add(e.ViewSize())}
+}
+
+// Pan moves the camera by delta map pixels.
+func (e *Editor) Pan(delta Point) {
+	e.MoveCamera(e.Camera.Min.Add(delta))
+}
+
+// SetZoom sets the zoom level, keeping the map pixel under the mouse in place.
+func (e *Editor) SetZoom(zoom int) {
+	zoom = min(max(zoom, MinZoom), MaxZoom)
+	if zoom == e.Zoom {
+		return
+	}
+	at := e.Camera.Min.Add(e.Hover.Div(max(MinZoom, e.Zoom)))
+	e.Zoom = zoom
+	e.MoveCamera(at.Sub(e.Hover.Div(zoom)))
+	e.ShowMessage("Zoom %dx", zoom)
+}
+
+// UpdateCamera pans the camera with the arrow keys or by dragging
+// with the middle mouse button. It returns true if the middle button was
+// released after a drag, so the click should not be handled otherwise.
+func (e *Editor) UpdateCamera() bool {
+	delta := Point{}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowLeft) {
+		delta.X -= PanSpeed
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowRight) {
+		delta.X += PanSpeed
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowUp) {
+		delta.Y -= PanSpeed
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowDown) {
+		delta.Y += PanSpeed
+	}
+	e.Pan(delta)
+
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonMiddle) {
+		e.PanFrom = e.Hover
+		e.Panned = false
+	}
+	if ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
+		moved := e.PanFrom.Sub(e.Hover).Div(max(MinZoom, e.Zoom))
+		if !moved.Eq(Point{}) {
+			e.Pan(moved)
+			e.PanFrom = e.Hover
+			e.Panned = true
+		}
+	}
+	return ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonMiddle) && e.Panned
+}
+
+// DrawMap draws the map and the overlays as seen through the camera,
+// scaled up by the zoom level.
+func (e *Editor) DrawMap(screen *Surface) {
+	view := screen
+	if e.Zoom > MinZoom {
+		size := e.Camera.Size()
+		if e.View == nil || e.View.Bounds().Size() != size {
+			e.View = ebiten.NewImage(size.X, size.Y)
+		}
+		e.View.Clear()
+		view = e.View
+	}
+
+	e.Map.Render(view, e.Camera)
+	e.Overlays.Render(view, e.Map, e.Camera)
+	if e.Map.Inside(e.Tile) {
+		e.Midget.Style.DrawCursor(view, e.TileBounds(Bounds(e.Tile.X, e.Tile.Y, 1, 1)))
+	}
+	if !e.Selection.Empty() {
+		DrawRect(view, e.TileBounds(e.Selection), 1, selectionColor)
+	}
+	for _, at := range e.Shape {
+		FillRect(view, e.TileBounds(Bounds(at.X, at.Y, 1, 1)), shapeColor)
+	}
+	if e.Chosen >= 0 && e.Chosen < len(e.Map.Presences) {
+		DrawRect(view, e.Map.Presences[e.Chosen].Bounds().Sub(e.Camera.Min), 1, selectionColor)
+	}
+	if e.Brush != nil && e.Tool == PaintTool {
+		DrawRect(view, e.TileBounds(e.Brush.Bounds(e.Tile)), 1, selectionColor)
+	}
+
+	if view != screen {
+		opts := ebiten.DrawImageOptions{}
+		opts.GeoM.Scale(float64(e.Zoom), float64(e.Zoom))
+		screen.DrawImage(view, &opts)
+	}
+}
+
+// StatusX returns where the status text is drawn: right of the map,
+// but never outside of the screen.
+func (e *Editor) StatusX() int {
+	right := (e.Map.Width*e.Map.Tw - e.Camera.Min.X) * max(MinZoom, e.Zoom)
+	return max(0, min(right, e.Size.X/max(1, e.Scale)-StatusWidth))
+}
+
+// StatusWidth is the room kept for the status text.
+const StatusWidth = 240
@@ -1,3 +1,5 @@
+//go:build !headless
+
 package masite
 
 import (
@@ -72,3 +74,22 @@ func init() {
 	}
 	clipboardAvailable = err == nil
 }
+
+// WriteClipboardBlock writes the block as text to the clipboard.
+func WriteClipboardBlock(b *Block) {
+	WriteClipboard(ClipboardText, b.Text())
+}
+
+// ReadClipboardBlock reads a block from the text in the clipboard.
+// It returns nil if the clipboard does not contain a block.
+func ReadClipboardBlock() *Block {
+	text := ReadClipboard(ClipboardText)
+	if !bytes.HasPrefix(text, []byte(BlockTextHeader)) {
+		return nil
+	}
+	b := &Block{}
+	if err := b.ParseText(text); err != nil {
+		return nil
+	}
+	return b
+}
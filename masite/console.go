@@ -0,0 +1,234 @@
+//go:build !headless
+
+package masite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// ConsoleMaxLines is the most lines of output the console keeps.
+const ConsoleMaxLines = 1000
+
+// Console runs Tila commands and keeps their output, which can be scrolled
+// with Page Up, Page Down and the mouse wheel. Up and Down recall the
+// commands entered earlier.
+type Console struct {
+	Asker
+	Tila    *Tila
+	Lines   []string
+	Errors  map[int]bool // Lines that are errors.
+	Scroll  int          // Amount of lines scrolled back from the end.
+	History []string
+	Recall  int                          // Index in History of the recalled command.
+	Batch   func(name string, op func()) // Runs a line or a script, for undo.
+}
+
+func NewConsole(bounds Rectangle, prompt string, tila *Tila) *Console {
+	c := &Console{Tila: tila, Errors: map[int]bool{}}
+	c.Asker = *Ask(bounds, prompt, "", c.Enter)
+	return c
+}
+
+// Print adds lines of output to the console, wrapped to its width,
+// and scrolls to the end.
+func (c *Console) Print(text string, isError bool) {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return
+	}
+	for _, line := range c.Style.Font.Wrap(text, c.Bounds.Dx()-2*c.Style.Padding) {
+		if isError {
+			c.Errors[len(c.Lines)] = true
+		}
+		c.Lines = append(c.Lines, line)
+	}
+	if drop := len(c.Lines) - ConsoleMaxLines; drop > 0 {
+		c.Lines = c.Lines[drop:]
+		kept := map[int]bool{}
+		for i := range c.Errors {
+			if i >= drop {
+				kept[i-drop] = true
+			}
+		}
+		c.Errors = kept
+	}
+	c.Scroll = 0
+}
+
+// Flush moves the output of Tila to the console.
+func (c *Console) Flush() {
+	c.Print(c.Tila.Out.String(), false)
+	c.Print(c.Tila.Err.String(), true)
+	c.Tila.Out.Reset()
+	c.Tila.Err.Reset()
+}
+
+// Enter runs the command and keeps the console open.
+func (c *Console) Enter(command string) bool {
+	if strings.TrimSpace(command) == "" {
+		return false
+	}
+	c.Print(">"+command, false)
+	c.batch(command, func() { c.Tila.Run(command) })
+	c.Flush()
+	if len(c.History) == 0 || c.History[len(c.History)-1] != command {
+		c.History = append(c.History, command)
+	}
+	c.Recall = len(c.History)
+	c.Buf = []rune{}
+	c.Cursor = 0
+	return false
+}
+
+// RunFile runs a script file and shows its output.
+func (c *Console) RunFile(name string) error {
+	c.Print(fmt.Sprintf(">source %q", name), false)
+	var res any
+	c.batch("source "+name, func() { res = c.Tila.RunFile(name) })
+	c.Flush()
+	err, _ := res.(error)
+	return err
+}
+
+// batch runs op in Batch if set.
+func (c *Console) batch(name string, op func()) {
+	if c.Batch == nil {
+		op()
+		return
+	}
+	c.Batch(name, op)
+}
+
+// Shown returns how many lines of output fit in the console.
+func (c *Console) Shown() int {
+	h := c.Bounds.Dy() - c.Style.Font.Height
+	if c.Caption.Text != "" {
+		h -= c.Caption.Bounds.Dy()
+	}
+	return max(1, h/c.Style.Font.Height)
+}
+
+func (c *Console) ScrollBy(lines int) {
+	c.Scroll = max(0, min(c.Scroll+lines, len(c.Lines)-c.Shown()))
+}
+
+func (c *Console) recall(index int) {
+	if len(c.History) == 0 {
+		return
+	}
+	c.Recall = max(0, min(index, len(c.History)))
+	if c.Recall == len(c.History) {
+		c.Buf = []rune{}
+	} else {
+		c.Buf = []rune(c.History[c.Recall])
+	}
+	c.Cursor = len(c.Buf)
+}
+
+func (c *Console) Update() error {
+	handled := false
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyUp:
+			c.recall(c.Recall - 1)
+			handled = true
+		case ebiten.KeyDown:
+			c.recall(c.Recall + 1)
+			handled = true
+		case ebiten.KeyPageUp:
+			c.ScrollBy(c.Shown() - 1)
+			handled = true
+		case ebiten.KeyPageDown:
+			c.ScrollBy(1 - c.Shown())
+			handled = true
+		default:
+		}
+	}
+	if c.IsMouseIn() {
+		if _, dy := ActiveInput.Wheel(); dy != 0 {
+			c.ScrollBy(int(dy * 3))
+			handled = true
+		}
+	}
+	err := c.Asker.Update()
+	if err != nil {
+		return err
+	}
+	if handled {
+		return MidgetOK
+	}
+	return nil
+}
+
+func (c Console) Draw(s *Surface) {
+	c.Midget.Draw(s)
+	bounds := c.Bounds
+	if c.Caption.Text != "" {
+		bounds.Min.Y = c.Caption.Bounds.Max.Y
+	}
+	shown := c.Shown()
+	end := len(c.Lines) - c.Scroll
+	start := max(0, end-shown)
+	lh := c.Style.Font.Height
+	y := bounds.Min.Y
+	for i := start; i < end; i++ {
+		style := c.Style
+		if c.Errors[i] {
+			style = ActiveTheme.For(ClassError)
+			FillRect(s, Bounds(bounds.Min.X, y, bounds.Dx(), lh), style.Filled)
+		}
+		style.DrawText(s, c.Lines[i], bounds.Min.X+c.Style.Padding, y)
+		y += lh
+	}
+	if c.Scroll > 0 {
+		more := fmt.Sprintf("[%d more]", c.Scroll)
+		c.Style.DrawText(s, more, bounds.Max.X-c.Style.Font.Advance(more)-c.Style.Padding, bounds.Min.Y)
+	}
+	input := fmt.Sprintf("%s>%s|%s", c.Prompt, string(c.Buf[:c.Cursor]), string(c.Buf[c.Cursor:]))
+	c.Style.DrawText(s, input, bounds.Min.X+c.Style.Padding, bounds.Max.Y-lh)
+}
+
+// StartupScript is run when the editor starts, if it is in the directory
+// of the map, so a project can define its own procs.
+const StartupScript = "masite.tila"
+
+// ShowConsole shows and focuses the console, with the output of earlier
+// commands.
+func (e *Editor) ShowConsole() {
+	if slices.Contains(e.Midget.Kids, Game(e.Console)) {
+		e.Midget.FocusOn(e.Console)
+	} else {
+		e.Midget.Add(e.Console)
+	}
+}
+
+// RunScript runs a script file in the console.
+func (e *Editor) RunScript(name string) bool {
+	err := e.Console.RunFile(name)
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if err == nil {
+		e.ShowMessage("Ran %s", name)
+		return true
+	}
+	return false
+}
+
+// RunStartup runs the StartupScript next to the map, if there is one.
+func (e *Editor) RunStartup() bool {
+	name := filepath.Join(filepath.Dir(e.Name), StartupScript)
+	if _, err := os.Stat(name); err != nil {
+		return false
+	}
+	return e.RunScript(name)
+}
@@ -0,0 +1,23 @@
+//go:build !headless
+
+package masite
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// The types of ebiten the editor draws with and reads the input with.
+// Without them masite builds with the headless tag, see headless.go.
+type (
+	Surface     = ebiten.Image
+	Game        = ebiten.Game
+	Key         = ebiten.Key
+	MouseButton = ebiten.MouseButton
+)
+
+var Termination = ebiten.Termination
+
+// NewSurface returns a surface with the pixels of the image.
+func NewSurface(img Image) *Surface {
+	return ebiten.NewImageFromImage(img)
+}
@@ -1,15 +1,17 @@
+//go:build !headless
+
 package masite
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"os"
+	"strings"
 )
 
 import (
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 type Editor struct {
@@ -28,39 +30,67 @@ type Editor struct {
 	MessageTicks  int
 	Presence      Presence
 	Backup
+	History
 	Commander *Tila
+	Console   *Console
+	Menu      *MenuBar
+	VRAM      VRAM
+	Tool      Tool
+	Selection Rectangle // Selected tiles.
+	SelectAt  Point     // Tile where the selection started.
+	Clip      *Block    // Copied cells.
+	Brush     *Block    // Cells painted at once, if set.
+	Stamps    *Stamps   // Stamp library of the tile set.
+	Shape     []Point   // Preview of the shape being drawn.
+	ShapeAt   Point     // Tile where the shape started.
+	Size      Point     // Size of the window.
+	Zoom      int       // Zoom level of the map.
+	View      *Surface  // Offscreen buffer for zooming.
+	PanFrom   Point     // Mouse position where panning started.
+	Panned    bool      // Camera moved by dragging.
+	Overlays  Overlays
+	Chosen    int       // Index of the chosen presence, -1 if none.
+	Grab      Point     // Where the chosen presence was grabbed.
+	Moving    *Snapshot // Map before the chosen presence was dragged.
+	Saved     []byte    // Map as last loaded or saved, see SavedMap.
 }
 
-func (e Editor) Draw(screen *ebiten.Image) {
+func (e *Editor) Draw(screen *ebiten.Image) {
 	if e.Map != nil {
-		e.Map.Render(screen, e.Camera)
-		if e.Tile.In(image.Rect(0, 0, e.Map.Width-1, e.Map.Height-1)) {
-			e.Midget.Style.DrawCursor(screen,
-				Bounds(e.Tile.X*e.Map.Tw, e.Tile.Y*e.Map.Th, e.Map.Tw, e.Map.Th).Add(e.Camera.Min),
-			)
-		}
+		e.DrawMap(screen)
 	}
 
 	kl := len(e.Midget.Kids)
-	y := 10
-	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s: (%d,%d): %d %s %d",
-		e.Name, e.Hover.X, e.Hover.Y, e.Cell.Index, e.Cell.Flag, kl), e.Map.Width*e.Map.Tw, y)
-	y += 12
+	status := []string{
+		fmt.Sprintf("%s: (%d,%d): %d %s %d",
+			e.Name, e.Hover.X, e.Hover.Y, e.Cell.Index, e.Cell.Flag, kl),
+		"Layer " + e.Map.LayerStatus(),
+		"Tool " + e.Tool.String(),
+		"Show " + e.Overlays.Status(),
+	}
+	y := e.Menu.Bounds.Max.Y + 10 // Below the menu bar.
+	y = e.DrawStatus(screen, strings.Join(status, "\n"), e.Midget.Style, y)
 	if e.Error != nil {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Error: %s [%d]", e.Error, kl),
-			e.Map.Width*e.Map.Tw, y)
-		y += 12
+		msg := fmt.Sprintf("Error: %s [%d]", e.Error, kl)
+		y = e.DrawStatus(screen, msg, ActiveTheme.For(ClassError), y)
 	}
 	if e.Message != "" {
-		ebitenutil.DebugPrintAt(screen, e.Message, e.Map.Width*e.Map.Tw, y)
-		y += 12
+		e.DrawStatus(screen, e.Message, ActiveTheme.For(ClassInfo), y)
 	}
 	e.Midget.Draw(screen)
 }
 
+// DrawStatus draws status text at y, wrapped and in the style, and
+// returns the y below it.
+func (e *Editor) DrawStatus(screen *Surface, text string, style Style, y int) int {
+	lines := style.Font.Wrap(text, StatusWidth)
+	style.DrawText(screen, strings.Join(lines, "\n"), e.StatusX(), y)
+	return y + len(lines)*style.Font.Height
+}
+
 func (e Editor) Layout(w, h int) (rw, th int) {
 	e.Midget.Layout(w, h)
-	return e.Camera.Dx() / e.Scale, e.Camera.Dy() / e.Scale
+	return e.Size.X / max(1, e.Scale), e.Size.Y / max(1, e.Scale)
 }
 
 func (e *Editor) UpdateTilers() {
@@ -80,8 +110,8 @@ func (e *Editor) LoadSurface(name string) bool {
 		e.TileWatcher = nil
 	}
 	e.TileWatcher = Watch(name)
-	err := e.Map.LoadSurface(name)
-	if err != nil {
+	err := e.History.Try(e.Map, "load tiles", func() error { return e.Map.LoadSurface(name) })
+	if err == nil {
 		e.UpdateTilers()
 	}
 	e.Error = err
@@ -95,8 +125,8 @@ func (e *Editor) LoadSpriteSurface(name string) bool {
 		e.SpriteWatcher = nil
 	}
 	e.SpriteWatcher = Watch(name)
-	err := e.Map.Sprites.LoadSurface(name)
-	if err != nil {
+	err := e.History.Try(e.Map, "load sprites", func() error { return e.Map.Sprites.LoadSurface(name) })
+	if err == nil {
 		e.UpdateTilers()
 	}
 	e.Error = err
@@ -151,13 +181,17 @@ func (e *Editor) UpdateWatcher() bool {
 }
 
 func (e *Editor) TileSelected(x, y int) {
-	_, h := e.Map.Surface.Size()
-	idx := x + y*(h/e.Map.Th)
-	if idx > 255 {
-		idx -= 255
-		e.Cell.Flag |= FlagExtended
-	}
-	e.Cell.Index = byte(max(0, idx))
+	cell := e.Map.SheetCell(x, y)
+	e.Cell.Index = cell.Index
+	e.Cell.Flag = e.Cell.Flag&^FlagExtended | cell.Flag
+	e.Brush = nil
+}
+
+// BrushSelected makes a brush of the tiles selected in the tile sheet.
+func (e *Editor) BrushSelected(r Rectangle) {
+	e.Brush = e.Map.SheetBlock(r)
+	e.Cell = e.Brush.Get(Point{})
+	e.ShowMessage("Brush %dx%d", e.Brush.Width, e.Brush.Height)
 }
 
 func (e *Editor) SpriteSelected(x, y int) {
@@ -172,6 +206,7 @@ func (e *Editor) SaveMap(name string) bool {
 	e.Midget.Error(70, 70, 270, 120, err)
 	if e.Error == nil {
 		e.Name = name
+		e.Saved = SavedMap(e.Map)
 		e.ShowMessage("Map saved to %s", name)
 		return true
 	}
@@ -190,6 +225,259 @@ func (e *Editor) ExportBasic() bool {
 	return false
 }
 
+func (e *Editor) ReportVRAM() {
+	report, errs := e.VRAM.ReportString(e.Map)
+	area := e.Midget.ShowText(50, 20, 400, 250, "VRAM", report)
+	if len(errs) > 0 {
+		area.SetClass(ClassWarning)
+	} else {
+		area.SetClass(ClassInfo)
+	}
+}
+
+// SetTheme makes the theme active and restyles the editor with it.
+func (e *Editor) SetTheme(theme *Theme) {
+	ActiveTheme = theme
+	e.Midget.Restyle()
+	e.Console.Restyle()
+	e.Menu.Resize()
+	e.ShowMessage("Theme %s", theme.Name)
+}
+
+// LoadTheme loads a built-in theme or a theme file and makes it active.
+func (e *Editor) LoadTheme(name string) bool {
+	theme, err := LoadTheme(name)
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if e.Error == nil {
+		e.SetTheme(theme)
+		return true
+	}
+	return false
+}
+
+// AddLayer adds a layer described as "name kind", where kind is tiles or flags.
+func (e *Editor) AddLayer(desc string) bool {
+	name, kind, _ := strings.Cut(strings.TrimSpace(desc), " ")
+	if kind == "" {
+		kind = string(TileLayer)
+	}
+	err := e.Map.AddLayer(name, LayerKind(strings.TrimSpace(kind)))
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if e.Error == nil {
+		e.ShowMessage("Layer added: %s", e.Map.LayerStatus())
+		return true
+	}
+	return false
+}
+
+var selectionColor = RGBA{R: 255, G: 255, B: 0, A: 0xcc}
+var shapeColor = RGBA{R: 255, G: 255, B: 0, A: 0x55}
+
+// TileBounds returns the rectangle of tiles r in screen coordinates.
+func (e *Editor) TileBounds(r Rectangle) Rectangle {
+	tw, th := e.Map.Tw, e.Map.Th
+	return image.Rect(r.Min.X*tw, r.Min.Y*th, r.Max.X*tw, r.Max.Y*th).Sub(e.Camera.Min)
+}
+
+// UpdateSelection updates the selection while the mouse is dragged.
+func (e *Editor) UpdateSelection() {
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		e.SelectAt = e.Tile
+	}
+	r := image.Rectangle{Min: e.SelectAt, Max: e.Tile}.Canon()
+	r.Max = r.Max.Add(image.Pt(1, 1))
+	e.Selection = e.Map.Clip(r)
+}
+
+// CopySelection copies the selection to the clip and the clipboard.
+func (e *Editor) CopySelection() {
+	if e.Selection.Empty() {
+		e.ShowMessage("Nothing selected")
+		return
+	}
+	e.Clip = e.Map.Copy(e.Selection)
+	WriteClipboardBlock(e.Clip)
+	e.ShowMessage("Copied %dx%d", e.Clip.Width, e.Clip.Height)
+}
+
+// CutSelection copies the selection and then clears it.
+func (e *Editor) CutSelection() {
+	e.CopySelection()
+	e.History.Cells(e.Map, "cut", func() { e.Map.Clear(e.Selection) })
+}
+
+// DeleteSelection clears the selection.
+func (e *Editor) DeleteSelection() {
+	e.History.Cells(e.Map, "delete", func() { e.Map.Clear(e.Selection) })
+}
+
+// PasteClip pastes the clipboard at the hovered tile.
+// A block in the system clipboard has precedence,
+// so blocks can be copied between editors.
+func (e *Editor) PasteClip() {
+	if clip := ReadClipboardBlock(); clip != nil {
+		e.Clip = clip
+	}
+	if e.Clip == nil {
+		e.ShowMessage("Nothing to paste")
+		return
+	}
+	e.History.Paste(e.Map, e.Tile, e.Clip)
+	e.Selection = e.Map.Clip(Bounds(e.Tile.X, e.Tile.Y, e.Clip.Width, e.Clip.Height))
+}
+
+// PasteAtSelection pastes the clipboard at the start of the selection,
+// or at the top left of the map.
+func (e *Editor) PasteAtSelection() {
+	e.Tile = e.Selection.Min
+	e.PasteClip()
+}
+
+// TransformSelection transforms the selected cells in place.
+func (e *Editor) TransformSelection(name string, transform func(b *Block)) {
+	if e.Selection.Empty() {
+		return
+	}
+	e.History.Cells(e.Map, name, func() {
+		block := e.Map.Copy(e.Selection)
+		transform(block)
+		e.Map.Paste(e.Selection.Min, block)
+	})
+}
+
+// LoadStamps loads the stamp library of the tile set if needed.
+func (e *Editor) LoadStamps() bool {
+	name := StampsName(e.Name, e.Map.From)
+	if e.Stamps != nil && e.Stamps.Tileset == e.Map.From {
+		return true
+	}
+	stamps, err := LoadStamps(name)
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if e.Error != nil {
+		return false
+	}
+	stamps.Tileset = e.Map.From
+	e.Stamps = stamps
+	return true
+}
+
+// SaveStamp saves the brush, or else the selection, as a stamp.
+func (e *Editor) SaveStamp(name string) bool {
+	name = strings.TrimSpace(name)
+	block := e.Brush
+	if block == nil && !e.Selection.Empty() {
+		block = e.Map.Copy(e.Selection)
+	}
+	if block == nil || name == "" || !e.LoadStamps() {
+		return false
+	}
+	e.Stamps.Add(name, block)
+	file := StampsName(e.Name, e.Map.From)
+	err := e.Stamps.Save(file)
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if e.Error == nil {
+		e.ShowMessage("Stamp %s saved to %s", name, file)
+		return true
+	}
+	return false
+}
+
+// PickStamp makes the named stamp the brush.
+func (e *Editor) PickStamp(name string) bool {
+	if !e.LoadStamps() {
+		return false
+	}
+	stamp := e.Stamps.Find(strings.TrimSpace(name))
+	if stamp == nil {
+		e.ShowMessage("No stamp %s", name)
+		return false
+	}
+	e.Brush = stamp.Block
+	e.ShowMessage("Brush %s", stamp.Name)
+	return true
+}
+
+// StampListRows is the most stamps the list to pick one from shows at once.
+const StampListRows = 12
+
+// AskStamp asks for a name to save a stamp as, or shows the stamps in a
+// list to pick one from.
+func (e *Editor) AskStamp(pick bool) {
+	if !e.LoadStamps() {
+		return
+	}
+	names := e.Stamps.Names()
+	if pick {
+		if len(names) == 0 {
+			e.ShowMessage("No stamps, save one with T")
+			return
+		}
+		h := e.Midget.Style.CaptionHeight + min(len(names), StampListRows)*e.Midget.Style.RowHeight()
+		e.Midget.AskList(50, 50, 200, h, "Pick Stamp", names, func(index int) bool {
+			return e.PickStamp(names[index])
+		})
+		return
+	}
+	if e.Brush == nil && e.Selection.Empty() {
+		e.ShowMessage("Select a brush or cells first")
+		return
+	}
+	e.Midget.Ask(50, 50, 300, 120, "Save Stamp\n"+strings.Join(names, " "), "", e.SaveStamp)
+}
+
+// IsFlagsOnly returns true if only flags should be drawn.
+func (e *Editor) IsFlagsOnly() bool {
+	return ActiveInput.KeyPressDuration(ebiten.KeyControlLeft) > 0 || e.Map.Flags
+}
+
+// UpdateShape updates the preview of the shape while the mouse is dragged.
+func (e *Editor) UpdateShape() {
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		e.ShapeAt = e.Tile
+	}
+	e.Shape = ShapePoints(e.Tool, e.ShapeAt, e.Tile)
+}
+
+// DrawShape draws the shape when the mouse is released.
+func (e *Editor) DrawShape() {
+	e.History.PutPoints(e.Map, e.Tool.String(), e.Shape, e.Cell, e.IsFlagsOnly())
+	e.Shape = nil
+}
+
+// SetHUDRows sets the HUD rows from a list separated by commas.
+func (e *Editor) SetHUDRows(text string) bool {
+	rows, err := ParseHUDRows(text)
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if e.Error != nil {
+		return false
+	}
+	e.Overlays.HUDRows = rows
+	e.Overlays.HUD = true
+	return true
+}
+
+// SetTool selects the tool the mouse uses.
+func (e *Editor) SetTool(tool Tool) {
+	e.Tool = tool
+	e.ShowMessage("Tool %s", e.Tool)
+}
+
+// UpdateTool selects the tool if one of the tool keys was pressed.
+func (e *Editor) UpdateTool() bool {
+	for i, key := range ToolKeys {
+		if ActiveInput.IsKeyJustPressed(key) {
+			e.SetTool(Tool(i))
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Editor) SaveMapToFile(f *os.File) error {
 	err := e.Map.SaveToFile(f)
 	e.Error = err
@@ -205,6 +493,8 @@ func (e *Editor) LoadMapFromFile(f *os.File) error {
 	e.Error = err
 	if e.Error == nil {
 		e.Map = m
+		e.History.Clear()
+		e.Chosen = -1
 		e.UpdateTilers()
 		e.ShowMessage("Map restored from %s", f.Name())
 		return nil
@@ -218,6 +508,9 @@ func (e *Editor) LoadMap(name string) bool {
 	e.Midget.Error(70, 70, 270, 120, err)
 	if e.Error == nil {
 		e.Map = m
+		e.Saved = SavedMap(m)
+		e.History.Clear()
+		e.Chosen = -1
 		e.UpdateTilers()
 		e.ShowMessage("Map loaded from %s", name)
 		e.Name = name
@@ -226,6 +519,144 @@ func (e *Editor) LoadMap(name string) bool {
 	return false
 }
 
+// SavedMap returns the map as it is saved, so only changes that are
+// saved count as modifications.
+func SavedMap(m *Map) []byte {
+	buf, _ := MasiteFormat.Marshal(m)
+	return buf
+}
+
+// Modified returns true if the map changed since it was loaded or saved.
+func (e *Editor) Modified() bool {
+	return !bytes.Equal(e.Saved, SavedMap(e.Map))
+}
+
+// ConfirmLoadMap loads a map, after asking to discard the changes to the
+// map if it was modified.
+func (e *Editor) ConfirmLoadMap(name string) bool {
+	if !e.Modified() {
+		return e.LoadMap(name)
+	}
+	e.Midget.YesNo(50, 50, 300, 100, "Discard unsaved changes?", "Y", func(yes bool) {
+		if yes {
+			e.LoadMap(name)
+		}
+	})
+	return true
+}
+
+func (e *Editor) AskSaveMap() {
+	e.Midget.PickFile("Save As", e.Name, IsMapFile, ".xml", true, e.SaveMap)
+}
+
+func (e *Editor) AskLoadMap() {
+	e.Midget.PickFile("Load From", e.Name, IsMapFile, ".xml", false, e.ConfirmLoadMap)
+}
+
+func (e *Editor) AskTileImage() {
+	e.Midget.PickFile("From", e.Map.From, IsImageFile, ".png", false, e.LoadSurface)
+}
+
+func (e *Editor) AskSpriteImage() {
+	e.Midget.PickFile("Sprites", e.Map.Sprites.From, IsImageFile, ".png", false, e.LoadSpriteSurface)
+}
+
+func (e *Editor) AskTheme() {
+	e.Midget.PickFile("Theme", "", IsThemeFile, ".json", false, e.LoadTheme)
+}
+
+func (e *Editor) AskPrefix() {
+	e.Midget.AskString(50, 50, 250, 100, "Prefix", &e.Map.Prefix)
+}
+
+func (e *Editor) AskOffset() {
+	e.Midget.AskInt(50, 50, 250, 100, "Offset", &e.Map.Offset)
+}
+
+func (e *Editor) AskScale() {
+	e.Midget.AskInt(50, 50, 250, 100, "UI Scale", &e.Scale)
+}
+
+func (e *Editor) AskFlags() {
+	e.Midget.AskText(50, 50, 250, 100, "Flag", &e.Cell.Flag)
+}
+
+func (e *Editor) AskAddLayer() {
+	e.Midget.Ask(50, 50, 250, 100, "Add Layer\nname tiles|flags", "", e.AddLayer)
+}
+
+func (e *Editor) AskHUDRows() {
+	e.Midget.Ask(50, 50, 250, 100, "HUD rows", FormatHUDRows(e.Overlays.HUDRows), e.SetHUDRows)
+}
+
+func (e *Editor) AskQuit() {
+	e.Midget.YesNo(50, 50, 250, 100, "Quit", "Y", e.SetDone)
+}
+
+func (e *Editor) AskRestore() {
+	e.Midget.YesNo(50, 50, 250, 100, "Restore backup", "Y", e.Restore)
+}
+
+func (e *Editor) CommitBackup() {
+	e.Backup.Commit(e.SaveMapToFile)
+}
+
+// ShowHelp shows the help in a text area as large as the screen allows.
+func (e *Editor) ShowHelp() {
+	title, text, _ := strings.Cut(HELP, "\n")
+	screen := e.Size.Div(max(1, e.Scale))
+	size := e.Midget.Style.Font.Measure(text).Add(image.Pt(8, e.Midget.Style.CaptionHeight))
+	x, y := 20, e.Menu.Bounds.Max.Y+4 // Below the menu bar.
+	w := max(100, min(size.X, screen.X-2*x))
+	h := max(100, min(size.Y, screen.Y-y-10))
+	e.Midget.ShowText(x, y, w, h, title, text)
+}
+
+// ShowTiler shows the tile sheet to pick a tile or a brush from,
+// or the sprite sheet to pick a sprite from.
+func (e *Editor) ShowTiler(sprites bool) {
+	if sprites {
+		tiler := e.Midget.Tile(200, 100, e.Map.Sprites.Surface, e.SpriteSelected)
+		tiler.SetCaption("Sprite")
+	} else {
+		tiler := e.Midget.Tile(200, 100, e.Map.Surface, e.TileSelected)
+		tiler.OnRect = e.BrushSelected
+		tiler.SetCaption("Tile")
+	}
+}
+
+// Yank makes the hovered cell the cell to draw with.
+func (e *Editor) Yank() {
+	e.Brush = nil
+	e.Cell = e.Map.Get(e.Tile)
+	e.ShowMessage("Yanked %d %d", e.Cell.Index, e.Cell.Flag)
+}
+
+// ToggleFlagMode toggles drawing only flags.
+func (e *Editor) ToggleFlagMode() {
+	if e.Map != nil {
+		e.Map.Flags = !e.Map.Flags
+	}
+}
+
+// PickLayer makes the layer by delta above the active one active.
+func (e *Editor) PickLayer(delta int) {
+	e.Map.SetActive(e.Map.Active + delta)
+	e.ShowMessage("Layer %s", e.Map.LayerStatus())
+}
+
+func (e *Editor) ToggleLayerHidden() {
+	state := e.Map.State(e.Map.Active)
+	state.Hidden = !state.Hidden
+	e.ShowMessage("Layer %s", e.Map.LayerStatus())
+}
+
+func (e *Editor) ToggleLayerLocked() {
+	state := e.Map.State(e.Map.Active)
+	state.Locked = !state.Locked
+	e.ShowMessage("Layer %s", e.Map.LayerStatus())
+}
+
 func (e *Editor) Restore(doit bool) {
 	if doit {
 		e.Backup.Restore(e.LoadMapFromFile)
@@ -236,8 +667,32 @@ func (e *Editor) SetDone(done bool) {
 	e.Midget.Done = done
 }
 
-func (e Editor) FloodFill(at Point, cell Cell) {
-	e.Map.FloodFill(at, cell)
+func (e *Editor) FloodFill(at Point, cell Cell) {
+	e.History.FloodFill(e.Map, at, cell)
+}
+
+func (e *Editor) Undo() {
+	if name := e.History.Undo(e.Map); name != "" {
+		e.UpdateTilers()
+		e.ShowMessage("Undo %s", name)
+	} else {
+		e.ShowMessage("Nothing to undo")
+	}
+}
+
+func (e *Editor) Redo() {
+	if name := e.History.Redo(e.Map); name != "" {
+		e.UpdateTilers()
+		e.ShowMessage("Redo %s", name)
+	} else {
+		e.ShowMessage("Nothing to redo")
+	}
+}
+
+// IsControlPressed returns true if either control key is pressed.
+func IsControlPressed() bool {
+	return ActiveInput.KeyPressDuration(ebiten.KeyControlLeft) > 0 ||
+		ActiveInput.KeyPressDuration(ebiten.KeyControlRight) > 0
 }
 
 const HELP = `HELP
@@ -247,26 +702,47 @@ Left Shift+Click: Draw image.
 Left Control+Click: Draw flag.
 Left Control+Alt: Flood fill.
 Pause: Exit without save.
+Menu bar: All commands. | F12: Hide/show menu bar.
 F1: This help.          | F2: Save map.
 F3: Show tile selector. | F4: Load map.
 F5: Export as basic.    | P: Edit Prefix.
-F:  Load tile image.    | M: Toggle flag mode.
+F7: VRAM tile report.   | O: Edit Offset.
+F:  Load tile image.    | L: Toggle flag mode.
 H: Horizontal flip      | V: Vertical flip
 Y: Yank hovered tile.   | G: Edit flags.
+PgUp/PgDn: Pick layer.  | A: Add layer.
+I: Hide/show layer.     | K: Lock/unlock layer.
+Ctrl+Z: Undo.           | Ctrl+Y: Redo.
+1: Paint tool.          | 2: Select tool.
+Ctrl+C: Copy selection. | Ctrl+X: Cut selection.
+Ctrl+V: Paste at mouse. | Delete: Clear selection.
+Shift+Ctrl+V: Paste at selection.
+H/V/R: Flip or rotate selection in select tool.
+3: Line tool.           | 4: Rectangle tool.
+5: Filled rectangle.    | 6: Replace all like clicked.
+Shape tools draw flags only with Control or in flag mode.
+Arrows/Middle drag: Pan. | +/-: Zoom. | Home: Top left.
+Middle click: Put presence.
+7: Presence tool, click to choose, drag to move.
+E: Edit chosen presence.| Right click: Edit presence.
+Delete: Remove chosen presence in presence tool.
+W: World view of all maps in the directory of the map.
+   Click a map, then another to link them. Enter: Jump into map.
+F8: Grid.               | F9: Screen boundaries.
+F10: Hidden left column.| F11: HUD rows, Shift+F11: Set them.
+F3+Drag: Pick a brush.  | T: Save brush as stamp.
+Shift+T: Pick stamp.    | F6: Tila console.
+S: UI scale.            | Shift+S: Load theme.
+   Up/Down: Recall command. PgUp/PgDn, wheel: Scroll output.
 Enter: Confirm dialogs. | Esc: Cancel dialogs.
+Click: Focus pane.      | Tab/Shift+Tab: Focus next pane.
+   Only the focused pane gets keys, click the map to give them back.
 `
 
 func (e *Editor) Update() error {
 	var err error
-	e.Hover = image.Pt(ebiten.CursorPosition())
-	e.Tile = e.Map.ToTile(e.Hover, e.Camera)
-
-	_, wheel := ebiten.Wheel()
-	if wheel > 0 {
-		e.Cell.Index++
-	} else if wheel < 0 {
-		e.Cell.Index = max(0, e.Cell.Index-1)
-	}
+	e.Hover = image.Pt(ActiveInput.CursorPosition())
+	e.Tile = e.Map.ToTile(e.Hover.Div(max(MinZoom, e.Zoom)), e.Camera)
 
 	e.UpdateWatcher()
 
@@ -278,84 +754,178 @@ func (e *Editor) Update() error {
 		return err
 	}
 
+	_, wheel := ActiveInput.Wheel()
+	if wheel > 0 {
+		e.Cell.Index++
+	} else if wheel < 0 {
+		e.Cell.Index = max(0, e.Cell.Index-1)
+	}
+
+	// Group everything drawn while a mouse button is held into one undo step.
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) ||
+		ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		e.History.Begin("draw")
+	}
+	if ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) ||
+		ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonRight) {
+		e.History.End()
+	}
+
+	panned := e.UpdateCamera()
+
 	switch {
-	case inpututil.IsKeyJustPressed(ebiten.KeyPause):
-		e.Midget.YesNo(50, 50, 250, 100, "Quit", "Y", e.SetDone)
-	case inpututil.IsKeyJustPressed(ebiten.KeyY):
-		e.Cell = e.Map.Get(e.Tile)
-		e.ShowMessage("Yanked %d %d", e.Cell.Index, e.Cell.Flag)
-	case inpututil.IsKeyJustPressed(ebiten.KeyL):
-		if e.Map != nil {
-			e.Map.Flags = !e.Map.Flags
-		}
-	case inpututil.IsKeyJustPressed(ebiten.KeyH):
+	case e.UpdateTool():
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyZ) && IsControlPressed():
+		e.Undo()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyY) && IsControlPressed():
+		e.Redo()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyC) && IsControlPressed():
+		e.CopySelection()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyX) && IsControlPressed():
+		e.CutSelection()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyV) && IsControlPressed() &&
+		ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0:
+		e.PasteAtSelection()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyV) && IsControlPressed():
+		e.PasteClip()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyDelete) && e.Tool == PresenceTool:
+		e.RemovePresence()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyDelete):
+		e.DeleteSelection()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyE):
+		e.ShowPresencePanel()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyW):
+		e.ShowWorld()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyH) && e.Tool == SelectTool:
+		e.TransformSelection("flip", (*Block).FlipHorizontal)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyV) && e.Tool == SelectTool:
+		e.TransformSelection("flip", (*Block).FlipVertical)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyR) && e.Tool == SelectTool:
+		e.TransformSelection("rotate", (*Block).Rotate)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyEqual):
+		e.SetZoom(e.Zoom + 1)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyMinus):
+		e.SetZoom(e.Zoom - 1)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyHome):
+		e.MoveCamera(Point{})
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyPause):
+		e.AskQuit()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyT):
+		e.AskStamp(ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyY):
+		e.Yank()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyL):
+		e.ToggleFlagMode()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyPageUp):
+		e.PickLayer(1)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyPageDown):
+		e.PickLayer(-1)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyI):
+		e.ToggleLayerHidden()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyK):
+		e.ToggleLayerLocked()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyA):
+		e.AskAddLayer()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyH):
 		e.Cell.Flag ^= FlagHorizontalFlip
-	case inpututil.IsKeyJustPressed(ebiten.KeyV):
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyV):
 		e.Cell.Flag ^= FlagVerticalFlip
-	case inpututil.IsKeyJustPressed(ebiten.KeyN):
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyN):
 		e.Cell.Flag ^= FlagOnTop
-	case inpututil.IsKeyJustPressed(ebiten.KeyB):
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyB):
 		e.Cell.Flag ^= FlagSolid
-	case inpututil.IsKeyJustPressed(ebiten.KeyG):
-		e.Midget.AskText(50, 50, 250, 100, "Flag", &e.Cell.Flag)
-	case inpututil.IsKeyJustPressed(ebiten.KeyF1):
-		e.Midget.Ask(50, 0, 300, 250, HELP, "", Accept)
-	case inpututil.IsKeyJustPressed(ebiten.KeyF2):
-		e.Midget.Ask(50, 50, 250, 100, "Save As", e.Name, e.SaveMap)
-	case inpututil.IsKeyJustPressed(ebiten.KeyF4):
-		e.Midget.Ask(50, 50, 250, 100, "Load From", e.Name, e.LoadMap)
-	case inpututil.IsKeyJustPressed(ebiten.KeyU):
-		if inpututil.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
-			e.Backup.Commit(e.SaveMapToFile)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyG):
+		e.AskFlags()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF1):
+		e.ShowHelp()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF2):
+		e.AskSaveMap()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF4):
+		e.AskLoadMap()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyU):
+		if ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
+			e.CommitBackup()
 		} else {
-			e.Midget.YesNo(50, 50, 250, 100, "Restore backup", "Y", e.Restore)
+			e.AskRestore()
 		}
-	case inpututil.IsKeyJustPressed(ebiten.KeyF):
-		if inpututil.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
-			e.Midget.Ask(50, 50, 250, 100, "Sprites", e.Map.Sprites.From, e.LoadSpriteSurface)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF):
+		if ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
+			e.AskSpriteImage()
 		} else {
-			e.Midget.Ask(50, 50, 250, 100, "From", e.Map.From, e.LoadSurface)
+			e.AskTileImage()
 		}
 
-	case inpututil.IsKeyJustPressed(ebiten.KeyP):
-		e.Midget.AskString(50, 50, 250, 100, "Prefix", &e.Map.Prefix)
-	case inpututil.IsKeyJustPressed(ebiten.KeyO):
-		e.Midget.AskInt(50, 50, 250, 100, "Offset", &e.Map.Offset)
-	case inpututil.IsKeyJustPressed(ebiten.KeyS):
-		e.Midget.AskInt(50, 50, 250, 100, "UI Scale", &e.Scale)
-	case inpututil.IsKeyJustPressed(ebiten.KeyF3):
-		if inpututil.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
-			tiler := e.Midget.Tile(200, 100, e.Map.Sprites.Surface, e.SpriteSelected)
-			tiler.SetCaption("Sprite")
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyP):
+		e.AskPrefix()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyO):
+		e.AskOffset()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyS):
+		if ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
+			e.AskTheme()
 		} else {
-			tiler := e.Midget.Tile(200, 100, e.Map.Surface, e.TileSelected)
-			tiler.SetCaption("Tile")
+			e.AskScale()
 		}
-	case inpututil.IsKeyJustPressed(ebiten.KeyF5):
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF3):
+		e.ShowTiler(ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF5):
 		e.ExportBasic()
-	case inpututil.IsKeyJustPressed(ebiten.KeyF6):
-		e.Midget.AskCommand(10, 10, 300, 250, "Command", e.Commander)
-	case ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft):
-		if inpututil.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
-			e.Map.PutIndex(e.Tile, e.Cell.Index)
-		} else if inpututil.KeyPressDuration(ebiten.KeyControlLeft) > 0 || e.Map.Flags {
-			e.Map.PutFlag(e.Tile, e.Cell.Flag)
-		} else if inpututil.KeyPressDuration(ebiten.KeyAltLeft) > 0 {
-			e.Map.FloodFill(e.Tile, e.Cell)
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF6):
+		e.ShowConsole()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF7):
+		e.ReportVRAM()
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF8):
+		e.Overlays.Grid = !e.Overlays.Grid
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF9):
+		e.Overlays.Screens = !e.Overlays.Screens
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF10):
+		e.Overlays.Border = !e.Overlays.Border
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF11):
+		if ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
+			e.AskHUDRows()
+		} else {
+			e.Overlays.HUD = !e.Overlays.HUD
+		}
+	case ActiveInput.IsKeyJustPressed(ebiten.KeyF12):
+		e.ToggleMenu()
+	case ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) && e.Shape != nil:
+		e.DrawShape()
+	case ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonLeft) && e.Tool.IsShape():
+		e.UpdateShape()
+	case ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && e.Tool == ReplaceTool:
+		e.History.Replace(e.Map, e.Map.Get(e.Tile), e.Cell, e.IsFlagsOnly())
+	case ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonRight) && e.Tool == PresenceTool:
+		e.Chosen = e.Map.PresenceAt(e.MapMouse())
+		e.ShowPresencePanel()
+	case e.Tool == PresenceTool && (ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonLeft) ||
+		ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft)):
+		e.UpdatePresence()
+	case ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonLeft) && e.Tool == SelectTool:
+		e.UpdateSelection()
+	case ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonRight) && e.Tool == SelectTool:
+		e.Selection = Rectangle{}
+	case ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonLeft) && e.Tool == PaintTool:
+		if ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
+			e.History.PutIndex(e.Map, e.Tile, e.Cell.Index)
+		} else if e.IsFlagsOnly() {
+			e.History.PutFlag(e.Map, e.Tile, e.Cell.Flag)
+		} else if ActiveInput.KeyPressDuration(ebiten.KeyAltLeft) > 0 {
+			e.FloodFill(e.Tile, e.Cell)
+		} else if e.Brush != nil {
+			e.History.Paste(e.Map, e.Tile, e.Brush)
 		} else {
-			e.Map.Put(e.Tile, e.Cell)
+			e.History.Put(e.Map, e.Tile, e.Cell)
 		}
-	case ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight):
-		if inpututil.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
-			e.Map.PutIndex(e.Tile, 0)
-		} else if inpututil.KeyPressDuration(ebiten.KeyControlLeft) > 0 || e.Map.Flags {
-			e.Map.PutFlag(e.Tile, 0)
+	case ActiveInput.IsMouseButtonPressed(ebiten.MouseButtonRight) && e.Tool == PaintTool:
+		if ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) > 0 {
+			e.History.PutIndex(e.Map, e.Tile, 0)
+		} else if ActiveInput.KeyPressDuration(ebiten.KeyControlLeft) > 0 || e.Map.Flags {
+			e.History.PutFlag(e.Map, e.Tile, 0)
 		} else {
 			zero := Cell{}
-			e.Map.Put(e.Tile, zero)
+			e.History.Put(e.Map, e.Tile, zero)
 		}
-	case ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle):
-		e.Map.PutPresence(e.Tile, e.Presence)
+	case ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonMiddle) && !panned:
+		e.PutPresence()
 	default:
 	}
 
@@ -365,41 +935,19 @@ func (e *Editor) Update() error {
 	return nil
 }
 
-func (e *Editor) Wrap(t *Tila, args ...any) any {
-	if dx, err := TilaArg[int](args); err != nil {
-		return err
-	} else {
-		if e.Map != nil {
-			e.Map.Wrap(dx)
-			return dx
-		}
-		return false
-	}
-}
-
-func (e *Editor) Roll(t *Tila, args ...any) any {
-	if dx, err := TilaArg[int](args); err != nil {
-		return err
-	} else {
-		if e.Map != nil {
-			e.Map.Roll(dx)
-			return dx
-		}
-		return false
-	}
-}
-
-func (e *Editor) CommandHelp(t *Tila, args ...any) any {
-	return "available commands: get, set, wrap, roll, help"
-}
-
 func NewEditor(tm *Map, name string, w, h, scale int) *Editor {
 
-	e := &Editor{Map: tm, Name: name, Camera: image.Rect(0, 0, w, h),
-		Scale:  scale,
-		Midget: MakeMidget(image.Rect(0, 0, 0, 0)),
+	e := &Editor{Map: tm, Name: name, Size: image.Pt(w, h),
+		Scale:    scale,
+		Zoom:     MinZoom,
+		Midget:   MakeMidget(image.Rect(0, 0, 0, 0)),
+		VRAM:     DefaultVRAM(),
+		Overlays: DefaultOverlays(),
+		Chosen:   -1,
 	}
 	e.Midget.Lock = true
+	e.Saved = SavedMap(tm)
+	e.MoveCamera(Point{})
 	if tm.From != "" {
 		e.TileWatcher = Watch(tm.From)
 	}
@@ -407,13 +955,26 @@ func NewEditor(tm *Map, name string, w, h, scale int) *Editor {
 		e.SpriteWatcher = Watch(tm.Sprites.From)
 	}
 	e.Backup.Pattern = "masite*.xml"
-	e.Commander = NewTila()
-	e.Commander.Commands["get"] = (*Tila).Get
-	e.Commander.Operators["$"] = (*Tila).Get
-	e.Commander.Commands["set"] = (*Tila).Set
-	e.Commander.Commands["wrap"] = e.Wrap
-	e.Commander.Commands["roll"] = e.Roll
-	e.Commander.Commands["help"] = e.CommandHelp
+	e.Commander = NewMapTila(MapBinding{
+		Map: func() *Map { return e.Map },
+		Load: func(name string) error {
+			e.LoadMap(name)
+			return e.Error
+		},
+		Save: func(name string) error {
+			e.SaveMap(name)
+			return e.Error
+		},
+		Change:    func(name string, op func() error) error { return e.History.Try(e.Map, name, op) },
+		Selection: &e.Selection,
+	})
+	e.Console = NewConsole(Bounds(10, 10, 400, 250), "Command", e.Commander)
+	e.Console.Batch = func(name string, op func()) {
+		e.History.Batch(func() *Map { return e.Map }, name, op)
+	}
+	e.Menu = NewMenuBar(Point{}, e.EditorMenus())
+	e.Menu.Build = e.EditorMenus
+	e.Midget.Add(e.Menu)
 
 	return e
 }
@@ -0,0 +1,129 @@
+//go:build !headless
+
+package masite
+
+import (
+	"slices"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Widget is a kid that can be focused and clicked, which every type that
+// embeds a Midget is.
+type Widget interface {
+	Game
+	Base() *Midget
+	Contains(at Point) bool
+}
+
+var _ Widget = &Midget{}
+
+// Base returns the midget itself, for the types that embed it.
+func (m *Midget) Base() *Midget {
+	return m
+}
+
+// Contains returns true if clicking at the point clicks on the midget.
+func (m *Midget) Contains(at Point) bool {
+	return !m.Hidden && at.In(m.Bounds)
+}
+
+// KidAt returns the top kid at the point, or nil if none.
+func (m *Midget) KidAt(at Point) Game {
+	for _, kid := range m.Kids {
+		if w, ok := kid.(Widget); ok && w.Contains(at) {
+			return kid
+		}
+	}
+	return nil
+}
+
+// ModalKid returns the top modal kid, or nil if none.
+func (m *Midget) ModalKid() Game {
+	for _, kid := range m.Kids {
+		if w, ok := kid.(Widget); ok && w.Base().Modal && !w.Base().Hidden {
+			return kid
+		}
+	}
+	return nil
+}
+
+// Raise moves a kid to the top, so it is drawn over the others.
+func (m *Midget) Raise(g Game) {
+	if i := slices.Index(m.Kids, g); i > 0 {
+		m.Kids = slices.Insert(slices.Delete(m.Kids, i, i+1), 0, g)
+	}
+}
+
+// FocusOn focuses a kid and raises it, or focuses the midget itself if g
+// is nil. The focus before is kept in Prior.
+func (m *Midget) FocusOn(g Game) {
+	if g != nil {
+		m.Raise(g)
+	}
+	if g == m.Focus {
+		return
+	}
+	m.Prior = slices.DeleteFunc(m.Prior, func(kid Game) bool { return kid == g || kid == m.Focus })
+	m.Prior = append(m.Prior, m.Focus)
+	m.Focus = g
+}
+
+// Remove removes a kid, and gives the focus back to the one focused
+// before it. The mouse stays captured until it is released, so the click
+// that closed the kid does not reach what is behind it.
+func (m *Midget) Remove(g Game) {
+	m.Kids = slices.DeleteFunc(m.Kids, func(kid Game) bool { return kid == g })
+	m.Prior = slices.DeleteFunc(m.Prior, func(kid Game) bool { return kid == g })
+	if m.Focus != g {
+		return
+	}
+	m.Focus = nil
+	if n := len(m.Prior); n > 0 {
+		m.Focus = m.Prior[n-1]
+		m.Prior = m.Prior[:n-1]
+	}
+	if m.Focus != nil {
+		m.Raise(m.Focus)
+	}
+}
+
+// Cycle focuses the kid at the bottom, which goes to the top, or if
+// forward is false, lowers the top kid to the bottom and focuses the
+// next one. Hidden kids are skipped.
+func (m *Midget) Cycle(forward bool) {
+	for i := range m.Kids {
+		if i > 0 || m.Focus != nil {
+			if forward {
+				last := m.Kids[len(m.Kids)-1]
+				m.Kids = slices.Insert(m.Kids[:len(m.Kids)-1], 0, last)
+			} else {
+				m.Kids = append(m.Kids[1:], m.Kids[0])
+			}
+		}
+		if w, ok := m.Kids[0].(Widget); ok && !w.Base().Hidden {
+			m.FocusOn(m.Kids[0])
+			return
+		}
+	}
+}
+
+// MouseButtons are the buttons that focus the kid they are pressed on.
+var MouseButtons = []ebiten.MouseButton{
+	ebiten.MouseButtonLeft, ebiten.MouseButtonRight, ebiten.MouseButtonMiddle,
+}
+
+// IsMouseJustPressed returns true if any of the MouseButtons was just pressed.
+func IsMouseJustPressed() bool {
+	return slices.ContainsFunc(MouseButtons, ActiveInput.IsMouseButtonJustPressed)
+}
+
+// IsMouseHeld returns true if any of the MouseButtons is pressed, or was
+// just released.
+func IsMouseHeld() bool {
+	return slices.ContainsFunc(MouseButtons, func(b ebiten.MouseButton) bool {
+		return ActiveInput.IsMouseButtonPressed(b) || ActiveInput.IsMouseButtonJustReleased(b)
+	})
+}
@@ -0,0 +1,131 @@
+//go:build !headless
+
+package masite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"golang.org/x/image/font/basicfont"
+)
+
+// Font draws and measures the text of midgets, with a bitmap font.
+// Text is drawn in the logical screen of the editor, so it scales with
+// Editor.Scale like the rest of the UI, and stays sharp.
+type Font struct {
+	Face   text.Face
+	Height int // Height of a line.
+}
+
+// NewFont makes a Font of a bitmap font face.
+func NewFont(face *basicfont.Face) *Font {
+	return &Font{Face: text.NewGoXFace(face), Height: face.Height + 1}
+}
+
+// DefaultFont is the font of the midgets that do not set another one,
+// the public domain 7x13 font of golang.org/x/image.
+var DefaultFont = NewFont(basicfont.Face7x13)
+
+// LoadFont loads a bitmap font from an image of the characters from space
+// to DEL in cells of w by h pixels, left to right and top to bottom, like
+// the font tiles 32 to 127 of CVBasic. The colour of the top left pixel,
+// which is in the space, is the paper, any other colour is ink.
+func LoadFont(cb func() (io.ReadCloser, error), w, h int) (*Font, error) {
+	rd, err := cb()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	img, _, err := image.Decode(rd)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	cols := bounds.Dx() / w
+	count := min(cols*(bounds.Dy()/h), 0x7f-' '+1)
+	if count < 1 {
+		return nil, errors.New("font image is smaller than a character")
+	}
+	paper := color.RGBAModel.Convert(img.At(bounds.Min.X, bounds.Min.Y))
+	mask := image.NewAlpha(image.Rect(0, 0, w, count*h))
+	for i := range count {
+		at := bounds.Min.Add(image.Pt(i%cols*w, i/cols*h))
+		for y := range h {
+			for x := range w {
+				ink := color.RGBAModel.Convert(img.At(at.X+x, at.Y+y))
+				if ink.(color.RGBA).A != 0 && ink != paper {
+					mask.SetAlpha(x, i*h+y, color.Alpha{A: 0xff})
+				}
+			}
+		}
+	}
+	face := &basicfont.Face{Advance: w, Width: w, Height: h, Ascent: h, Mask: mask,
+		Ranges: []basicfont.Range{{Low: ' ', High: ' ' + rune(count)}}}
+	return NewFont(face), nil
+}
+
+// Draw draws text with its top left at x, y. Lines are separated by \n.
+func (f *Font) Draw(s *Surface, str string, x, y int, col Color) {
+	opts := text.DrawOptions{}
+	opts.GeoM.Translate(float64(x), float64(y))
+	opts.ColorScale.ScaleWithColor(col)
+	opts.LineSpacing = float64(f.Height)
+	text.Draw(s, str, f.Face, &opts)
+}
+
+// Advance returns the width of a line of text in pixels.
+func (f *Font) Advance(line string) int {
+	return int(math.Ceil(text.Advance(line, f.Face)))
+}
+
+// Measure returns the size of text in pixels.
+func (f *Font) Measure(str string) Point {
+	lines := strings.Split(str, "\n")
+	size := image.Pt(0, len(lines)*f.Height)
+	for _, line := range lines {
+		size.X = max(size.X, f.Advance(line))
+	}
+	return size
+}
+
+// Wrap breaks text into lines that fit in width, between words where it
+// can, and in words that are too wide. Newlines and indentation are kept.
+func (f *Font) Wrap(str string, width int) []string {
+	lines := []string{}
+	for _, para := range strings.Split(str, "\n") {
+		words := strings.Split(para, " ")
+		line := words[0]
+		for _, word := range words[1:] {
+			if f.Advance(line+" "+word) <= width || strings.TrimSpace(line) == "" {
+				line += " " + word
+				continue
+			}
+			lines = append(lines, f.breakWord(line, width)...)
+			line = word
+		}
+		lines = append(lines, f.breakWord(line, width)...)
+	}
+	return lines
+}
+
+// breakWord breaks a word that is wider than width into lines.
+func (f *Font) breakWord(word string, width int) []string {
+	lines := []string{}
+	runes := []rune(word)
+	for len(runes) > 1 && f.Advance(string(runes)) > width {
+		n := 1
+		for n < len(runes)-1 && f.Advance(string(runes[:n+1])) <= width {
+			n++
+		}
+		lines = append(lines, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return append(lines, string(runes))
+}
@@ -0,0 +1,51 @@
+//go:build !headless
+
+package masite
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The default font is 7 pixels wide, so 35 pixels fit 5 characters.
+
+func TestFontWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"", 35, []string{""}},
+		{"ab cd", 35, []string{"ab cd"}},
+		{"ab cd ef", 35, []string{"ab cd", "ef"}},
+		{"ab\ncd ef", 35, []string{"ab", "cd ef"}},
+		{"abcdefghijkl", 35, []string{"abcde", "fghij", "kl"}},
+		{"ab cdefghij", 35, []string{"ab", "cdefg", "hij"}},
+		{"  ab cd", 35, []string{"  ab", "cd"}},
+	}
+	for _, tt := range tests {
+		if got := DefaultFont.Wrap(tt.text, tt.width); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Wrap(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestFontBreakWord(t *testing.T) {
+	tests := []struct {
+		word  string
+		width int
+		want  []string
+	}{
+		{"abc", 35, []string{"abc"}},
+		{"abcde", 35, []string{"abcde"}},
+		{"abcdefg", 35, []string{"abcde", "fg"}},
+		{"ab", 0, []string{"a", "b"}},
+		{"a", 0, []string{"a"}},
+		{"", 35, []string{""}},
+	}
+	for _, tt := range tests {
+		if got := DefaultFont.breakWord(tt.word, tt.width); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("breakWord(%q, %d) = %q, want %q", tt.word, tt.width, got, tt.want)
+		}
+	}
+}
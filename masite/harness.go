@@ -0,0 +1,92 @@
+//go:build !headless
+
+package masite
+
+import (
+	"image/color"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Harness runs a game without a window, for tests. It makes a FakeInput
+// the ActiveInput, and draws every frame to an offscreen Screen the size
+// of the layout of the game.
+//
+// Reading pixels of the Screen needs a running ebiten game, so tests that
+// do so run inside one, see ebiten.RunGame.
+type Harness struct {
+	Game   Game
+	Input  *FakeInput
+	Screen *Surface
+	Frames int // Frames run so far.
+}
+
+// NewHarness returns a harness for a game in a window of w by h pixels.
+// Close it to give the input back to ebiten.
+func NewHarness(game Game, w, h int) *Harness {
+	lw, lh := game.Layout(w, h)
+	harness := &Harness{Game: game, Input: NewFakeInput(), Screen: ebiten.NewImage(lw, lh)}
+	ActiveInput = harness.Input
+	return harness
+}
+
+// Close makes ebiten the ActiveInput again.
+func (h *Harness) Close() {
+	ActiveInput = EbitenInput{}
+}
+
+// Frame updates the game, draws it on the Screen, and moves the input to
+// the next frame.
+func (h *Harness) Frame() error {
+	err := h.Game.Update()
+	h.Screen.Clear()
+	h.Game.Draw(h.Screen)
+	h.Input.Tick()
+	h.Frames++
+	return err
+}
+
+// Run runs n frames, or until a frame returns an error.
+func (h *Harness) Run(n int) error {
+	for range n {
+		if err := h.Frame(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tap presses keys for a frame, then releases them for a frame.
+func (h *Harness) Tap(keys ...Key) error {
+	h.Input.Press(keys...)
+	if err := h.Frame(); err != nil {
+		return err
+	}
+	h.Input.Release(keys...)
+	return h.Frame()
+}
+
+// Type types text in one frame.
+func (h *Harness) Type(text string) error {
+	h.Input.Type(text)
+	return h.Frame()
+}
+
+// Click presses a mouse button at the point for a frame, then releases it
+// for a frame.
+func (h *Harness) Click(button MouseButton, at Point) error {
+	h.Input.PressMouse(button, at)
+	if err := h.Frame(); err != nil {
+		return err
+	}
+	h.Input.ReleaseMouse(button)
+	return h.Frame()
+}
+
+// Pixel returns the colour of the Screen at x, y, as drawn by the last
+// frame.
+func (h *Harness) Pixel(x, y int) RGBA {
+	return color.RGBAModel.Convert(h.Screen.At(x, y)).(RGBA)
+}
@@ -0,0 +1,458 @@
+//go:build !headless
+
+package masite
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var graphics = flag.Bool("graphics", true, "run the tests in an ebiten game, so they can draw and read pixels")
+
+// testGame runs the tests inside an ebiten game, so images can be drawn
+// and their pixels read.
+type testGame struct {
+	m    *testing.M
+	code int
+}
+
+func (g *testGame) Update() error {
+	g.code = g.m.Run()
+	return ebiten.Termination
+}
+
+func (g *testGame) Draw(*Surface) {}
+
+func (g *testGame) Layout(int, int) (int, int) {
+	return 320, 240
+}
+
+// TestMain runs the tests inside an ebiten game, or without one with
+// -graphics=false, such as on a server without a display. Images can then
+// be drawn, but their pixels can not be read, so those checks are skipped.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !*graphics {
+		os.Exit(m.Run())
+	}
+	g := &testGame{m: m, code: 1}
+	if err := ebiten.RunGame(g); err != nil {
+		fmt.Fprintf(os.Stderr, "masite: %v, run the tests with -graphics=false if there is no display\n", err)
+		os.Exit(1)
+	}
+	os.Exit(g.code)
+}
+
+var (
+	testPaper = RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff}
+	testInk   = RGBA{R: 0xff, G: 0x00, B: 0x00, A: 0xff}
+)
+
+// newTestEditor returns an editor of a 40x30 map in a temporary directory,
+// with tiles of black, the index 0, and red, the index 1, at a zoom of 1
+// in a 640x480 window, and a harness to run it.
+func newTestEditor(t *testing.T) (*Editor, *Harness) {
+	t.Helper()
+	dir := t.TempDir()
+	tiles := image.NewRGBA(image.Rect(0, 0, 2*TW, TH))
+	for y := range TH {
+		for x := range 2 * TW {
+			tiles.Set(x, y, testPaper)
+			if x >= TW {
+				tiles.Set(x, y, testInk)
+			}
+		}
+	}
+	from := filepath.Join(dir, "tiles.png")
+	f, err := os.Create(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, tiles); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tm, err := NewMap(40, 30, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor(tm, filepath.Join(dir, "first.xml"), 640, 480, 1)
+	h := NewHarness(e, 640, 480)
+	t.Cleanup(func() {
+		h.Close()
+		if e.TileWatcher != nil {
+			e.TileWatcher.Done <- struct{}{}
+		}
+	})
+	return e, h
+}
+
+// tileCenter returns the centre of a tile on the screen.
+func tileCenter(e *Editor, tile Point) Point {
+	return image.Pt(tile.X*e.Map.Tw+e.Map.Tw/2, tile.Y*e.Map.Th+e.Map.Th/2).Mul(e.Zoom)
+}
+
+func TestFakeInput(t *testing.T) {
+	in := NewFakeInput()
+	in.Press(ebiten.KeyA)
+	in.Type("a")
+	if !in.IsKeyJustPressed(ebiten.KeyA) || !in.IsKeyPressed(ebiten.KeyA) {
+		t.Errorf("A is not just pressed")
+	}
+	if keys := in.AppendJustPressedKeys(nil); len(keys) != 1 || keys[0] != ebiten.KeyA {
+		t.Errorf("just pressed keys %v, want [A]", keys)
+	}
+	in.Tick()
+	if in.IsKeyJustPressed(ebiten.KeyA) || in.KeyPressDuration(ebiten.KeyA) != 2 {
+		t.Errorf("A is just pressed, or held %d frames, want 2", in.KeyPressDuration(ebiten.KeyA))
+	}
+	if chars := in.AppendInputChars(nil); len(chars) != 0 {
+		t.Errorf("chars %q are still typed", string(chars))
+	}
+	in.Release(ebiten.KeyA)
+	if in.IsKeyPressed(ebiten.KeyA) {
+		t.Errorf("A is still pressed")
+	}
+
+	in.PressMouse(ebiten.MouseButtonLeft, image.Pt(3, 4))
+	if x, y := in.CursorPosition(); !in.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) || x != 3 || y != 4 {
+		t.Errorf("left button not just pressed at 3,4")
+	}
+	in.ReleaseMouse(ebiten.MouseButtonLeft)
+	if !in.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+		t.Errorf("left button not just released")
+	}
+	in.Tick()
+	if in.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+		t.Errorf("left button still just released")
+	}
+}
+
+// TestEditorPaintAndSave paints a tile, then saves the map with F2, by
+// typing a name in the picker and pressing Enter.
+func TestEditorPaintAndSave(t *testing.T) {
+	e, h := newTestEditor(t)
+	tile := image.Pt(10, 20)
+	at := tileCenter(e, tile)
+	e.Cell.Index = 1
+	if err := h.Click(ebiten.MouseButtonLeft, at); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Map.Get(tile).Index; got != 1 {
+		t.Fatalf("painted tile index %d, want 1", got)
+	}
+
+	h.Input.Cursor = image.Pt(600, 460) // so the cursor is not drawn on the tile.
+	if err := h.Frame(); err != nil {
+		t.Fatal(err)
+	}
+	if *graphics {
+		if got := h.Pixel(at.X, at.Y); got != testInk {
+			t.Errorf("painted tile drawn as %v, want %v", got, testInk)
+		}
+		if got := h.Pixel(at.X+TW, at.Y); got != testPaper {
+			t.Errorf("next tile drawn as %v, want %v", got, testPaper)
+		}
+	}
+
+	if err := h.Tap(ebiten.KeyF2); err != nil {
+		t.Fatal(err)
+	}
+	picker, ok := e.Midget.Focus.(*Picker)
+	if !ok {
+		t.Fatalf("F2 focused %T, want a *Picker", e.Midget.Focus)
+	}
+	if got := string(picker.Filter); got != "first.xml" {
+		t.Errorf("picker starts with %q, want first.xml", got)
+	}
+	if *graphics {
+		inside := picker.ListBounds().Min.Add(image.Pt(PickerListWidth-10, 10))
+		if got := h.Pixel(inside.X, inside.Y); got == testPaper {
+			t.Errorf("picker not drawn at %v", inside)
+		}
+	}
+
+	for range picker.Filter {
+		if err := h.Tap(ebiten.KeyBackspace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Type("level"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Tap(ebiten.KeyEnter); err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(filepath.Dir(e.Map.From), "level.xml")
+	if e.Name != want {
+		t.Errorf("saved as %q, want %q", e.Name, want)
+	}
+	if e.Midget.Focus != nil || len(e.Midget.Kids) != 1 {
+		t.Errorf("picker not closed, focus on %T", e.Midget.Focus)
+	}
+	saved, err := LoadMap(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Get(tile).Index; got != 1 {
+		t.Errorf("saved tile index %d, want 1", got)
+	}
+	if saved.Width != 40 || saved.Height != 30 {
+		t.Errorf("saved map is %dx%d, want 40x30", saved.Width, saved.Height)
+	}
+}
+
+// TestPickerOpener types in a picker while the key that opened it is held,
+// which is not typed, and after it is released.
+func TestPickerOpener(t *testing.T) {
+	e, h := newTestEditor(t)
+	h.Input.Press(ebiten.KeyF2)
+	if err := h.Frame(); err != nil {
+		t.Fatal(err)
+	}
+	picker, ok := e.Midget.Focus.(*Picker)
+	if !ok {
+		t.Fatalf("F2 focused %T, want a *Picker", e.Midget.Focus)
+	}
+	if err := h.Type("x"); err != nil {
+		t.Fatal(err)
+	}
+	h.Input.Release(ebiten.KeyF2)
+	if err := h.Type("y"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(picker.Filter); got != "first.xmly" {
+		t.Errorf("filter %q, want first.xmly", got)
+	}
+}
+
+// TestMenuBarCommand picks Grid in the View menu with the mouse.
+func TestMenuBarCommand(t *testing.T) {
+	e, h := newTestEditor(t)
+	grid := e.Overlays.Grid
+	view := -1
+	for i, menu := range e.Menu.Menus {
+		if menu.Title == "View" {
+			view = i
+		}
+	}
+	title := e.Menu.TitleBounds(view)
+	if err := h.Click(ebiten.MouseButtonLeft, title.Min.Add(image.Pt(4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	if e.Menu.Drop == nil || e.Menu.Open != view {
+		t.Fatalf("View menu not open")
+	}
+	index := -1
+	for i, item := range e.Menu.Menus[view].Items {
+		if item.Keys == "F8" {
+			index = i
+		}
+	}
+	height := e.Menu.Drop.Style.RowHeight()
+	row := e.Menu.Drop.Inner().Min.Add(image.Pt(4, index*height+height/2))
+	if err := h.Click(ebiten.MouseButtonLeft, row); err != nil {
+		t.Fatal(err)
+	}
+	if e.Overlays.Grid == grid {
+		t.Errorf("grid not toggled")
+	}
+	if e.Menu.Drop != nil {
+		t.Errorf("menu still open")
+	}
+}
+
+// TestWorldViewUnsavedMap opens the world view on a map that is not saved
+// yet, and presses Delete, which has no map to remove an exit of.
+func TestWorldViewUnsavedMap(t *testing.T) {
+	e, h := newTestEditor(t)
+	if err := h.Tap(ebiten.KeyW); err != nil {
+		t.Fatal(err)
+	}
+	view, ok := e.Midget.Focus.(*WorldView)
+	if !ok {
+		t.Fatalf("W focused %T, want a *WorldView", e.Midget.Focus)
+	}
+	if view.Chosen != "" {
+		t.Errorf("chose %q, which is not saved", view.Chosen)
+	}
+	if err := h.Tap(ebiten.KeyDelete); err != nil {
+		t.Fatal(err)
+	}
+	if e.Midget.Focus != Game(view) {
+		t.Errorf("Delete focused %T", e.Midget.Focus)
+	}
+}
+
+// TestConfirmLoadMap loads a map over a modified one only when allowed.
+func TestConfirmLoadMap(t *testing.T) {
+	e, h := newTestEditor(t)
+	name := filepath.Join(filepath.Dir(e.Map.From), "other.xml")
+	if !e.SaveMap(name) {
+		t.Fatal(e.Error)
+	}
+	e.History.Put(e.Map, image.Pt(1, 1), Cell{Index: 1})
+	if !e.Modified() {
+		t.Fatalf("map not modified after a put")
+	}
+	e.ConfirmLoadMap(name)
+	if _, ok := e.Midget.Focus.(*Asker); !ok {
+		t.Fatalf("modified map loaded without asking, focus on %T", e.Midget.Focus)
+	}
+	if err := h.Tap(ebiten.KeyEnter); err != nil { // Y is the default.
+		t.Fatal(err)
+	}
+	if e.Map.Get(image.Pt(1, 1)).Index != 0 || e.Modified() {
+		t.Errorf("map not loaded after confirming")
+	}
+}
+
+// TestModifiedHeader counts changes of the header of the map as
+// modifications, but not the state of the layers, which is not saved.
+func TestModifiedHeader(t *testing.T) {
+	e, _ := newTestEditor(t)
+	e.Map.Base.Hidden = true
+	if e.Modified() {
+		t.Errorf("map modified after hiding the base layer")
+	}
+	e.History.Change(e.Map, "exits", func() { e.Map.Exits.North = Exit{Name: "north"} })
+	if !e.Modified() {
+		t.Errorf("map not modified after an exit edit")
+	}
+	e.Undo()
+	if e.Modified() {
+		t.Errorf("map modified after undoing the exit edit")
+	}
+	e.Map.Music = 2
+	if !e.Modified() {
+		t.Errorf("map not modified after a header edit")
+	}
+}
+
+// TestPasteAtSelection pastes at the start of the selection with
+// Shift+Ctrl+V, as the menu says.
+func TestPasteAtSelection(t *testing.T) {
+	e, h := newTestEditor(t)
+	e.Clip = &Block{Width: 1, Height: 1, Rows: []Row{{Cells: []Cell{{Index: 3}}}}}
+	e.Selection = Bounds(2, 1, 2, 2)
+	if err := h.Tap(ebiten.KeyControlLeft, ebiten.KeyShiftLeft, ebiten.KeyV); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Map.Get(image.Pt(2, 1)).Index; got != 3 {
+		t.Errorf("pasted %d at the selection, want 3", got)
+	}
+}
+
+// TestAskTheme opens the theme picker with Shift+S.
+func TestAskTheme(t *testing.T) {
+	e, h := newTestEditor(t)
+	if err := h.Tap(ebiten.KeyShiftLeft, ebiten.KeyS); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Midget.Focus.(*Picker); !ok {
+		t.Errorf("Shift+S focused %T, want a *Picker", e.Midget.Focus)
+	}
+}
+
+// TestPresencePanelGone edits a field of a presence that is removed while
+// the editor asks for the value.
+func TestPresencePanelGone(t *testing.T) {
+	e, _ := newTestEditor(t)
+	e.Map.Presences = append(e.Map.Presences, Presence{})
+	e.Chosen = 0
+	e.ShowPresencePanel()
+	panel, ok := e.Midget.Focus.(*PresencePanel)
+	if !ok {
+		t.Fatalf("no presence panel shown")
+	}
+	index := -1
+	for i, field := range PresenceFields {
+		if field.Name == "frames" {
+			index = i
+		}
+	}
+	panel.Edit(index)
+	ask, ok := e.Midget.Focus.(*Asker)
+	if !ok {
+		t.Fatalf("editing a field asks nothing")
+	}
+	e.History.RemovePresence(e.Map, 0)
+	if ask.On("3") {
+		t.Errorf("edited a removed presence")
+	}
+	if _, ok := e.Midget.Focus.(*Asker); !ok || len(e.History.Done) != 1 {
+		t.Errorf("no error shown, or the failed edit can be undone")
+	}
+}
+
+// TestRunStartup runs the startup script in the directory of the map,
+// not in the working directory.
+func TestRunStartup(t *testing.T) {
+	e, _ := newTestEditor(t)
+	script := filepath.Join(filepath.Dir(e.Name), StartupScript)
+	if err := os.WriteFile(script, []byte("prefix startup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !e.RunStartup() || e.Map.Prefix != "startup" {
+		t.Errorf("startup script not run, prefix %q", e.Map.Prefix)
+	}
+}
+
+// TestListRowHeight finds the items of a list with a tall font.
+func TestListRowHeight(t *testing.T) {
+	l := NewList(Bounds(0, 0, 100, 200), []string{"a", "b", "c"}, nil)
+	l.Style.Font = &Font{Face: l.Style.Font.Face, Height: 30}
+	l.Style.Padding = 2
+	if got := l.Style.RowHeight(); got != 32 {
+		t.Errorf("row height %d, want 32", got)
+	}
+	if got := l.ItemAt(image.Pt(5, 40)); got != 1 {
+		t.Errorf("item %d at y 40, want 1", got)
+	}
+	if got := l.Shown(); got != 6 {
+		t.Errorf("%d items shown, want 6", got)
+	}
+}
+
+// TestPickStamp saves two stamps, and picks the second from the list
+// Shift+T shows.
+func TestPickStamp(t *testing.T) {
+	e, h := newTestEditor(t)
+	for i, name := range []string{"one", "two"} {
+		e.Brush = NewBlock(i+1, 1)
+		if !e.SaveStamp(name) {
+			t.Fatalf("stamp %s not saved: %v", name, e.Error)
+		}
+	}
+	e.Brush = nil
+	if err := h.Tap(ebiten.KeyShiftLeft, ebiten.KeyT); err != nil {
+		t.Fatal(err)
+	}
+	list, ok := e.Midget.Focus.(*List)
+	if !ok {
+		t.Fatalf("Shift+T focused %T, want a *List", e.Midget.Focus)
+	}
+	if len(list.Items) != 2 {
+		t.Fatalf("stamps listed %q, want one and two", list.Items)
+	}
+	list.Select(slices.Index(list.Items, "two"))
+	if err := h.Tap(ebiten.KeyEnter); err != nil {
+		t.Fatal(err)
+	}
+	if e.Brush == nil || e.Brush.Width != 2 {
+		t.Errorf("brush %v, want the stamp two", e.Brush)
+	}
+}
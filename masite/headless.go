@@ -0,0 +1,20 @@
+//go:build headless
+
+package masite
+
+// Built with the headless tag, masite has no editor and does not use
+// ebiten, so programs that read, script and export maps, such as tila and
+// the subcommands of masite, build and run without a display:
+//
+//	go build -tags headless ./cmd/tila
+
+// Surface stands in for the ebiten image of the tiles and sprites of a
+// map, which is never drawn without a display, and keeps the image.
+type Surface struct {
+	Image
+}
+
+// NewSurface returns a surface with the image.
+func NewSurface(img Image) *Surface {
+	return &Surface{Image: img}
+}
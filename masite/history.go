@@ -0,0 +1,349 @@
+package masite
+
+import (
+	"image"
+	"reflect"
+	"slices"
+)
+
+// Edit is a change of a single cell in a layer of a map. The layer is
+// recorded by name, so the edit still applies after layers are removed
+// or reordered.
+type Edit struct {
+	Layer  string
+	At     Point
+	Before Cell
+	After  Cell
+}
+
+// Snapshot is a copy of the header and the contents of a map,
+// for changes that affect the whole map.
+type Snapshot struct {
+	Width     int
+	Height    int
+	Tw        int
+	Th        int
+	Offset    int
+	From      string
+	Prefix    string
+	Number    int
+	Border    int
+	Music     int
+	Scroll    Scroll
+	Sprites   Sprites
+	Exits     Exits
+	Collision bool
+	Rows      []Row
+	Layers    []Layer
+	Presences []Presence
+}
+
+// TakeSnapshot makes a deep copy of the header and the contents of the map.
+// The surfaces are not copied, they are loaded again when restoring.
+func (m *Map) TakeSnapshot() *Snapshot {
+	s := &Snapshot{Width: m.Width, Height: m.Height, Tw: m.Tw, Th: m.Th,
+		Offset: m.Offset, From: m.From, Prefix: m.Prefix, Number: m.Number,
+		Border: m.Border, Music: m.Music, Scroll: m.Scroll, Sprites: m.Sprites,
+		Exits: m.Exits, Collision: m.Collision}
+	s.Sprites.Surface = nil
+	s.Rows = CloneRows(m.Rows)
+	s.Layers = slices.Clone(m.Layers)
+	for i := range s.Layers {
+		s.Layers[i].Rows = CloneRows(s.Layers[i].Rows)
+	}
+	s.Presences = slices.Clone(m.Presences)
+	return s
+}
+
+// RestoreSnapshot restores the header and the contents of the map from the snapshot.
+// The state of the layers in the editor is kept if possible. The images of
+// the tiles and sprites are loaded again if they come from another file,
+// if that fails the old images are kept.
+func (m *Map) RestoreSnapshot(s *Snapshot) {
+	states := map[string]LayerState{}
+	for _, layer := range m.Layers {
+		states[layer.Name] = layer.LayerState
+	}
+	from, sprites := m.From, m.Sprites
+	m.Width = s.Width
+	m.Height = s.Height
+	m.Tw = s.Tw
+	m.Th = s.Th
+	m.Offset = s.Offset
+	m.From = s.From
+	m.Prefix = s.Prefix
+	m.Number = s.Number
+	m.Border = s.Border
+	m.Music = s.Music
+	m.Scroll = s.Scroll
+	m.Sprites = s.Sprites
+	m.Exits = s.Exits
+	m.Collision = s.Collision
+	m.Sprites.Surface = sprites.Surface
+	if m.From != from {
+		m.LoadSurface(m.From)
+	}
+	if m.Sprites.From != sprites.From {
+		m.Sprites.LoadSurface(m.Sprites.From)
+	}
+	m.Rows = CloneRows(s.Rows)
+	m.Layers = slices.Clone(s.Layers)
+	for i := range m.Layers {
+		m.Layers[i].Rows = CloneRows(m.Layers[i].Rows)
+		m.Layers[i].LayerState = states[m.Layers[i].Name]
+	}
+	m.Presences = slices.Clone(s.Presences)
+	m.SetActive(m.Active)
+}
+
+// SetCell sets the cell in the named layer, even if it is locked.
+func (m *Map) SetCell(layer string, atTile Point, cell Cell) {
+	i := m.FindLayer(layer)
+	if i < 0 || !m.Inside(atTile) {
+		return
+	}
+	rows := m.LayerRows(i)
+	if atTile.Y < len(rows) && atTile.X < len(rows[atTile.Y].Cells) {
+		rows[atTile.Y].Cells[atTile.X] = cell
+	}
+}
+
+// Step is a single step in the history that can be undone and redone.
+// It consists of cell edits, or of snapshots of the map before and after.
+type Step struct {
+	Name   string
+	Edits  []Edit
+	Before *Snapshot
+	After  *Snapshot
+}
+
+func (s *Step) Empty() bool {
+	return len(s.Edits) == 0 && s.Before == nil
+}
+
+func (s *Step) Undo(m *Map) {
+	for i := len(s.Edits) - 1; i >= 0; i-- {
+		edit := s.Edits[i]
+		m.SetCell(edit.Layer, edit.At, edit.Before)
+	}
+	if s.Before != nil {
+		m.RestoreSnapshot(s.Before)
+	}
+}
+
+func (s *Step) Redo(m *Map) {
+	for _, edit := range s.Edits {
+		m.SetCell(edit.Layer, edit.At, edit.After)
+	}
+	if s.After != nil {
+		m.RestoreSnapshot(s.After)
+	}
+}
+
+// DefaultHistoryLimit is the default amount of steps that can be undone.
+const DefaultHistoryLimit = 100
+
+// History is the undo and redo history of changes to a map.
+// Changes made between Begin and End are grouped into one step,
+// for example all cells drawn during a single mouse drag.
+type History struct {
+	Done   []Step
+	Undone []Step
+	Limit  int
+	Group  *Step
+	batch  int // Depth of Batch calls.
+}
+
+// Begin starts grouping changes into one step.
+func (h *History) Begin(name string) {
+	h.End()
+	h.Group = &Step{Name: name}
+}
+
+// End stops grouping changes and adds the step to the history.
+func (h *History) End() {
+	if h.Group == nil {
+		return
+	}
+	step := h.Group
+	h.Group = nil
+	h.Push(*step)
+}
+
+// Push adds a step to the history, dropping the oldest steps if needed.
+func (h *History) Push(step Step) {
+	if step.Empty() {
+		return
+	}
+	limit := h.Limit
+	if limit < 1 {
+		limit = DefaultHistoryLimit
+	}
+	h.Done = append(h.Done, step)
+	if len(h.Done) > limit {
+		h.Done = slices.Delete(h.Done, 0, len(h.Done)-limit)
+	}
+	h.Undone = nil
+}
+
+// Clear clears the history, for example when another map is loaded.
+func (h *History) Clear() {
+	h.Done = nil
+	h.Undone = nil
+	h.Group = nil
+}
+
+// Undo undoes the last step and returns its name, or "" if there is none.
+func (h *History) Undo(m *Map) string {
+	h.End()
+	if len(h.Done) < 1 {
+		return ""
+	}
+	last := len(h.Done) - 1
+	step := h.Done[last]
+	h.Done = h.Done[:last]
+	step.Undo(m)
+	h.Undone = append(h.Undone, step)
+	return step.Name
+}
+
+// Redo redoes the last undone step and returns its name, or "" if there is none.
+func (h *History) Redo(m *Map) string {
+	h.End()
+	if len(h.Undone) < 1 {
+		return ""
+	}
+	last := len(h.Undone) - 1
+	step := h.Undone[last]
+	h.Undone = h.Undone[:last]
+	step.Redo(m)
+	h.Done = append(h.Done, step)
+	return step.Name
+}
+
+// Edit records the edit in the open group, or as a step of its own.
+func (h *History) Edit(name string, edits ...Edit) {
+	if len(edits) == 0 {
+		return
+	}
+	if h.Group != nil {
+		h.Group.Edits = append(h.Group.Edits, edits...)
+		return
+	}
+	h.Push(Step{Name: name, Edits: edits})
+}
+
+// Cell records the change of the cell at atTile in the active layer done by op.
+func (h *History) Cell(m *Map, name string, atTile Point, op func()) {
+	before := m.Get(atTile)
+	op()
+	after := m.Get(atTile)
+	if before != after {
+		h.Edit(name, Edit{Layer: m.LayerName(m.Active), At: atTile, Before: before, After: after})
+	}
+}
+
+// Cells records all changes to the cells of the active layer done by op.
+func (h *History) Cells(m *Map, name string, op func()) {
+	before := CloneRows(m.ActiveRows())
+	op()
+	after := m.ActiveRows()
+	layer := m.LayerName(m.Active)
+	edits := []Edit{}
+	for y := 0; y < len(before) && y < len(after); y++ {
+		for x := 0; x < len(before[y].Cells) && x < len(after[y].Cells); x++ {
+			if before[y].Cells[x] != after[y].Cells[x] {
+				edits = append(edits, Edit{Layer: layer, At: image.Pt(x, y),
+					Before: before[y].Cells[x], After: after[y].Cells[x]})
+			}
+		}
+	}
+	h.Edit(name, edits...)
+}
+
+// Change records a change of the whole map done by op as a step of its own.
+func (h *History) Change(m *Map, name string, op func()) {
+	h.Try(m, name, func() error { op(); return nil })
+}
+
+// Try records a change of the whole map done by op like Change. If op
+// fails, the map is restored and nothing is recorded.
+func (h *History) Try(m *Map, name string, op func() error) error {
+	if h.batch == 0 {
+		h.End()
+	}
+	before := m.TakeSnapshot()
+	if err := op(); err != nil {
+		m.RestoreSnapshot(before)
+		return err
+	}
+	if h.batch > 0 {
+		return nil // Batch records the change.
+	}
+	after := m.TakeSnapshot()
+	if !reflect.DeepEqual(before, after) {
+		h.Push(Step{Name: name, Before: before, After: after})
+	}
+	return nil
+}
+
+// Batch records all changes of the map done by op as one step, such as
+// those of a line typed in the console or of a script. get returns the
+// map, if op loads another one, nothing is recorded.
+func (h *History) Batch(get func() *Map, name string, op func()) {
+	if h.batch == 0 {
+		h.End()
+	}
+	m := get()
+	before := m.TakeSnapshot()
+	h.batch++
+	op()
+	h.batch--
+	if h.batch > 0 || get() != m {
+		return
+	}
+	after := m.TakeSnapshot()
+	if !reflect.DeepEqual(before, after) {
+		h.Push(Step{Name: name, Before: before, After: after})
+	}
+}
+
+func (h *History) Put(m *Map, atTile Point, cell Cell) {
+	h.Cell(m, "put", atTile, func() { m.Put(atTile, cell) })
+}
+
+func (h *History) PutFlag(m *Map, atTile Point, flag Flag) {
+	h.Cell(m, "put flag", atTile, func() { m.PutFlag(atTile, flag) })
+}
+
+func (h *History) PutIndex(m *Map, atTile Point, idx byte) {
+	h.Cell(m, "put index", atTile, func() { m.PutIndex(atTile, idx) })
+}
+
+func (h *History) FloodFill(m *Map, atTile Point, cell Cell) {
+	h.Cells(m, "flood fill", func() { m.FloodFill(atTile, cell) })
+}
+
+func (h *History) Paste(m *Map, atTile Point, b *Block) {
+	h.Cells(m, "paste", func() { m.Paste(atTile, b) })
+}
+
+func (h *History) PutPoints(m *Map, name string, points []Point, cell Cell, flagsOnly bool) {
+	h.Cells(m, name, func() { m.PutPoints(points, cell, flagsOnly) })
+}
+
+func (h *History) Replace(m *Map, from, to Cell, flagsOnly bool) {
+	h.Cells(m, "replace", func() { m.Replace(from, to, flagsOnly) })
+}
+
+func (h *History) PutPresence(m *Map, atTile Point, presence Presence) error {
+	if len(m.Presences) >= MaxPresence {
+		return ErrTooManyPresences
+	}
+	h.Change(m, "put presence", func() { m.PutPresence(atTile, presence) })
+	return nil
+}
+
+func (h *History) RemovePresence(m *Map, i int) {
+	h.Change(m, "remove presence", func() { m.RemovePresence(i) })
+}
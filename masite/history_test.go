@@ -0,0 +1,56 @@
+package masite
+
+import (
+	"image"
+	"testing"
+)
+
+func TestHistoryHeader(t *testing.T) {
+	m := newTilaTestMap(4, 4)
+	h := &History{}
+	h.Change(m, "header", func() {
+		m.Number = 3
+		m.Border = 4
+		m.Music = 5
+		m.Scroll = ScrollColumns
+		m.Collision = true
+		m.Sprites.Number = 6
+		m.Exits.North = Exit{Name: "north", Number: 7}
+	})
+	h.Undo(m)
+	if m.Number != 0 || m.Border != 0 || m.Music != 0 || m.Scroll != ScrollScreens ||
+		m.Collision || m.Sprites.Number != 0 || m.Exits.North != (Exit{}) {
+		t.Errorf("undo left header %+v", m.TakeSnapshot())
+	}
+	h.Redo(m)
+	if m.Number != 3 || m.Border != 4 || m.Music != 5 || m.Scroll != ScrollColumns ||
+		!m.Collision || m.Sprites.Number != 6 || m.Exits.North.Number != 7 {
+		t.Errorf("redo left header %+v", m.TakeSnapshot())
+	}
+}
+
+func TestHistoryLayers(t *testing.T) {
+	m := newTilaTestMap(4, 4)
+	h := &History{}
+	m.AddLayer("a", TileLayer)
+	m.AddLayer("b", TileLayer)
+	at := image.Pt(1, 1)
+	h.Put(m, at, Cell{Index: 2})
+	m.RemoveLayer(m.FindLayer("a"))
+	h.Undo(m)
+	if got := m.LayerRows(m.FindLayer("b"))[1].Cells[1].Index; got != 0 {
+		t.Errorf("undo left %d in layer b, want 0", got)
+	}
+	if got := m.Rows[1].Cells[1].Index; got != 0 {
+		t.Errorf("undo changed the base layer to %d", got)
+	}
+	h.Redo(m)
+	if got := m.LayerRows(m.FindLayer("b"))[1].Cells[1].Index; got != 2 {
+		t.Errorf("redo left %d in layer b, want 2", got)
+	}
+	m.RemoveLayer(m.FindLayer("b"))
+	h.Undo(m)
+	if got := m.Rows[1].Cells[1].Index; got != 0 {
+		t.Errorf("undo of a removed layer changed the base layer to %d", got)
+	}
+}
@@ -0,0 +1,145 @@
+//go:build !headless
+
+package masite
+
+import (
+	"maps"
+	"slices"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Input is where the editor and the midgets read the keyboard and the mouse
+// from, the methods are those of ebiten and inpututil.
+type Input interface {
+	CursorPosition() (x, y int)
+	Wheel() (dx, dy float64)
+	AppendInputChars(chars []rune) []rune
+	AppendJustPressedKeys(keys []Key) []Key
+	IsKeyPressed(key Key) bool
+	IsKeyJustPressed(key Key) bool
+	KeyPressDuration(key Key) int
+	IsMouseButtonPressed(button MouseButton) bool
+	IsMouseButtonJustPressed(button MouseButton) bool
+	IsMouseButtonJustReleased(button MouseButton) bool
+}
+
+// ActiveInput is the input the editor and the midgets read. Tests replace
+// it with a FakeInput.
+var ActiveInput Input = EbitenInput{}
+
+// EbitenInput is the input of the window of the game.
+type EbitenInput struct{}
+
+func (EbitenInput) CursorPosition() (int, int)           { return ebiten.CursorPosition() }
+func (EbitenInput) Wheel() (float64, float64)            { return ebiten.Wheel() }
+func (EbitenInput) AppendInputChars(chars []rune) []rune { return ebiten.AppendInputChars(chars) }
+func (EbitenInput) AppendJustPressedKeys(keys []Key) []Key {
+	return inpututil.AppendJustPressedKeys(keys)
+}
+func (EbitenInput) IsKeyPressed(key Key) bool               { return ebiten.IsKeyPressed(key) }
+func (EbitenInput) IsKeyJustPressed(key Key) bool           { return inpututil.IsKeyJustPressed(key) }
+func (EbitenInput) KeyPressDuration(key Key) int            { return inpututil.KeyPressDuration(key) }
+func (EbitenInput) IsMouseButtonPressed(b MouseButton) bool { return ebiten.IsMouseButtonPressed(b) }
+func (EbitenInput) IsMouseButtonJustPressed(b MouseButton) bool {
+	return inpututil.IsMouseButtonJustPressed(b)
+}
+func (EbitenInput) IsMouseButtonJustReleased(b MouseButton) bool {
+	return inpututil.IsMouseButtonJustReleased(b)
+}
+
+// FakeInput is input set by a program, such as a test, instead of a
+// user. Keys and buttons stay pressed until they are released, and Tick
+// moves to the next frame, like ebiten does between two updates.
+type FakeInput struct {
+	Cursor        Point
+	WheelX        float64
+	WheelY        float64
+	Chars         []rune               // Typed in this frame.
+	Keys          map[Key]int          // Frames the pressed keys are held.
+	Buttons       map[MouseButton]int  // Frames the pressed buttons are held.
+	ReleasedMouse map[MouseButton]bool // Released in this frame.
+}
+
+var _ Input = &FakeInput{}
+
+func NewFakeInput() *FakeInput {
+	return &FakeInput{Keys: map[Key]int{}, Buttons: map[MouseButton]int{},
+		ReleasedMouse: map[MouseButton]bool{}}
+}
+
+// Press presses keys in this frame.
+func (f *FakeInput) Press(keys ...Key) {
+	for _, key := range keys {
+		if f.Keys[key] == 0 {
+			f.Keys[key] = 1
+		}
+	}
+}
+
+// Release releases keys in this frame.
+func (f *FakeInput) Release(keys ...Key) {
+	for _, key := range keys {
+		delete(f.Keys, key)
+	}
+}
+
+// PressMouse moves the mouse to at and presses a button in this frame.
+func (f *FakeInput) PressMouse(button MouseButton, at Point) {
+	f.Cursor = at
+	if f.Buttons[button] == 0 {
+		f.Buttons[button] = 1
+	}
+}
+
+// ReleaseMouse releases a button in this frame.
+func (f *FakeInput) ReleaseMouse(button MouseButton) {
+	if f.Buttons[button] > 0 {
+		delete(f.Buttons, button)
+		f.ReleasedMouse[button] = true
+	}
+}
+
+// Type types text in this frame.
+func (f *FakeInput) Type(text string) {
+	f.Chars = append(f.Chars, []rune(text)...)
+}
+
+// Tick moves to the next frame: held keys and buttons are held one frame
+// longer, and what was typed, released or wheeled is gone.
+func (f *FakeInput) Tick() {
+	for key := range f.Keys {
+		f.Keys[key]++
+	}
+	for button := range f.Buttons {
+		f.Buttons[button]++
+	}
+	clear(f.ReleasedMouse)
+	f.Chars = nil
+	f.WheelX, f.WheelY = 0, 0
+}
+
+func (f *FakeInput) CursorPosition() (int, int)           { return f.Cursor.X, f.Cursor.Y }
+func (f *FakeInput) Wheel() (float64, float64)            { return f.WheelX, f.WheelY }
+func (f *FakeInput) AppendInputChars(chars []rune) []rune { return append(chars, f.Chars...) }
+func (f *FakeInput) IsKeyPressed(key Key) bool            { return f.Keys[key] > 0 }
+func (f *FakeInput) IsKeyJustPressed(key Key) bool        { return f.Keys[key] == 1 }
+func (f *FakeInput) KeyPressDuration(key Key) int         { return f.Keys[key] }
+
+func (f *FakeInput) AppendJustPressedKeys(keys []Key) []Key {
+	for _, key := range slices.Sorted(maps.Keys(f.Keys)) {
+		if f.Keys[key] == 1 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (f *FakeInput) IsMouseButtonPressed(b MouseButton) bool     { return f.Buttons[b] > 0 }
+func (f *FakeInput) IsMouseButtonJustPressed(b MouseButton) bool { return f.Buttons[b] == 1 }
+func (f *FakeInput) IsMouseButtonJustReleased(b MouseButton) bool {
+	return f.ReleasedMouse[b]
+}
@@ -0,0 +1,260 @@
+package masite
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// LayerKind is the kind of a layer of a map.
+type LayerKind string
+
+const (
+	TileLayer LayerKind = "tiles" // Tiles and flags, drawn over the lower layers.
+	FlagLayer LayerKind = "flags" // Only flags, such as collision or triggers.
+)
+
+// LayerState is the state of a layer in the editor.
+type LayerState struct {
+	Hidden bool `json:"-" xml:"-"` // If true the layer is not drawn.
+	Locked bool `json:"-" xml:"-"` // If true the layer cannot be edited.
+}
+
+// Layer is an extra named layer of a map.
+// The base layer of a map is stored in the map itself.
+type Layer struct {
+	Name string    `json:"name" xml:"name,attr"`
+	Kind LayerKind `json:"kind" xml:"kind,attr"`
+	Rows []Row     `json:"rows" xml:"rows"`
+	LayerState
+}
+
+// BaseLayerName is the name of the base layer of a map.
+const BaseLayerName = "base"
+
+// Empty returns true if the cell has no tile and no flags.
+func (c Cell) Empty() bool {
+	return c.Index == 0 && c.Flag == 0
+}
+
+// MakeRows makes empty rows for a layer of w by h cells.
+func MakeRows(w, h int) []Row {
+	return ResizeRows(nil, w, h)
+}
+
+// CloneRows makes a deep copy of rows.
+func CloneRows(rows []Row) []Row {
+	res := make([]Row, len(rows))
+	for y, row := range rows {
+		res[y].Cells = slices.Clone(row.Cells)
+	}
+	return res
+}
+
+// ResizeRows resizes the rows to w by h cells.
+func ResizeRows(rows []Row, w, h int) []Row {
+	rlen := len(rows)
+	if h > rlen {
+		rows = append(rows, make([]Row, h-rlen)...)
+	} else if h < len(rows) {
+		rows = rows[0:h]
+	}
+	for y := 0; y < len(rows); y++ {
+		row := rows[y]
+		clen := len(row.Cells)
+		if w > clen {
+			row.Cells = append(row.Cells, make([]Cell, w-clen)...)
+		} else if w < len(row.Cells) {
+			row.Cells = row.Cells[0:w]
+		}
+		rows[y] = row
+	}
+	return rows
+}
+
+// WrapRows moves the cells of the rows of width w horizontally by the given amount,
+// with the cells that fall off the edge coming back on the other side.
+func WrapRows(rows []Row, by, w int) []Row {
+	if w < 1 {
+		return rows
+	}
+	offx := by % w
+	if offx < 0 {
+		offx += w
+	}
+	for y, row := range rows {
+		pre, post := row.Cells[:offx], row.Cells[offx:]
+		row.Cells = slices.Concat(post, pre)
+		rows[y] = row
+	}
+	return rows
+}
+
+// RollRows moves the h rows vertically by the given amount,
+// with the rows that fall off the edge coming back on the other side.
+func RollRows(rows []Row, by, h int) []Row {
+	if h < 1 {
+		return rows
+	}
+	offy := by % h
+	if offy < 0 {
+		offy += h
+	}
+	pre, post := rows[:offy], rows[offy:]
+	return slices.Concat(post, pre)
+}
+
+// LayerCount returns the amount of layers including the base layer.
+func (m *Map) LayerCount() int {
+	return len(m.Layers) + 1
+}
+
+// LayerName returns the name of the layer with index i.
+func (m *Map) LayerName(i int) string {
+	if i < 1 || i > len(m.Layers) {
+		return BaseLayerName
+	}
+	return m.Layers[i-1].Name
+}
+
+// LayerKind returns the kind of the layer with index i.
+func (m *Map) LayerKind(i int) LayerKind {
+	if i < 1 || i > len(m.Layers) {
+		return TileLayer
+	}
+	return m.Layers[i-1].Kind
+}
+
+// LayerRows returns the rows of the layer with index i.
+// Index 0, or any index out of range, is the base layer.
+func (m *Map) LayerRows(i int) []Row {
+	if i < 1 || i > len(m.Layers) {
+		return m.Rows
+	}
+	return m.Layers[i-1].Rows
+}
+
+// ActiveRows returns the rows of the active layer.
+func (m *Map) ActiveRows() []Row {
+	return m.LayerRows(m.Active)
+}
+
+// State returns the state of the layer with index i.
+func (m *Map) State(i int) *LayerState {
+	if i < 1 || i > len(m.Layers) {
+		return &m.Base
+	}
+	return &m.Layers[i-1].LayerState
+}
+
+// FindLayer returns the index of the named layer or -1 if not found.
+func (m *Map) FindLayer(name string) int {
+	if name == BaseLayerName {
+		return 0
+	}
+	for i, layer := range m.Layers {
+		if layer.Name == name {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// AddLayer adds an empty layer to the map and makes it active.
+func (m *Map) AddLayer(name string, kind LayerKind) error {
+	if kind != TileLayer && kind != FlagLayer {
+		return fmt.Errorf("Unknown layer kind: %s", kind)
+	}
+	if name == "" || m.FindLayer(name) >= 0 {
+		return fmt.Errorf("Layer name empty or already used: %s", name)
+	}
+	layer := Layer{Name: name, Kind: kind, Rows: MakeRows(m.Width, m.Height)}
+	m.Layers = append(m.Layers, layer)
+	m.Active = len(m.Layers)
+	return nil
+}
+
+// RemoveLayer removes the layer with index i. The base layer cannot be removed.
+func (m *Map) RemoveLayer(i int) error {
+	if i < 1 || i > len(m.Layers) {
+		return fmt.Errorf("Cannot remove layer %d", i)
+	}
+	m.Layers = slices.Delete(m.Layers, i-1, i)
+	m.Active = min(m.Active, len(m.Layers))
+	return nil
+}
+
+// SetActive makes the layer with index i active.
+func (m *Map) SetActive(i int) {
+	m.Active = max(0, min(i, len(m.Layers)))
+}
+
+// LayerStatus describes the active layer.
+func (m *Map) LayerStatus() string {
+	state := m.State(m.Active)
+	res := fmt.Sprintf("%d:%s(%s)", m.Active, m.LayerName(m.Active), m.LayerKind(m.Active))
+	if state.Hidden {
+		res += " hidden"
+	}
+	if state.Locked {
+		res += " locked"
+	}
+	return res
+}
+
+// CollisionFlags are the flags used for the game logic, not for display.
+const CollisionFlags = FlagSolid | FlagHarm | FlagBless
+
+// Merged returns a copy of the map with all layers merged into the base layer,
+// as it will be in the SMS name table.
+// Non empty cells of a tile layer replace the cells of the layers below,
+// the flags of a flag layer are added to the cells of the layers below.
+func (m *Map) Merged() *Map {
+	res := *m
+	res.Rows = CloneRows(m.Rows)
+	res.Layers = nil
+	res.Active = 0
+	res.Base = LayerState{}
+	for _, layer := range m.Layers {
+		for y := 0; y < len(layer.Rows) && y < len(res.Rows); y++ {
+			cells := res.Rows[y].Cells
+			for x := 0; x < len(layer.Rows[y].Cells) && x < len(cells); x++ {
+				cell := layer.Rows[y].Cells[x]
+				switch {
+				case layer.Kind == FlagLayer:
+					cells[x].Flag |= cell.Flag
+				case !cell.Empty():
+					cells[x] = cell
+				}
+			}
+		}
+	}
+	return &res
+}
+
+// CollisionRows returns the collision flags of the cells of the merged map,
+// so flags in the base layer and in the layers above all count.
+func (m *Map) CollisionRows() []Row {
+	res := m.Merged().Rows
+	for y := range res {
+		for x := range res[y].Cells {
+			res[y].Cells[x] = Cell{Flag: res[y].Cells[x].Flag & CollisionFlags}
+		}
+	}
+	return res
+}
+
+// BasicCollision writes the collision table of the map,
+// with one byte of flags for every cell.
+func (m *Map) BasicCollision(out io.Writer) {
+	fmt.Fprintf(out, "' Collision table for tile map %s, Size:%dx%d\n", m.Prefix, m.Width, m.Height)
+	fmt.Fprintf(out, "%s_collision: \n", m.Prefix)
+	for _, row := range m.CollisionRows() {
+		flags := []string{}
+		for _, cell := range row.Cells {
+			flags = append(flags, fmt.Sprintf("$%02x", byte(cell.Flag)))
+		}
+		fmt.Fprintf(out, "DATA BYTE %s\n", strings.Join(flags, ","))
+	}
+}
@@ -1,6 +1,5 @@
 package masite
 
-import "github.com/hajimehoshi/ebiten/v2"
 import "io/fs"
 import "io"
 import "time"
@@ -94,8 +93,7 @@ func DecodeSurface(rd io.Reader) (*Surface, error) {
 	if err != nil {
 		return nil, err
 	}
-	eimg := ebiten.NewImageFromImage(img)
-	return eimg, nil
+	return NewSurface(img), nil
 }
 
 func DecodeSurfaceAndImage(rd io.Reader) (*Surface, Image, error) {
@@ -103,8 +101,7 @@ func DecodeSurfaceAndImage(rd io.Reader) (*Surface, Image, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	eimg := ebiten.NewImageFromImage(img)
-	return eimg, img, nil
+	return NewSurface(img), img, nil
 }
 
 func LoadPaletted(cb func() (io.ReadCloser, error)) (image.PalettedImage, error) {
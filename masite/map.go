@@ -10,14 +10,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 )
 
-import (
-	"github.com/hajimehoshi/ebiten/v2"
-)
-
 // Format is just the lowercase extension including the '.' prefix.
 type Format string
 
@@ -27,11 +24,23 @@ const (
 	BasicFormat  Format = ".bas"
 )
 
+// JSONFormats and XMLFormats are the formats maps are stored in as JSON
+// and as XML.
+var (
+	JSONFormats = []Format{JSONFormat, ".js", ".masite"}
+	XMLFormats  = []Format{MasiteFormat, ".mas", ".maxite"}
+)
+
+// Loadable returns true if maps can be loaded from this format.
+func (f Format) Loadable() bool {
+	return slices.Contains(JSONFormats, f) || slices.Contains(XMLFormats, f)
+}
+
 func (f Format) Unmarshal(buf []byte, ptr any) error {
-	switch f {
-	case ".json", ".js", ".masite":
+	switch {
+	case slices.Contains(JSONFormats, f):
 		return json.Unmarshal(buf, ptr)
-	case ".xml", ".mas", ".maxite":
+	case slices.Contains(XMLFormats, f):
 		return xml.Unmarshal(buf, ptr)
 	default:
 		return errors.New("format not supported: " + string(f))
@@ -39,12 +48,12 @@ func (f Format) Unmarshal(buf []byte, ptr any) error {
 }
 
 func (f Format) Marshal(ptr any) ([]byte, error) {
-	switch f {
-	case ".json", ".js", ".masite":
+	switch {
+	case slices.Contains(JSONFormats, f):
 		return json.MarshalIndent(ptr, "", "    ")
-	case ".xml", ".mas", ".maxite":
+	case slices.Contains(XMLFormats, f):
 		return xml.MarshalIndent(ptr, "", "    ")
-	case ".bas":
+	case f == BasicFormat:
 		return MarshalBasic(ptr)
 	default:
 		return nil, errors.New("format not supported: " + string(f))
@@ -68,27 +77,6 @@ func (f Flag) Is(s Flag) bool {
 	return (f & s) == s
 }
 
-func (f Flag) Render(screen *Surface, bounds Rectangle) {
-
-	if f.Is(FlagOnTop) {
-		color := RGBA{R: 0, G: 127, B: 127, A: 128}
-		DrawRect(screen, bounds, 2, color)
-	}
-	if f.Is(FlagSolid) {
-		color := RGBA{R: 127, G: 127, B: 127, A: 240}
-		DrawRect(screen, bounds.Inset(2), 2, color)
-	}
-	if f.Is(FlagBless) {
-		color := RGBA{R: 255, G: 255, B: 0, A: 128}
-		DrawRect(screen, bounds.Inset(4), 2, color)
-	}
-
-	if f.Is(FlagHarm) {
-		color := RGBA{R: 255, G: 0, B: 0, A: 128}
-		DrawRect(screen, bounds.Inset(6), 2, color)
-	}
-}
-
 func (f Flag) Buffer() *bytes.Buffer {
 	b := bytes.Buffer{}
 	if f.Is(FlagExtended) {
@@ -263,6 +251,30 @@ type Exits struct {
 	Down  Exit `json:"down,omitempty" xml:"down,omitempty"`
 }
 
+// Exit returns a pointer to the exit in the direction d, or nil if d is not valid.
+func (e *Exits) Exit(d Direction) *Exit {
+	switch d {
+	case North:
+		return &e.North
+	case East:
+		return &e.East
+	case South:
+		return &e.South
+	case West:
+		return &e.West
+	case In:
+		return &e.In
+	case Out:
+		return &e.Out
+	case Up:
+		return &e.Up
+	case Down:
+		return &e.Down
+	default:
+		return nil
+	}
+}
+
 // Kin is the type of a Presence
 type Kin int
 
@@ -339,12 +351,21 @@ func (e *Kin) UnmarshalText(text []byte) error {
 	case "last":
 		v = LastKin
 	default:
-		fmt.Errorf("error: Kin not known")
+		return fmt.Errorf("error: Kin not known: %s", str)
 	}
 	*e = v
 	return nil
 }
 
+// KinNames returns the names of all kins, for choosing one.
+func KinNames() []string {
+	res := []string{}
+	for kin := EmptyKin; kin < LastKin; kin++ {
+		res = append(res, kin.String())
+	}
+	return res
+}
+
 const MaxPresence = 4
 
 // A presence is anything that is present on the tile map apart
@@ -379,17 +400,22 @@ type Map struct {
 	Tw        int        `json:"tw" xml:"tw,attr"`
 	Th        int        `json:"th" xml:"th,attr"`
 	Offset    int        `json:"offset" xml:"offset,attr"`
-	From      string     `json:"from" xml:"from,attr"`               // From where to load the images tiles.
-	Prefix    string     `json:"prefix" xml:"prefix,attr"`           // Prefix in basic.
-	Number    int        `json:"number" xml:"number,attr,omitempty"` // Map number in basic.
-	Border    int        `json:"border" xml:"border,attr,omitempty"` // Border color.
-	Music     int        `json:"music" xml:"music,attr,omitempty"`   // Music index.
-	Sprites   Sprites    `json:"sprites" xml:"sprites"`              // Sprites.
-	Exits     Exits      `json:"exits" xml:"exits"`                  // Exits.
-	Presences []Presence `json:"presences" xml:"presences"`          // Presences.
-	Rows      []Row      `json:"rows" xml:"rows"`                    // Rows.
-	Surface   *Surface   `json:"-" xml:"-"`                          // Ebiten Surface for display.
-	Flags     bool       `json:"-" xml:"-"`                          // If true flags fill be drawn.
+	From      string     `json:"from" xml:"from,attr"`                     // From where to load the images tiles.
+	Prefix    string     `json:"prefix" xml:"prefix,attr"`                 // Prefix in basic.
+	Number    int        `json:"number" xml:"number,attr,omitempty"`       // Map number in basic.
+	Border    int        `json:"border" xml:"border,attr,omitempty"`       // Border color.
+	Music     int        `json:"music" xml:"music,attr,omitempty"`         // Music index.
+	Scroll    Scroll     `json:"scroll" xml:"scroll,attr,omitempty"`       // How to export larger maps.
+	Sprites   Sprites    `json:"sprites" xml:"sprites"`                    // Sprites.
+	Exits     Exits      `json:"exits" xml:"exits"`                        // Exits.
+	Presences []Presence `json:"presences" xml:"presences"`                // Presences.
+	Rows      []Row      `json:"rows" xml:"rows"`                          // Rows of the base layer.
+	Layers    []Layer    `json:"layers" xml:"layers"`                      // Extra layers above the base layer.
+	Collision bool       `json:"collision" xml:"collision,attr,omitempty"` // Export a collision table.
+	Surface   *Surface   `json:"-" xml:"-"`                                // Ebiten Surface for display.
+	Flags     bool       `json:"-" xml:"-"`                                // If true flags fill be drawn.
+	Active    int        `json:"-" xml:"-"`                                // Active layer, 0 is the base layer.
+	Base      LayerState `json:"-" xml:"-"`                                // State of the base layer.
 }
 
 func FormatFor(name string) Format {
@@ -400,6 +426,9 @@ const TW = 8
 const TH = 8
 const PRE = "map"
 
+// MaxMapSize is the largest width or height of a map or block, in tiles.
+const MaxMapSize = 1024
+
 func NewMap(w, h int, from string) (*Map, error) {
 	res := &Map{Width: w, Height: h, Th: TH, Tw: TW, Prefix: PRE}
 	err := res.LoadSurface(from)
@@ -425,17 +454,10 @@ func LoadMap(from string) (*Map, error) {
 }
 
 func LoadMapFromFile(f *os.File) (*Map, error) {
-	buf, err := io.ReadAll(f)
+	res, err := ReadMapFromFile(f)
 	if err != nil {
 		return nil, err
 	}
-	res := &Map{}
-	err = FormatFor(f.Name()).Unmarshal(buf, res)
-	if err != nil {
-		return nil, err
-	}
-	// resize in case of non-coresponence
-	res.Resize(res.Width, res.Height)
 
 	err = res.LoadSurface(res.From)
 	if err != nil {
@@ -451,58 +473,65 @@ func LoadMapFromFile(f *os.File) (*Map, error) {
 	return res, nil
 }
 
-func (m *Map) Resize(w, h int) {
-	if h < 1 || w < 1 {
-		return
+// ReadMap reads a map without loading its tile and sprite images.
+func ReadMap(from string) (*Map, error) {
+	f, err := os.Open(from)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	return ReadMapFromFile(f)
+}
 
-	rlen := len(m.Rows)
-	if h > rlen {
-		m.Rows = append(m.Rows, make([]Row, h-rlen)...)
-	} else if h < len(m.Rows) {
-		m.Rows = m.Rows[0:h]
+func ReadMapFromFile(f *os.File) (*Map, error) {
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
 	}
-	for y := 0; y < len(m.Rows); y++ {
-		row := m.Rows[y]
-		clen := len(row.Cells)
-		if w > clen {
-			row.Cells = append(row.Cells, make([]Cell, w-clen)...)
-		} else if w < len(row.Cells) {
-			row.Cells = row.Cells[0:w]
-		}
-		m.Rows[y] = row
+	res := &Map{}
+	err = FormatFor(f.Name()).Unmarshal(buf, res)
+	if err != nil {
+		return nil, err
 	}
-	m.Width = w
-	m.Height = h
+	if res.Width < 1 || res.Height < 1 || res.Width > MaxMapSize || res.Height > MaxMapSize {
+		return nil, fmt.Errorf("map: size %d %d not in 1-%d", res.Width, res.Height, MaxMapSize)
+	}
+	// resize in case of non-coresponence
+	res.Resize(res.Width, res.Height)
+	return res, nil
 }
 
-func (m *Map) Wrap(by int) {
-	offx := by
-	if by >= m.Width {
-		offx = by % m.Width
+// Resize resizes all layers of the map. The size must be 1 to MaxMapSize.
+func (m *Map) Resize(w, h int) error {
+	if w < 1 || h < 1 {
+		return fmt.Errorf("resize: size must be positive: %d %d", w, h)
 	}
-	if by < 0 {
-		offx = m.Width + (by % m.Width)
+	if w > MaxMapSize || h > MaxMapSize {
+		return fmt.Errorf("resize: size must be at most %d: %d %d", MaxMapSize, w, h)
 	}
+	m.Rows = ResizeRows(m.Rows, w, h)
+	for i := range m.Layers {
+		m.Layers[i].Rows = ResizeRows(m.Layers[i].Rows, w, h)
+	}
+	m.Width = w
+	m.Height = h
+	return nil
+}
 
-	for y, row := range m.Rows {
-		pre, post := row.Cells[:offx], row.Cells[offx:]
-		row.Cells = append(post, pre...)
-		m.Rows[y] = row
+// Wrap wraps all layers of the map horizontally.
+func (m *Map) Wrap(by int) {
+	m.Rows = WrapRows(m.Rows, by, m.Width)
+	for i := range m.Layers {
+		m.Layers[i].Rows = WrapRows(m.Layers[i].Rows, by, m.Width)
 	}
 }
 
+// Roll rolls all layers of the map vertically.
 func (m *Map) Roll(by int) {
-	offy := by
-	if by >= m.Height {
-		offy = by % m.Height
-	}
-	if by < 0 {
-		offy = m.Height + (by % m.Height)
+	m.Rows = RollRows(m.Rows, by, m.Height)
+	for i := range m.Layers {
+		m.Layers[i].Rows = RollRows(m.Layers[i].Rows, by, m.Height)
 	}
-
-	pre, post := m.Rows[:offy], m.Rows[offy:]
-	m.Rows = append(post, pre...)
 }
 
 func (m *Map) LoadSurface(name string) error {
@@ -525,44 +554,65 @@ func (s *Sprites) LoadSurface(name string) error {
 	return nil
 }
 
+// ToTile returns the tile at the screen position at
+// when the map is rendered with the camera.
 func (m *Map) ToTile(at Point, camera Rectangle) Point {
-	off := at.Sub(camera.Min)
-	return image.Pt(off.X/m.Tw, off.Y/m.Th)
+	off := at.Add(camera.Min)
+	return image.Pt(floorDiv(off.X, m.Tw), floorDiv(off.Y, m.Th))
 }
 
-// Puts the cell in the map.
-// If the map is in flag mode, only the cell flag will be set.
+// floorDiv divides rounding down, so positions left of or above
+// the map do not end up in the first tile.
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return (a - b + 1) / b
+	}
+	return a / b
+}
+
+// Puts the cell in the active layer of the map.
+// Nothing happens if the active layer is locked.
 func (m *Map) Put(atTile Point, cell Cell) {
-	if !m.Inside(atTile) {
+	if !m.Editable(atTile) {
 		return
 	}
-	m.Rows[atTile.Y].Cells[atTile.X] = cell
+	m.ActiveRows()[atTile.Y].Cells[atTile.X] = cell
 }
 
-// Puts the cell flag in the map.
+// Puts the cell flag in the active layer of the map.
 func (m *Map) PutFlag(atTile Point, flag Flag) {
-	if !m.Inside(atTile) {
+	if !m.Editable(atTile) {
 		return
 	}
-	m.Rows[atTile.Y].Cells[atTile.X].Flag = flag
+	m.ActiveRows()[atTile.Y].Cells[atTile.X].Flag = flag
 }
 
-// Puts the cell index in the map without changing the flags.
+// Puts the cell index in the active layer of the map without changing the flags.
 func (m *Map) PutIndex(atTile Point, idx byte) {
-	if !m.Inside(atTile) {
+	if !m.Editable(atTile) {
 		return
 	}
-	m.Rows[atTile.Y].Cells[atTile.X].Index = idx
+	m.ActiveRows()[atTile.Y].Cells[atTile.X].Index = idx
+}
+
+// Editable returns true if the tile is inside the map and
+// the active layer is not locked.
+func (m *Map) Editable(atTile Point) bool {
+	return m.Inside(atTile) && !m.State(m.Active).Locked
 }
 
 const DefaultPresenceWidth = 8
 const DefaultPresenceHeight = 16
 
+// ErrTooManyPresences is returned when a map would get more than
+// MaxPresence presences.
+var ErrTooManyPresences = fmt.Errorf("map: at most %d presences allowed", MaxPresence)
+
 // Puts the presence into the map.
 // If the map is in flag mode, only the cell flag will be set.
-func (m *Map) PutPresence(atTile Point, presence Presence) {
+func (m *Map) PutPresence(atTile Point, presence Presence) error {
 	if len(m.Presences) >= MaxPresence {
-		return
+		return ErrTooManyPresences
 	}
 	presence.X = atTile.X * m.Tw
 	presence.Y = atTile.Y * m.Th
@@ -573,6 +623,36 @@ func (m *Map) PutPresence(atTile Point, presence Presence) {
 		presence.Height = DefaultPresenceHeight
 	}
 	m.Presences = append(m.Presences, presence)
+	return nil
+}
+
+// FeetHeight is the height of the feet of a presence, below its position.
+const FeetHeight = 8
+
+// Bounds returns the rectangle in map pixels the presence covers.
+// The sprite stands with its feet on X, Y.
+func (p Presence) Bounds() Rectangle {
+	return Bounds(p.X, p.Y-p.Height+FeetHeight, p.Width, p.Height)
+}
+
+// PresenceAt returns the index of the top presence at the map pixel at,
+// or -1 if there is none.
+func (m *Map) PresenceAt(at Point) int {
+	for i := len(m.Presences) - 1; i >= 0; i-- {
+		p := m.Presences[i]
+		box := Bounds(p.X, p.Y, m.Tw, m.Th)
+		if at.In(p.Bounds()) || at.In(box) {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemovePresence removes the presence with index i.
+func (m *Map) RemovePresence(i int) {
+	if i >= 0 && i < len(m.Presences) {
+		m.Presences = slices.Delete(m.Presences, i, i+1)
+	}
 }
 
 func (m *Map) Inside(atTile Point) bool {
@@ -585,11 +665,12 @@ func (m *Map) Inside(atTile Point) bool {
 	return true
 }
 
+// Get gets the cell from the active layer of the map.
 func (m *Map) Get(atTile Point) (cell Cell) {
 	if !m.Inside(atTile) {
 		return Cell{}
 	}
-	return m.Rows[atTile.Y].Cells[atTile.X]
+	return m.ActiveRows()[atTile.Y].Cells[atTile.X]
 }
 
 func (m *Map) Save(to string) error {
@@ -628,110 +709,19 @@ func (m *Map) ExportToFile(f *os.File, form Format) error {
 	return err
 }
 
-var blockColor = RGBA{R: 66, B: 66, G: 66, A: 0xaa}
-
-// var presenceColor = RGBA{R: 00, B: 66, G: 66, A: 0xaa}
-var presenceColor = RGBA{R: 240, B: 66, G: 66, A: 0xaa}
-
-const FeetHeight = 8
-
-func (m *Map) RenderPresences(screen *Surface, camera Rectangle) {
-
-	starty := camera.Min.Y / m.Th
-	if starty < 0 {
-		starty = 0
-	}
-
-	for _, presence := range m.Presences {
-
-		atx := presence.X - camera.Min.X
-		aty := presence.Y - camera.Min.Y
-
-		if m.Sprites.Surface == nil || m.Flags {
-			to := Bounds(atx, aty, m.Tw, m.Th)
-			FillRect(screen, to, presenceColor)
-			// draw colored rectangle if sprites are not available
-			// or if flags mode is set
-		}
-
-		if m.Sprites.Surface == nil {
-			continue
-		}
-
-		aty = aty - presence.Height + FeetHeight
-		// "shift up so the "feet" stand on the position of the presence.
-		ab := m.Sprites.Surface.Bounds()
-		tilew := ab.Dx() / m.Tw
-		id := presence.Offset
-		idx := id % tilew
-		idy := id / tilew
-		fx := idx * m.Tw
-		fy := idy * m.Th
-		from := image.Rect(fx, fy, fx+presence.Width, fy+presence.Height)
-		sub := m.Sprites.Surface.SubImage(from).(*Surface)
-		opts := ebiten.DrawImageOptions{}
-		opts.GeoM.Translate(float64(atx), float64(aty))
-		if sub != nil {
-			screen.DrawImage(sub, &opts)
-		}
+// Validate checks that the map can be used by the game: its tiles must be
+// in its VRAM area, it may not have too many presences, and it must export
+// to basic.
+func (m *Map) Validate(v VRAM) []error {
+	errs := v.CheckMap(m)
+	if len(m.Presences) > MaxPresence {
+		errs = append(errs, fmt.Errorf("map %s: %d presences, at most %d allowed",
+			m.Prefix, len(m.Presences), MaxPresence))
 	}
-}
-
-func (m *Map) Render(screen *Surface, camera Rectangle) {
-	ab := m.Surface.Bounds()
-
-	starty := camera.Min.Y / m.Th
-	if starty < 0 {
-		starty = 0
-	}
-	endy := min(camera.Max.Y/m.Th, len(m.Rows)-1)
-
-	// This draws the whole layer. Only draw visible part using a camera.
-	for ty := starty; ty < endy; ty++ {
-		row := m.Rows[ty]
-
-		startx := max(camera.Min.X/m.Tw, 0)
-		endx := min(camera.Max.X/m.Tw, len(row.Cells)-1)
-		for tx := startx; tx < endx; tx++ {
-			cell := row.Cells[tx]
-			id := int(cell.Index)
-			if cell.Flag&FlagExtended != 0 {
-				id += 255
-			}
-			tilew := ab.Dx() / m.Tw
-			idx := id % tilew
-			idy := id / tilew
-			fx := idx * m.Tw
-			fy := idy * m.Th
-
-			from := image.Rect(fx, fy, fx+m.Tw, fy+m.Th)
-			sub := m.Surface.SubImage(from).(*Surface)
-			opts := ebiten.DrawImageOptions{}
-			if cell.Flag&FlagHorizontalFlip != 0 {
-				opts.GeoM.Scale(-1, 1)
-				opts.GeoM.Translate(float64(m.Tw), 0)
-			}
-			if cell.Flag&FlagVerticalFlip != 0 {
-				opts.GeoM.Scale(1, -1)
-				opts.GeoM.Translate(0, float64(m.Th))
-			}
-
-			atx := int(tx)*m.Tw - camera.Min.X
-			aty := int(ty)*m.Th - camera.Min.Y
-
-			opts.GeoM.Translate(float64(atx), float64(aty))
-
-			if sub != nil {
-				screen.DrawImage(sub, &opts)
-			}
-
-			to := Bounds(atx, aty, m.Tw, m.Th)
-			if m.Flags {
-				cell.Flag.Render(screen, to)
-			}
-		}
+	if err := m.Basic(io.Discard); err != nil {
+		errs = append(errs, fmt.Errorf("map %s: basic: %w", m.Prefix, err))
 	}
-	m.RenderPresences(screen, camera)
+	return errs
 }
 
 func (m *Map) FloodFill(atTile Point, cell Cell) {
@@ -739,7 +729,7 @@ func (m *Map) FloodFill(atTile Point, cell Cell) {
 	if now.Index == cell.Index && now.Flag == cell.Flag {
 		return // already ok
 	}
-	if !m.Inside(atTile) {
+	if !m.Editable(atTile) {
 		return
 	}
 
@@ -0,0 +1,95 @@
+package masite
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadMapSize(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{`<map width="4" height="2"></map>`, true},
+		{`<map width="1024" height="1"></map>`, true},
+		{`<map width="1025" height="1"></map>`, false},
+		{`<map width="4" height="100000"></map>`, false},
+		{`<map width="0" height="4"></map>`, false},
+		{`<map width="-1" height="4"></map>`, false},
+	}
+	for _, test := range tests {
+		name := filepath.Join(dir, "m.xml")
+		if err := os.WriteFile(name, []byte(test.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := ReadMap(name)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: error %v", test.text, err)
+			continue
+		}
+		if err == nil && len(m.Rows) != m.Height {
+			t.Errorf("%s: %d rows", test.text, len(m.Rows))
+		}
+	}
+}
+
+func TestMapResize(t *testing.T) {
+	m := newTilaTestMap(4, 4)
+	for _, size := range [][2]int{{0, 4}, {4, -1}, {MaxMapSize + 1, 4}, {4, MaxMapSize + 1}} {
+		if err := m.Resize(size[0], size[1]); err == nil {
+			t.Errorf("no error resizing to %d %d", size[0], size[1])
+		}
+		if m.Width != 4 || m.Height != 4 || len(m.Rows) != 4 {
+			t.Errorf("resize to %d %d left %d %d", size[0], size[1], m.Width, m.Height)
+		}
+	}
+	if err := m.Resize(MaxMapSize, 2); err != nil || m.Width != MaxMapSize || len(m.Rows) != 2 {
+		t.Errorf("resize to %d 2: %v, size %d %d", MaxMapSize, err, m.Width, m.Height)
+	}
+}
+
+func TestBasicHeaderRange(t *testing.T) {
+	tests := []struct {
+		change func(m *Map)
+		want   string
+	}{
+		{func(m *Map) { m.Number = 255; m.Exits.Down.Number = 0 }, ""},
+		{func(m *Map) { m.Number = 256 }, "header: number 256 not in 0-255"},
+		{func(m *Map) { m.Border = -1 }, "header: border -1 not in 0-255"},
+		{func(m *Map) { m.Music = 1000 }, "header: music 1000 not in 0-255"},
+		{func(m *Map) { m.Sprites.Number = 300 }, "header: sprites number 300 not in 0-255"},
+		{func(m *Map) { m.Exits.West.Number = 256 }, "header: west exit number 256 not in 0-255"},
+	}
+	for _, test := range tests {
+		m := newTilaTestMap(4, 4)
+		test.change(m)
+		got := ""
+		if err := m.Basic(io.Discard); err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("error %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestCollisionRows(t *testing.T) {
+	m := newTilaTestMap(3, 1)
+	m.Rows[0].Cells[0] = Cell{Index: 1, Flag: FlagSolid | FlagHorizontalFlip}
+	m.Rows[0].Cells[1] = Cell{Index: 2, Flag: FlagOnTop}
+	m.AddLayer("walls", FlagLayer)
+	m.Layers[0].Rows[0].Cells[1].Flag = FlagHarm | FlagVerticalFlip
+	m.Layers[0].Rows[0].Cells[2].Flag = FlagBless
+	want := []Flag{FlagSolid, FlagHarm, FlagBless}
+	for x, cell := range m.CollisionRows()[0].Cells {
+		if cell != (Cell{Flag: want[x]}) {
+			t.Errorf("cell %d is %v, want flags %v", x, cell, want[x])
+		}
+	}
+	if m.Rows[0].Cells[0].Flag != FlagSolid|FlagHorizontalFlip {
+		t.Errorf("collision rows changed the base layer")
+	}
+}
@@ -0,0 +1,268 @@
+//go:build !headless
+
+package masite
+
+import (
+	"fmt"
+	"image"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// MenuItem is a command in a menu. Keys are the keys that do the same,
+// which are shown next to the label.
+type MenuItem struct {
+	Label string
+	Keys  string
+	Do    func()
+}
+
+// Menu is a list of items under a title in the menu bar.
+type Menu struct {
+	Title string
+	Items []MenuItem
+}
+
+// MenuBar shows the titles of menus in a bar. Clicking on a title drops
+// down its items, which are chosen like in a List. While a menu is open,
+// the menu bar is modal and handles all input.
+type MenuBar struct {
+	Midget
+	Menus []Menu
+	Open  int           // Index of the open menu, -1 if none.
+	Drop  *List         // Items of the open menu.
+	Build func() []Menu // Builds the menus again when one is opened, if set.
+}
+
+// MenuTitlePadding is the room around a title in the menu bar.
+const MenuTitlePadding = 12
+
+func NewMenuBar(at Point, menus []Menu) *MenuBar {
+	m := &MenuBar{Midget: MakeMidget(Bounds(at.X, at.Y, 0, 0)), Menus: menus, Open: -1}
+	m.Resize()
+	m.Lock = true
+	return m
+}
+
+// Resize sizes the bar to fit the titles, in its style.
+func (m *MenuBar) Resize() {
+	m.Bounds.Max = m.Bounds.Min.Add(image.Pt(0, m.Style.CaptionHeight))
+	for _, menu := range m.Menus {
+		m.Bounds.Max.X += m.TitleWidth(menu.Title)
+	}
+}
+
+// TitleWidth returns the width of a title in the bar.
+func (m *MenuBar) TitleWidth(title string) int {
+	return m.Style.Font.Advance(title) + MenuTitlePadding
+}
+
+// TitleBounds returns the bounds of the title of menu i in the bar.
+func (m *MenuBar) TitleBounds(i int) Rectangle {
+	x := m.Bounds.Min.X
+	for _, menu := range m.Menus[:i] {
+		x += m.TitleWidth(menu.Title)
+	}
+	w := m.TitleWidth(m.Menus[i].Title)
+	return image.Rect(x, m.Bounds.Min.Y, x+w, m.Bounds.Max.Y)
+}
+
+// TitleAt returns the index of the menu with the title at the point,
+// or -1 if none.
+func (m *MenuBar) TitleAt(at Point) int {
+	for i := range m.Menus {
+		if at.In(m.TitleBounds(i)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// OpenMenu drops down the items of menu i.
+func (m *MenuBar) OpenMenu(i int) {
+	if m.Build != nil {
+		m.Menus = m.Build()
+	}
+	menu := m.Menus[i]
+	width := 0
+	for _, item := range menu.Items {
+		width = max(width, len(item.Label))
+	}
+	items := []string{}
+	keys := 0
+	for _, item := range menu.Items {
+		text := fmt.Sprintf("%-*s  %s", width, item.Label, item.Keys)
+		items = append(items, text)
+		keys = max(keys, m.Style.Font.Advance(text))
+	}
+	title := m.TitleBounds(i)
+	bounds := Bounds(title.Min.X, title.Max.Y, keys+8, len(items)*m.Style.RowHeight())
+	m.Open = i
+	m.Modal = true
+	m.Drop = NewList(bounds, items, func(index int) bool {
+		m.Close()
+		if do := menu.Items[index].Do; do != nil {
+			do()
+		}
+		return true
+	})
+	m.Drop.Lock = true
+}
+
+// Close closes the open menu.
+func (m *MenuBar) Close() {
+	m.Open = -1
+	m.Drop = nil
+	m.Modal = false
+}
+
+// Contains returns true if the point is on a title or on the open menu.
+func (m *MenuBar) Contains(at Point) bool {
+	return m.Midget.Contains(at) || m.Drop != nil && at.In(m.Drop.Bounds)
+}
+
+func (m *MenuBar) Update() error {
+	if m.Hidden {
+		m.Close()
+		return nil
+	}
+	mouse := AbsoluteMouse()
+	title := m.TitleAt(mouse)
+	if m.Drop == nil {
+		if title >= 0 && ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			m.OpenMenu(title)
+			return MidgetOK
+		}
+		return nil
+	}
+
+	// Moving over the other titles opens their menus.
+	if title >= 0 && title != m.Open {
+		m.OpenMenu(title)
+	}
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) &&
+		!m.Drop.IsMouseIn() {
+		m.Close()
+		return MidgetOK
+	}
+	if m.Drop.Update() == Termination {
+		m.Close()
+	}
+	return MidgetOK
+}
+
+func (m MenuBar) Draw(s *Surface) {
+	if m.Hidden {
+		return
+	}
+	m.Midget.Draw(s)
+	for i, menu := range m.Menus {
+		title := m.TitleBounds(i)
+		style := m.Style
+		if i == m.Open {
+			style = DrawSelection(s, title)
+		} else if AbsoluteMouse().In(title) {
+			m.Style.DrawCursor(s, title)
+		}
+		style.DrawLabel(s, menu.Title, title, true)
+	}
+	if m.Drop != nil {
+		m.Drop.Draw(s)
+	}
+}
+
+// check returns the label with a mark if on is true, for the items of
+// settings that are toggled.
+func check(label string, on bool) string {
+	if on {
+		return "[x] " + label
+	}
+	return "[ ] " + label
+}
+
+// EditorMenus returns the menus of the editor. Every command that has a
+// key is in a menu, and the keys call the same methods.
+func (e *Editor) EditorMenus() []Menu {
+	tools := []MenuItem{}
+	for tool := PaintTool; tool < LastTool; tool++ {
+		tools = append(tools, MenuItem{tool.String(), fmt.Sprint(int(tool) + 1), func() { e.SetTool(tool) }})
+	}
+	return []Menu{
+		{"File", []MenuItem{
+			{"Save map", "F2", e.AskSaveMap},
+			{"Load map", "F4", e.AskLoadMap},
+			{"Load tile image", "F", e.AskTileImage},
+			{"Load sprite image", "Shift+F", e.AskSpriteImage},
+			{"Export as basic", "F5", func() { e.ExportBasic() }},
+			{"Back up now", "Shift+U", e.CommitBackup},
+			{"Restore backup", "U", e.AskRestore},
+			{"Quit without save", "Pause", e.AskQuit},
+		}},
+		{"Edit", []MenuItem{
+			{"Undo", "Ctrl+Z", e.Undo},
+			{"Redo", "Ctrl+Y", e.Redo},
+			{"Copy selection", "Ctrl+C", e.CopySelection},
+			{"Cut selection", "Ctrl+X", e.CutSelection},
+			{"Paste at selection", "Shift+Ctrl+V", e.PasteAtSelection},
+			{"Clear selection", "Delete", e.DeleteSelection},
+			{"Flip selection", "H", func() { e.TransformSelection("flip", (*Block).FlipHorizontal) }},
+			{"Flip selection up", "V", func() { e.TransformSelection("flip", (*Block).FlipVertical) }},
+			{"Rotate selection", "R", func() { e.TransformSelection("rotate", (*Block).Rotate) }},
+			{"Save stamp", "T", func() { e.AskStamp(false) }},
+			{"Pick stamp", "Shift+T", func() { e.AskStamp(true) }},
+			{"Edit prefix", "P", e.AskPrefix},
+			{"Edit offset", "O", e.AskOffset},
+		}},
+		{"Cell", []MenuItem{
+			{"Yank hovered tile", "Y", e.Yank},
+			{"Edit flags", "G", e.AskFlags},
+			{check("Horizontal flip", e.Cell.Flag.Is(FlagHorizontalFlip)), "H", func() { e.Cell.Flag ^= FlagHorizontalFlip }},
+			{check("Vertical flip", e.Cell.Flag.Is(FlagVerticalFlip)), "V", func() { e.Cell.Flag ^= FlagVerticalFlip }},
+			{check("On top", e.Cell.Flag.Is(FlagOnTop)), "N", func() { e.Cell.Flag ^= FlagOnTop }},
+			{check("Solid", e.Cell.Flag.Is(FlagSolid)), "B", func() { e.Cell.Flag ^= FlagSolid }},
+			{check("Flag mode", e.Map.Flags), "L", e.ToggleFlagMode},
+		}},
+		{"Layer", []MenuItem{
+			{"Next layer", "PgUp", func() { e.PickLayer(1) }},
+			{"Previous layer", "PgDn", func() { e.PickLayer(-1) }},
+			{"Add layer", "A", e.AskAddLayer},
+			{"Hide/show layer", "I", e.ToggleLayerHidden},
+			{"Lock/unlock layer", "K", e.ToggleLayerLocked},
+		}},
+		{"Tool", tools},
+		{"Presence", []MenuItem{
+			{"Edit presence", "E", e.ShowPresencePanel},
+			{"Remove presence", "Delete", e.RemovePresence},
+			{"World view", "W", e.ShowWorld},
+		}},
+		{"View", []MenuItem{
+			{"Tile selector", "F3", func() { e.ShowTiler(false) }},
+			{"Sprite selector", "Shift+F3", func() { e.ShowTiler(true) }},
+			{check("Grid", e.Overlays.Grid), "F8", func() { e.Overlays.Grid = !e.Overlays.Grid }},
+			{check("Screens", e.Overlays.Screens), "F9", func() { e.Overlays.Screens = !e.Overlays.Screens }},
+			{check("Hidden column", e.Overlays.Border), "F10", func() { e.Overlays.Border = !e.Overlays.Border }},
+			{check("HUD rows", e.Overlays.HUD), "F11", func() { e.Overlays.HUD = !e.Overlays.HUD }},
+			{"Set HUD rows", "Shift+F11", e.AskHUDRows},
+			{"Zoom in", "+", func() { e.SetZoom(e.Zoom + 1) }},
+			{"Zoom out", "-", func() { e.SetZoom(e.Zoom - 1) }},
+			{"Top left", "Home", func() { e.MoveCamera(Point{}) }},
+			{"UI scale", "S", e.AskScale},
+			{check("Default theme", ActiveTheme.Name == "default"), "", func() { e.LoadTheme("default") }},
+			{check("High contrast theme", ActiveTheme.Name == "high-contrast"), "", func() { e.LoadTheme("high-contrast") }},
+			{"Load theme", "Shift+S", e.AskTheme},
+			{"VRAM report", "F7", e.ReportVRAM},
+			{"Tila console", "F6", e.ShowConsole},
+			{"Hide menu", "F12", e.ToggleMenu},
+		}},
+		{"Help", []MenuItem{
+			{"Help", "F1", e.ShowHelp},
+		}},
+	}
+}
+
+// ToggleMenu hides or shows the menu bar.
+func (e *Editor) ToggleMenu() {
+	e.Menu.Hidden = !e.Menu.Hidden
+}
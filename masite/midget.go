@@ -1,3 +1,5 @@
+//go:build !headless
+
 package masite
 
 import "image"
@@ -8,8 +10,6 @@ import "fmt"
 import "errors"
 import "github.com/hajimehoshi/ebiten/v2"
 import "github.com/hajimehoshi/ebiten/v2/vector"
-import "github.com/hajimehoshi/ebiten/v2/inpututil"
-import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
 
 // caption is the caption of a midget
 type Caption struct {
@@ -26,6 +26,7 @@ type Caption struct {
 // A midget should return MidgetOK from its Update function
 // to request to stop other widgets from updating.
 // For example, when a keypress or mouyse click was handled, etc.
+// Only the focused kid is updated, see UpdateKids.
 type Midget struct {
 	Kids   []Game
 	Bounds Rectangle
@@ -36,18 +37,44 @@ type Midget struct {
 	From    Point
 	Frames  int
 	Caption Caption
+	Focus   Game   // Kid that gets the input, nil if the midget itself.
+	Prior   []Game // Kids focused before, the last one gets the focus back.
+	Capture Game   // Kid that has the mouse while a button is held.
+	Modal   bool   // Keeps the focus while open, and blocks the kids behind it.
+	Hidden  bool   // Not drawn and not focused by clicking.
+	Class   string // Style class in the theme, see SetClass.
 }
 
 func MakeMidget(bounds Rectangle) Midget {
 	return Midget{Bounds: bounds, Style: DefaultStyle()}
 }
 
+// SetClass sets the style class of the midget, and its style to the style
+// of the class in the active theme.
+func (m *Midget) SetClass(class string) {
+	m.Class = class
+	m.Style = ActiveTheme.For(class)
+}
+
+// Restyle styles the midget and its kids with the active theme.
+func (m *Midget) Restyle() {
+	m.Style = ActiveTheme.For(m.Class)
+	if m.Caption.Text != "" {
+		m.SetCaption(m.Caption.Text)
+	}
+	for _, kid := range m.Kids {
+		if w, ok := kid.(Widget); ok {
+			w.Base().Restyle()
+		}
+	}
+}
+
 func AbsoluteMouse() Point {
-	return image.Pt(ebiten.CursorPosition())
+	return image.Pt(ActiveInput.CursorPosition())
 }
 
 func (m *Midget) RelativeMouse() Point {
-	rm := image.Pt(ebiten.CursorPosition()).Sub(m.Bounds.Min)
+	rm := image.Pt(ActiveInput.CursorPosition()).Sub(m.Bounds.Min)
 	if m.Caption.Text != "" {
 		rm = rm.Sub(image.Pt(0, m.Caption.Bounds.Dy()))
 	}
@@ -55,15 +82,15 @@ func (m *Midget) RelativeMouse() Point {
 }
 
 func (m *Midget) IsMouseIn() bool {
-	return image.Pt(ebiten.CursorPosition()).In(m.Bounds)
+	return image.Pt(ActiveInput.CursorPosition()).In(m.Bounds)
 }
 
 func (m *Midget) IsMouseInCaption() bool {
-	return image.Pt(ebiten.CursorPosition()).In(m.Caption.Bounds)
+	return image.Pt(ActiveInput.CursorPosition()).In(m.Caption.Bounds)
 }
 
 func (m *Midget) IsMouseInClose() bool {
-	return image.Pt(ebiten.CursorPosition()).In(m.Caption.Close)
+	return image.Pt(ActiveInput.CursorPosition()).In(m.Caption.Close)
 }
 
 func (m *Midget) Update() error {
@@ -86,7 +113,7 @@ const CaptionCloseSize = 14
 func (m *Midget) SetCaption(text string) {
 	m.Caption.Text = text
 	m.Caption.Bounds = m.Bounds
-	m.Caption.Bounds.Max.Y = m.Caption.Bounds.Min.Y + CaptionHeight
+	m.Caption.Bounds.Max.Y = m.Caption.Bounds.Min.Y + m.Style.CaptionHeight
 	m.Caption.Close = m.Caption.Bounds
 	m.Caption.Close.Min.X = m.Caption.Close.Max.X - CaptionCloseSize
 	m.Caption.Close = m.Caption.Close.Inset(CaptionCloseMargin)
@@ -100,36 +127,79 @@ func (m *Midget) Draw(s *Surface) {
 		m.Style.DrawBox(s, m.Caption.Bounds)
 		m.Style.DrawBox(s, m.Caption.Close)
 		m.Style.DrawClose(s, m.Caption.Close.Inset(CaptionCloseMargin))
-
-		ebitenutil.DebugPrintAt(s, m.Caption.Text, m.Caption.Bounds.Min.X, m.Caption.Bounds.Min.Y)
+		m.Style.DrawLabel(s, m.Caption.Text, m.Caption.Bounds, false)
 	}
 	m.DrawKids(s)
 }
 
+// Add adds a kid on top of the others and focuses it.
 func (m *Midget) Add(g Game) Game {
 	m.Kids = slices.Insert(m.Kids, 0, g)
+	m.FocusOn(g)
 	return g
 }
 
+// UpdateKids updates the focused kid. Pressing a mouse button over a kid
+// focuses it and raises it to the top first, and the kid captures the
+// mouse until the buttons are released. Pressing outside of the kids
+// gives the focus to the midget itself. While a modal kid is open it
+// keeps the focus, and the midget gets no input.
+// Tab and Shift+Tab focus the other kids in turn.
 func (m *Midget) UpdateKids() error {
-	for i, kid := range m.Kids {
-		if kid == nil {
-			continue
-		}
-		err := kid.Update()
-		if errors.Is(err, Termination) {
-			m.Kids = slices.Delete(m.Kids, i, i+1)
-			// drop the midget
-			return MidgetOK // stop event handling for other widgets
-		} else if errors.Is(err, MidgetOK) {
-			return MidgetOK // stop event handling for other widgets
-		} else if err != nil {
-			return err
+	if m.Focus != nil && !slices.Contains(m.Kids, m.Focus) {
+		m.Focus = nil
+	}
+	modal := m.ModalKid()
+	mouse := AbsoluteMouse()
+	if IsMouseJustPressed() {
+		m.Capture = m.KidAt(mouse)
+		if modal != nil && m.Capture != modal {
+			m.Capture = nil
+		} else {
+			m.FocusOn(m.Capture)
 		}
 	}
+	if modal != nil {
+		m.FocusOn(modal)
+	} else if ActiveInput.IsKeyJustPressed(ebiten.KeyTab) && len(m.Kids) > 0 {
+		m.Cycle(ActiveInput.KeyPressDuration(ebiten.KeyShiftLeft) == 0 &&
+			ActiveInput.KeyPressDuration(ebiten.KeyShiftRight) == 0)
+		return MidgetOK
+	}
+
+	err := m.UpdateFocus()
+	if !IsMouseHeld() {
+		m.Capture = nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, dy := ActiveInput.Wheel(); dy != 0 && m.KidAt(mouse) != nil {
+		return MidgetOK // the wheel scrolls the kid, not what is behind it.
+	}
+	if modal != nil || m.Capture != nil {
+		return MidgetOK
+	}
 	return nil
 }
 
+// UpdateFocus updates the focused kid, and removes it if it terminates.
+func (m *Midget) UpdateFocus() error {
+	kid := m.Focus
+	if kid == nil {
+		return nil
+	}
+	err := kid.Update()
+	if errors.Is(err, Termination) {
+		m.Remove(kid)
+		return MidgetOK // stop event handling for other widgets
+	} else if errors.Is(err, MidgetOK) {
+		return MidgetOK // stop event handling for other widgets
+	}
+	return err
+}
+
+// DrawKids draws the kids, the top one last, and marks the focused kid.
 func (m *Midget) DrawKids(s *Surface) {
 	for i := len(m.Kids) - 1; i >= 0; i-- {
 		kid := m.Kids[i]
@@ -137,6 +207,9 @@ func (m *Midget) DrawKids(s *Surface) {
 			kid.Draw(s)
 		}
 	}
+	if w, ok := m.Focus.(Widget); ok && len(m.Kids) > 1 && !w.Base().Hidden {
+		w.Base().Style.DrawCursor(s, w.Base().Bounds.Inset(-1))
+	}
 }
 
 func (m *Midget) Layout(w, h int) (rw, rh int) {
@@ -145,18 +218,19 @@ func (m *Midget) Layout(w, h int) (rw, rh int) {
 }
 
 // UpdateDrag allows the Midget to be dragged if not locked.
+// Once dragged, it follows the mouse outside of its bounds until released.
 func (m *Midget) UpdateDrag() error {
-	if !m.IsMouseIn() || m.Lock {
+	if m.Lock || !m.Drag && !m.IsMouseIn() {
 		m.Drag = false
 		return nil
 	}
 
-	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		m.Drag = true
 		m.From = AbsoluteMouse()
 	}
 	if m.Drag {
-		if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+		if ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
 			m.Drag = false
 		} else {
 			now := AbsoluteMouse()
@@ -179,7 +253,7 @@ func (m *Midget) UpdateCaption() error {
 	if !m.IsMouseInClose() {
 		return nil
 	}
-	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		return Termination
 	}
 	return nil
@@ -189,28 +263,22 @@ var _ Game = &Midget{}
 
 // Style is a simplified style
 type Style struct {
-	Cursor RGBA
-	Border RGBA
-	Shadow RGBA
-	Filled RGBA
-	Close  RGBA
-	Stroke int
-}
-
+	Cursor        RGBA
+	Border        RGBA
+	Shadow        RGBA
+	Filled        RGBA
+	Close         RGBA
+	Text          RGBA
+	Stroke        int
+	Padding       int // Room between a border and text.
+	CaptionHeight int
+	Font          *Font
+}
+
+// DefaultStyle returns the style of midgets without a class in the
+// active theme.
 func DefaultStyle() Style {
-	s := Style{}
-	s.Cursor = RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x55}
-	s.Border = RGBA{R: 0x55, G: 0x55, B: 0x55, A: 0xff}
-	s.Shadow = RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xaa}
-	s.Filled = RGBA{R: 0x00, G: 0x00, B: 0x55, A: 0xaa}
-	s.Close = RGBA{R: 0xff, G: 0xaa, B: 0xaa, A: 0xaa}
-	s.Stroke = 1
-	return s
-}
-
-func (s Style) ForError() Style {
-	s.Filled = RGBA{R: 0x55, G: 0x00, B: 0x00, A: 0xaa}
-	return s
+	return ActiveTheme.Style
 }
 
 func FillRect(Surface *Surface, r Rectangle, col RGBA) {
@@ -256,6 +324,45 @@ func (s Style) DrawClose(surface *Surface, r Rectangle) {
 	DrawX(surface, r, int(s.Stroke), s.Close)
 }
 
+// DrawSelection draws the background of a selected item in r, and returns
+// the style to draw the item with, of the selected class.
+func DrawSelection(surface *Surface, r Rectangle) Style {
+	selected := ActiveTheme.For(ClassSelected)
+	FillRect(surface, r, selected.Filled)
+	selected.DrawCursor(surface, r)
+	return selected
+}
+
+// DrawText draws text with its top left at x, y, with a shadow so it can
+// be read over the map.
+func (s Style) DrawText(surface *Surface, text string, x, y int) {
+	if s.Shadow.A != 0 {
+		s.Font.Draw(surface, text, x+1, y+1, s.Shadow)
+	}
+	s.Font.Draw(surface, text, x, y, s.Text)
+}
+
+// RowHeight returns the height of a row of a list, a line of text with
+// padding above and below.
+func (s Style) RowHeight() int {
+	return s.Font.Height + s.Padding
+}
+
+// DrawRowText draws text in the row of a list at x, y.
+func (s Style) DrawRowText(surface *Surface, text string, x, y int) {
+	s.DrawText(surface, text, x+s.Padding, y+s.Padding/2)
+}
+
+// DrawLabel draws text centered vertically in r, and horizontally if center.
+func (s Style) DrawLabel(surface *Surface, text string, r Rectangle, center bool) {
+	size := s.Font.Measure(text)
+	x := r.Min.X + s.Padding
+	if center {
+		x = r.Min.X + (r.Dx()-size.X)/2
+	}
+	s.DrawText(surface, text, x, r.Min.Y+(r.Dy()-size.Y)/2)
+}
+
 func (s Style) DrawBox(Surface *Surface, r Rectangle) {
 	if s.Shadow.A != 0 {
 		shadow := s.Shadow
@@ -326,7 +433,7 @@ func Ask(bounds Rectangle, prompt, def string, on func(res string) bool) *Asker
 
 func (a *Asker) Update() error {
 	var keys []Key
-	keys = inpututil.AppendJustPressedKeys(keys)
+	keys = ActiveInput.AppendJustPressedKeys(keys)
 	handled := len(keys) > 0
 	for _, key := range keys {
 		switch key {
@@ -336,15 +443,15 @@ func (a *Asker) Update() error {
 				return Termination
 			}
 		case ebiten.KeyC:
-			if inpututil.KeyPressDuration(ebiten.KeyControlLeft) > 0 ||
-				inpututil.KeyPressDuration(ebiten.KeyControlRight) > 0 {
+			if ActiveInput.KeyPressDuration(ebiten.KeyControlLeft) > 0 ||
+				ActiveInput.KeyPressDuration(ebiten.KeyControlRight) > 0 {
 				WriteClipboardRunes(a.Buf)
 				a.Midget.Update()
 				return MidgetOK
 			}
 		case ebiten.KeyV:
-			if inpututil.KeyPressDuration(ebiten.KeyControlLeft) > 0 ||
-				inpututil.KeyPressDuration(ebiten.KeyControlRight) > 0 {
+			if ActiveInput.KeyPressDuration(ebiten.KeyControlLeft) > 0 ||
+				ActiveInput.KeyPressDuration(ebiten.KeyControlRight) > 0 {
 				clip := ReadClipboardRunes()
 				if len(clip) > 0 {
 					a.Buf = append(a.Buf, clip...)
@@ -383,7 +490,7 @@ func (a *Asker) Update() error {
 
 	if a.Frames > 30 { // debounce previous input when the Asker is opened.
 		var chars []rune
-		chars = ebiten.AppendInputChars(chars)
+		chars = ActiveInput.AppendInputChars(chars)
 		if len(chars) > 0 {
 			a.Buf = slices.Insert(a.Buf, a.Cursor, chars...)
 			a.Cursor += len(chars)
@@ -410,17 +517,12 @@ func (a Asker) Draw(s *Surface) {
 		bounds.Min.Y = a.Caption.Bounds.Max.Y
 	}
 
-	ebitenutil.DebugPrintAt(s,
-		fmt.Sprintf("%s>%s|%s", a.Prompt,
-			string(a.Buf[0:a.Cursor]),
-			string(a.Buf[a.Cursor:]),
-		),
-		bounds.Min.X, bounds.Min.Y,
+	text := fmt.Sprintf("%s>%s|%s", a.Prompt,
+		string(a.Buf[0:a.Cursor]),
+		string(a.Buf[a.Cursor:]),
 	)
-}
-
-func Bounds(x, y, w, h int) Rectangle {
-	return image.Rect(x, y, x+w, y+h)
+	lines := a.Style.Font.Wrap(text, bounds.Dx()-2*a.Style.Padding)
+	a.Style.DrawText(s, strings.Join(lines, "\n"), bounds.Min.X+a.Style.Padding, bounds.Min.Y)
 }
 
 func (m *Midget) Ask(x, y, w, h int, prompt, def string, on func(res string) bool) *Asker {
@@ -435,19 +537,32 @@ func (m *Midget) YesNo(x, y, w, h int, prompt, def string, on func(res bool)) *A
 		return true
 	}
 	ask := Ask(Bounds(x, y, w, h), prompt, def, wrap)
+	ask.Modal = true
 	m.Add(ask)
 	return ask
 }
 
 func Accept(sres string) bool { return true }
 
+// ErrorWidth is the widest an error is shown before it is wrapped.
+const ErrorWidth = 400
+
+// Error shows an error, in a box of at least w by h, which grows to fit
+// the wrapped message.
 func (m *Midget) Error(x, y, w, h int, err error) *Asker {
 	if err == nil {
 		return nil
 	}
 	msg := err.Error()
-	ask := Ask(Bounds(x, y, max(w, len(msg)*8), h), msg, "", Accept)
-	ask.Style = ask.Style.ForError()
+	style := ActiveTheme.For(ClassError)
+	w = max(w, min(style.Font.Measure(msg).X+4*style.Padding, ErrorWidth))
+	lines := style.Font.Wrap(msg+">|", w-2*style.Padding)
+	h = max(h, style.CaptionHeight+len(lines)*style.Font.Height+2*style.Padding)
+	ask := Ask(Bounds(x, y, w, h), "", "", Accept)
+	ask.SetClass(ClassError)
+	ask.SetCaption("Error")
+	ask.Prompt = msg
+	ask.Modal = true
 	m.Add(ask)
 	return ask
 }
@@ -516,40 +631,107 @@ func (m *Midget) AskText(x, y, w, h int, prompt string, t TextEncoding) *Asker {
 	return m.Ask(x, y, w, h, prompt, string(enc), on)
 }
 
-func (m *Midget) AskCommand(x, y, w, h int, prompt string, tila *Tila) *Asker {
-	var ask *Asker
-	showLines := (h / CaptionHeight) - 1
-	if showLines < 1 {
-		showLines = 1
+// Chooser chooses one of a list of choices,
+// with the arrow keys or by clicking on it.
+type Chooser struct {
+	Midget
+	Choices []string
+	Index   int
+	On      func(string) bool
+}
+
+func Choose(bounds Rectangle, prompt string, choices []string, def string, on func(res string) bool) *Chooser {
+	c := &Chooser{Midget: MakeMidget(bounds), Choices: choices, On: on}
+	c.Index = max(0, slices.Index(choices, def))
+	c.SetCaption(prompt)
+	return c
+}
+
+func (c *Chooser) Choose() error {
+	if c.Index < 0 || c.Index >= len(c.Choices) {
+		return Termination
 	}
-	on := func(sres string) bool {
-		res := tila.Run(sres)
-		if err, isErr := res.(error); isErr {
-			m.Error(x, y, w, h, err)
-		} else {
-			out := tila.Out.String()
-			lines := strings.Split(out, "\n")
-			if len(lines) > showLines {
-				lines = lines[len(lines)-showLines:]
-			}
-			ask.Prompt = strings.Join(lines, "\n")
-			ask.Buf = []rune{}
-			ask.Cursor = 0
+	if c.On(c.Choices[c.Index]) {
+		return Termination
+	}
+	return MidgetOK
+}
+
+func (c *Chooser) Update() error {
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyUp:
+			c.Index = max(0, c.Index-1)
+		case ebiten.KeyDown:
+			c.Index = min(len(c.Choices)-1, c.Index+1)
+		case ebiten.KeyEnter:
+			return c.Choose()
+		case ebiten.KeyEscape:
+			return Termination
+		default:
 		}
-		return false
 	}
-	ask = m.Ask(x, y, w, h, prompt, "", on)
-	return ask
+
+	if c.IsMouseIn() && !c.IsMouseInCaption() &&
+		ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		index := c.RelativeMouse().Y / c.Style.RowHeight()
+		if index >= 0 && index < len(c.Choices) {
+			c.Index = index
+			return c.Choose()
+		}
+	}
+
+	err := c.Midget.Update()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return MidgetOK
+	}
+	return nil
 }
 
+func (c Chooser) Draw(s *Surface) {
+	c.Midget.Draw(s)
+	bounds := c.Bounds
+	if c.Caption.Text != "" {
+		bounds.Min.Y = c.Caption.Bounds.Max.Y
+	}
+	row := c.Style.RowHeight()
+	for i, choice := range c.Choices {
+		y := bounds.Min.Y + i*row
+		style := c.Style
+		if i == c.Index {
+			style = DrawSelection(s, image.Rect(bounds.Min.X, y, bounds.Max.X, y+row))
+		}
+		style.DrawRowText(s, choice, bounds.Min.X, y)
+	}
+}
+
+// AskChoice asks to choose one of the choices. The height is
+// calculated from the amount of choices.
+func (m *Midget) AskChoice(x, y, w int, prompt string, choices []string, def string, on func(res string) bool) *Chooser {
+	h := m.Style.CaptionHeight + len(choices)*m.Style.RowHeight()
+	c := Choose(Bounds(x, y, w, h), prompt, choices, def, on)
+	m.Add(c)
+	return c
+}
+
+// Tiler selects a tile from a tile sheet by clicking on it.
+// If OnRect is set, a rectangle of tiles can be selected by dragging.
 type Tiler struct {
 	Midget
-	On       func(x, y int)
-	Cursor   Point
-	Selected Point
-	Tw       int
-	Th       int
-	Surface  *Surface
+	On        func(x, y int)
+	OnRect    func(r Rectangle)
+	Cursor    Point
+	Selected  Point
+	Selection Rectangle
+	Dragging  bool
+	Tw        int
+	Th        int
+	Surface   *Surface
 }
 
 func Tile(bounds Rectangle, surface *Surface, on func(x, y int)) *Tiler {
@@ -562,7 +744,7 @@ func (t *Tiler) SetCaption(text string) {
 
 func (t *Tiler) Update() error {
 	var keys []Key
-	keys = inpututil.AppendJustPressedKeys(keys)
+	keys = ActiveInput.AppendJustPressedKeys(keys)
 	for _, key := range keys {
 		switch key {
 		case ebiten.KeyEnter, ebiten.KeyEscape:
@@ -571,27 +753,65 @@ func (t *Tiler) Update() error {
 		}
 	}
 
+	// Selecting a rectangle takes precedence over dragging the pane,
+	// which then can only be dragged by its caption.
+	if t.Dragging {
+		return t.UpdateDrag()
+	}
+	inSheet := t.IsMouseIn() && !t.IsMouseInCaption()
+	mouse := t.RelativeMouse()
+	tile := image.Pt(mouse.X/t.Tw, mouse.Y/t.Th)
+	if inSheet && t.OnRect != nil && ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		t.Selected = tile
+		t.Dragging = true
+		t.Selection = Bounds(tile.X, tile.Y, 1, 1)
+		return MidgetOK
+	}
+
 	err := t.Midget.Update()
 	if err != nil {
 		return err
 	}
 
-	if !t.IsMouseIn() {
+	if !inSheet {
 		return nil
 	}
-	mouse := t.RelativeMouse()
-	tile := image.Pt(mouse.X/t.Tw, mouse.Y/t.Th)
-	if !t.IsMouseInCaption() {
-		t.Cursor = tile
-	}
-	if !t.IsMouseInCaption() && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+	t.Cursor = tile
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		t.Selected = tile
+		t.Selection = Rectangle{}
 		t.On(tile.X, tile.Y)
 		return MidgetOK
 	}
 	return nil
 }
 
+// UpdateDrag updates the selected rectangle while dragging.
+// A single tile is reported with On, a larger rectangle with OnRect.
+func (t *Tiler) UpdateDrag() error {
+	mouse := t.RelativeMouse()
+	tile := image.Pt(max(0, mouse.X/t.Tw), max(0, mouse.Y/t.Th))
+	if t.Surface != nil {
+		w, h := t.Surface.Size()
+		tile.X = min(tile.X, w/t.Tw-1)
+		tile.Y = min(tile.Y, h/t.Th-1)
+	}
+	t.Cursor = tile
+	r := image.Rectangle{Min: t.Selected, Max: tile}.Canon()
+	r.Max = r.Max.Add(image.Pt(1, 1))
+	t.Selection = r
+	if !ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+		return MidgetOK
+	}
+	t.Dragging = false
+	if r.Dx() == 1 && r.Dy() == 1 {
+		t.On(r.Min.X, r.Min.Y)
+	} else {
+		t.OnRect(r)
+	}
+	return MidgetOK
+}
+
 func (t Tiler) Draw(s *Surface) {
 	t.Midget.Draw(s)
 
@@ -611,6 +831,11 @@ func (t Tiler) Draw(s *Surface) {
 	}
 	t.Style.DrawCursor(s, Bounds(t.Cursor.X*t.Tw, t.Cursor.Y*t.Th, t.Tw, t.Th).Add(bounds.Min))
 	t.Style.DrawCursor(s, Bounds(t.Selected.X*t.Tw, t.Selected.Y*t.Th, t.Tw, t.Th).Add(bounds.Min))
+	if !t.Selection.Empty() {
+		sel := t.Selection
+		t.Style.DrawCursor(s, image.Rect(sel.Min.X*t.Tw, sel.Min.Y*t.Th,
+			sel.Max.X*t.Tw, sel.Max.Y*t.Th).Add(bounds.Min))
+	}
 }
 
 func (m *Midget) Tile(x, y int, surface *Surface, on func(x, y int)) *Tiler {
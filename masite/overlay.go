@@ -0,0 +1,122 @@
+//go:build !headless
+
+package masite
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Overlays are drawn over the map to show what the SMS will display.
+type Overlays struct {
+	Grid    bool  // Tile grid.
+	Screens bool  // Boundaries of the 32x24 tile screens.
+	Border  bool  // Left column hidden by BORDER_LEFT_ON.
+	HUD     bool  // Rows of every screen used by the HUD.
+	HUDRows []int // Rows used by the HUD, 0 based.
+}
+
+// DefaultHUDRows are the rows lox.bas prints on.
+var DefaultHUDRows = []int{SMS_SCREEN_TH - 1}
+
+func DefaultOverlays() Overlays {
+	return Overlays{Screens: true, Border: true, HUD: true, HUDRows: slices.Clone(DefaultHUDRows)}
+}
+
+// ParseHUDRows parses a list of HUD rows separated by commas.
+func ParseHUDRows(text string) ([]int, error) {
+	res := []int{}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		row, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("hud: %w", err)
+		}
+		if row < 0 || row >= SMS_SCREEN_TH {
+			return nil, fmt.Errorf("hud: row %d outside of screen 0-%d", row, SMS_SCREEN_TH-1)
+		}
+		res = append(res, row)
+	}
+	return res, nil
+}
+
+// FormatHUDRows formats the HUD rows as accepted by ParseHUDRows.
+func FormatHUDRows(rows []int) string {
+	parts := []string{}
+	for _, row := range rows {
+		parts = append(parts, strconv.Itoa(row))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Status describes which overlays are shown.
+func (o Overlays) Status() string {
+	res := []string{}
+	if o.Grid {
+		res = append(res, "grid")
+	}
+	if o.Screens {
+		res = append(res, "screens")
+	}
+	if o.Border {
+		res = append(res, "border")
+	}
+	if o.HUD {
+		res = append(res, fmt.Sprintf("hud %v", o.HUDRows))
+	}
+	return strings.Join(res, " ")
+}
+
+var (
+	gridColor   = RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0x40}
+	screenColor = RGBA{R: 0x00, G: 0xff, B: 0xff, A: 0xaa}
+	hiddenColor = RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0x99}
+	hudColor    = RGBA{R: 0xff, G: 0x00, B: 0xff, A: 0x55}
+)
+
+// Render renders the overlays for the map m seen through the camera.
+func (o Overlays) Render(screen *Surface, m *Map, camera Rectangle) {
+	mw, mh := m.Width*m.Tw, m.Height*m.Th
+	sw, sh := SMS_SCREEN_TW*m.Tw, SMS_SCREEN_TH*m.Th
+	area := image.Rect(0, 0, mw, mh).Sub(camera.Min)
+
+	if o.Border || o.HUD {
+		for sy := 0; sy < mh; sy += sh {
+			for sx := 0; sx < mw; sx += sw {
+				if o.Border {
+					left := image.Rect(sx, sy, sx+m.Tw, sy+sh).Sub(camera.Min)
+					FillRect(screen, left.Intersect(area), hiddenColor)
+				}
+				if o.HUD {
+					for _, row := range o.HUDRows {
+						y := sy + row*m.Th
+						hud := image.Rect(sx, y, sx+sw, y+m.Th).Sub(camera.Min)
+						FillRect(screen, hud.Intersect(area), hudColor)
+					}
+				}
+			}
+		}
+	}
+	if o.Grid {
+		for x := 0; x <= mw; x += m.Tw {
+			DrawLine(screen, image.Rect(x, 0, x, mh).Sub(camera.Min), 1, gridColor)
+		}
+		for y := 0; y <= mh; y += m.Th {
+			DrawLine(screen, image.Rect(0, y, mw, y).Sub(camera.Min), 1, gridColor)
+		}
+	}
+	if o.Screens {
+		for x := 0; x <= mw; x += sw {
+			DrawLine(screen, image.Rect(x, 0, x, mh).Sub(camera.Min), 1, screenColor)
+		}
+		for y := 0; y <= mh; y += sh {
+			DrawLine(screen, image.Rect(0, y, mw, y).Sub(camera.Min), 1, screenColor)
+		}
+	}
+}
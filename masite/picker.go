@@ -0,0 +1,351 @@
+//go:build !headless
+
+package masite
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// ImageExtensions are the extensions of the images tiles can be loaded from.
+var ImageExtensions = []string{".png", ".gif", ".jpg", ".jpeg"}
+
+// IsMapFile returns true if the named file is a map that can be loaded.
+func IsMapFile(name string) bool {
+	return FormatFor(name).Loadable()
+}
+
+// IsImageFile returns true if the named file is an image.
+func IsImageFile(name string) bool {
+	return slices.Contains(ImageExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// Picker picks a file from a directory. Typing filters the files by name,
+// Backspace on an empty filter goes to the parent directory, and the
+// arrow keys, Page Up, Page Down, Home and End select a file. Enter or a
+// click opens the selected directory or picks the selected file.
+// Images are previewed next to the files.
+//
+// A Picker to save picks the typed name if it is not an existing file,
+// with Ext added if it has no extension.
+type Picker struct {
+	Midget
+	FS       fs.FS               // Files to pick from, the files of the OS if nil.
+	Dir      string              // Directory shown.
+	Show     func(string) bool   // Files to show, directories are always shown.
+	Ext      string              // Extension added to new names when saving.
+	Save     bool                // Pick a name to save as, which may be new.
+	Filter   []rune              // Typed part of the name.
+	Entries  []string            // Shown names, directories end in /.
+	Index    int                 // Index of the selected entry.
+	Top      int                 // Index of the first entry shown.
+	On       func(string) bool   // Called with the picked path, true to close.
+	Err      error               // Error reading the directory.
+	Preview  *Surface            // Preview of the selected image.
+	Previews map[string]*Surface // Previews loaded before.
+	Opener   []Key               // Keys that opened the picker, not typed in it.
+}
+
+// Width of the list of files in a Picker, the rest is for the preview.
+const PickerListWidth = 220
+
+// Pick returns a picker for the directory of def, that shows the files
+// show returns true for.
+func Pick(bounds Rectangle, prompt, def string, show func(string) bool, on func(string) bool) *Picker {
+	p := &Picker{Midget: MakeMidget(bounds), Show: show, On: on,
+		Previews: map[string]*Surface{}, Opener: ActiveInput.AppendJustPressedKeys(nil)}
+	p.SetCaption(prompt)
+	p.Dir = filepath.Dir(def)
+	if def == "" {
+		p.Dir = "."
+	}
+	p.Read()
+	p.Select(slices.Index(p.Entries, filepath.Base(def)))
+	return p
+}
+
+// OpenerHeld returns true while a key that opened the picker is held, so
+// what it types is not typed in the picker.
+func (p *Picker) OpenerHeld() bool {
+	return slices.ContainsFunc(p.Opener, ActiveInput.IsKeyPressed)
+}
+
+// join joins the directory and a name, in the way of the FS if set.
+func (p *Picker) join(dir, name string) string {
+	if p.FS != nil {
+		return path.Join(dir, name)
+	}
+	return filepath.Join(dir, name)
+}
+
+func (p *Picker) readDir() ([]fs.DirEntry, error) {
+	if p.FS != nil {
+		return fs.ReadDir(p.FS, p.Dir)
+	}
+	return os.ReadDir(p.Dir)
+}
+
+// Read reads the directory again, and shows the entries that match the
+// filter, directories first.
+func (p *Picker) Read() {
+	entries, err := p.readDir()
+	p.Err = err
+	filter := strings.ToLower(string(p.Filter))
+	dirs, files := []string{}, []string{}
+	if p.HasParent() && filter == "" {
+		dirs = append(dirs, "../")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !strings.Contains(strings.ToLower(name), filter) {
+			continue
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, name+"/")
+		} else if p.Show == nil || p.Show(name) {
+			files = append(files, name)
+		}
+	}
+	p.Entries = append(dirs, files...)
+	p.Select(0)
+}
+
+// Shown returns how many entries fit in the picker.
+func (p *Picker) Shown() int {
+	row := p.Style.RowHeight()
+	return max(1, (p.Bounds.Dy()-p.Style.CaptionHeight-2*row)/row)
+}
+
+// Select selects the entry at index, scrolls to show it,
+// and previews it if it is an image.
+func (p *Picker) Select(index int) {
+	p.Index = max(0, min(index, len(p.Entries)-1))
+	if p.Index < p.Top {
+		p.Top = p.Index
+	}
+	if p.Index >= p.Top+p.Shown() {
+		p.Top = p.Index - p.Shown() + 1
+	}
+	p.Top = max(0, min(p.Top, len(p.Entries)-p.Shown()))
+	p.Preview = nil
+	if p.Index < len(p.Entries) && IsImageFile(p.Entries[p.Index]) {
+		p.Preview = p.LoadPreview(p.join(p.Dir, p.Entries[p.Index]))
+	}
+}
+
+// LoadPreview loads an image to preview, or returns nil if it can not be
+// loaded.
+func (p *Picker) LoadPreview(name string) *Surface {
+	if surface, ok := p.Previews[name]; ok {
+		return surface
+	}
+	from := FromName(name)
+	if p.FS != nil {
+		from = FromFS(p.FS, name)
+	}
+	surface, _ := LoadSurface(from)
+	p.Previews[name] = surface
+	return surface
+}
+
+// HasParent returns true if the directory has a parent to go to.
+// An FS has no parent of its root.
+func (p *Picker) HasParent() bool {
+	return p.FS == nil || p.Dir != "."
+}
+
+// Enter shows the directory.
+func (p *Picker) Enter(dir string) {
+	if p.FS != nil {
+		p.Dir = path.Clean(dir)
+	} else {
+		p.Dir = filepath.Clean(dir)
+	}
+	p.Filter = nil
+	p.Top = 0
+	p.Read()
+}
+
+// Picked returns the path picked when Enter is pressed, or the directory
+// to show ending in /.
+func (p *Picker) Picked() string {
+	typed := string(p.Filter)
+	if p.Index < len(p.Entries) {
+		entry := p.Entries[p.Index]
+		if dir, ok := strings.CutSuffix(entry, "/"); ok {
+			return p.join(p.Dir, dir) + "/"
+		}
+		if !p.Save || typed == "" || entry == typed {
+			return p.join(p.Dir, entry)
+		}
+	}
+	if !p.Save || typed == "" {
+		return ""
+	}
+	if filepath.Ext(typed) == "" {
+		typed += p.Ext
+	}
+	return p.join(p.Dir, typed)
+}
+
+// Choose opens the selected directory or picks the file.
+func (p *Picker) Choose() error {
+	picked := p.Picked()
+	switch {
+	case picked == "":
+		return MidgetOK
+	case strings.HasSuffix(picked, "/"):
+		p.Enter(picked)
+		return MidgetOK
+	case p.On(picked):
+		return Termination
+	default:
+		return MidgetOK
+	}
+}
+
+// EntryAt returns the index of the entry at the point, or -1 if none.
+func (p *Picker) EntryAt(at Point) int {
+	list := p.ListBounds()
+	if !at.In(list) {
+		return -1
+	}
+	index := p.Top + (at.Y-list.Min.Y)/p.Style.RowHeight()
+	if index >= len(p.Entries) {
+		return -1
+	}
+	return index
+}
+
+// ListBounds returns the bounds of the list of entries.
+func (p *Picker) ListBounds() Rectangle {
+	row := p.Style.RowHeight()
+	at := p.Bounds.Min.Add(image.Pt(0, p.Style.CaptionHeight+row))
+	return Bounds(at.X, at.Y, PickerListWidth, p.Shown()*row)
+}
+
+func (p *Picker) Update() error {
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	handled := len(keys) > 0
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyUp:
+			p.Select(p.Index - 1)
+		case ebiten.KeyDown:
+			p.Select(p.Index + 1)
+		case ebiten.KeyPageUp:
+			p.Select(p.Index - p.Shown())
+		case ebiten.KeyPageDown:
+			p.Select(p.Index + p.Shown())
+		case ebiten.KeyHome:
+			p.Select(0)
+		case ebiten.KeyEnd:
+			p.Select(len(p.Entries) - 1)
+		case ebiten.KeyEnter:
+			return p.Choose()
+		case ebiten.KeyEscape:
+			return Termination
+		case ebiten.KeyBackspace:
+			if len(p.Filter) == 0 && p.HasParent() {
+				p.Enter(p.join(p.Dir, ".."))
+			} else if len(p.Filter) > 0 {
+				p.Filter = p.Filter[:len(p.Filter)-1]
+				p.Read()
+			}
+		case ebiten.KeyF1, ebiten.KeyF2, ebiten.KeyF3, ebiten.KeyF4, ebiten.KeyF5,
+			ebiten.KeyF6, ebiten.KeyF7, ebiten.KeyF8, ebiten.KeyF9, ebiten.KeyF10,
+			ebiten.KeyF11, ebiten.KeyF12, ebiten.KeyPause:
+			handled = false
+		default:
+		}
+	}
+
+	if p.Frames > 0 && !p.OpenerHeld() {
+		var chars []rune
+		chars = ActiveInput.AppendInputChars(chars)
+		if len(chars) > 0 {
+			p.Filter = append(p.Filter, chars...)
+			p.Read()
+			handled = true
+		}
+	}
+
+	if p.IsMouseIn() {
+		if _, dy := ActiveInput.Wheel(); dy != 0 {
+			p.Top = max(0, min(p.Top-int(dy), len(p.Entries)-p.Shown()))
+			handled = true
+		}
+		if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			if index := p.EntryAt(AbsoluteMouse()); index >= 0 {
+				p.Select(index)
+				return p.Choose()
+			}
+		}
+	}
+
+	err := p.Midget.Update()
+	if err != nil {
+		return err
+	}
+	if handled {
+		return MidgetOK
+	}
+	return nil
+}
+
+func (p Picker) Draw(s *Surface) {
+	p.Midget.Draw(s)
+	top := p.Bounds.Min.Add(image.Pt(p.Style.Padding, p.Style.CaptionHeight))
+	p.Style.DrawText(s, fmt.Sprintf("%s/>%s|", p.Dir, string(p.Filter)), top.X, top.Y)
+
+	list := p.ListBounds()
+	if p.Err != nil {
+		ActiveTheme.For(ClassError).DrawText(s, p.Err.Error(), list.Min.X+p.Style.Padding, list.Min.Y)
+	}
+	row := p.Style.RowHeight()
+	for i := p.Top; i < len(p.Entries) && i < p.Top+p.Shown(); i++ {
+		y := list.Min.Y + (i-p.Top)*row
+		style := p.Style
+		if i == p.Index {
+			style = DrawSelection(s, Bounds(list.Min.X, y, list.Dx(), row))
+		}
+		style.DrawRowText(s, p.Entries[i], list.Min.X, y)
+	}
+
+	view := Bounds(list.Max.X+4, list.Min.Y, p.Bounds.Max.X-list.Max.X-8, list.Dy()-row)
+	if p.Preview == nil || view.Empty() {
+		return
+	}
+	size := p.Preview.Bounds().Size()
+	scale := min(2, float64(view.Dx())/float64(size.X), float64(view.Dy())/float64(size.Y))
+	opts := ebiten.DrawImageOptions{}
+	opts.GeoM.Scale(scale, scale)
+	opts.GeoM.Translate(float64(view.Min.X), float64(view.Min.Y))
+	s.DrawImage(p.Preview, &opts)
+	p.Style.DrawText(s, fmt.Sprintf("%dx%d", size.X, size.Y), view.Min.X, view.Max.Y)
+}
+
+// PickFile asks to pick a file that show returns true for, starting in
+// the directory of def. ext is added to new names when saving.
+func (m *Midget) PickFile(prompt, def string, show func(string) bool, ext string, save bool, on func(string) bool) *Picker {
+	p := Pick(Bounds(40, 30, 460, 280), prompt, def, show, on)
+	p.Ext = ext
+	p.Save = save
+	if save {
+		p.Filter = []rune(filepath.Base(def))
+		p.Read()
+	}
+	m.Add(p)
+	return p
+}
@@ -0,0 +1,241 @@
+//go:build !headless
+
+package masite
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// PresenceField is a field of a presence that can be edited in the panel.
+type PresenceField struct {
+	Name    string
+	Get     func(p *Presence) string
+	Set     func(p *Presence, text string) error
+	Choices []string // If set the value is chosen from these.
+}
+
+func intField(name string, field func(p *Presence) *int) PresenceField {
+	return PresenceField{
+		Name: name,
+		Get:  func(p *Presence) string { return strconv.Itoa(*field(p)) },
+		Set: func(p *Presence, text string) error {
+			i, err := strconv.Atoi(text)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field(p) = i
+			return nil
+		},
+	}
+}
+
+func stringField(name string, field func(p *Presence) *string) PresenceField {
+	return PresenceField{
+		Name: name,
+		Get:  func(p *Presence) string { return *field(p) },
+		Set: func(p *Presence, text string) error {
+			*field(p) = text
+			return nil
+		},
+	}
+}
+
+// PresenceFields are all the fields of a Presence, in order.
+var PresenceFields = []PresenceField{
+	{
+		Name:    "kin",
+		Get:     func(p *Presence) string { return p.Kin.String() },
+		Set:     func(p *Presence, text string) error { return p.Kin.UnmarshalText([]byte(text)) },
+		Choices: KinNames(),
+	},
+	intField("x", func(p *Presence) *int { return &p.X }),
+	intField("y", func(p *Presence) *int { return &p.Y }),
+	intField("width", func(p *Presence) *int { return &p.Width }),
+	intField("height", func(p *Presence) *int { return &p.Height }),
+	intField("offset", func(p *Presence) *int { return &p.Offset }),
+	intField("frames", func(p *Presence) *int { return &p.Frames }),
+	intField("item", func(p *Presence) *int { return &p.Item }),
+	intField("money", func(p *Presence) *int { return &p.Money }),
+	stringField("talk", func(p *Presence) *string { return &p.Talk }),
+	stringField("basic", func(p *Presence) *string { return &p.Basic }),
+}
+
+// PresencePanel shows the fields of a presence of the map in the editor.
+// Enter or clicking on a field edits it.
+type PresencePanel struct {
+	Midget
+	Editor *Editor
+	Index  int // Index of the presence.
+	Cursor int // Index of the field.
+}
+
+func (p *PresencePanel) Presence() *Presence {
+	presences := p.Editor.Map.Presences
+	if p.Index < 0 || p.Index >= len(presences) {
+		return nil
+	}
+	return &presences[p.Index]
+}
+
+// Edit edits the field with the given index.
+func (p *PresencePanel) Edit(index int) {
+	presence := p.Presence()
+	if presence == nil {
+		return
+	}
+	e := p.Editor
+	field := PresenceFields[index]
+	x, y := p.Bounds.Max.X+4, p.Bounds.Min.Y+index*p.Style.RowHeight()
+	on := func(text string) bool {
+		// The presence may be removed, or the map replaced, while asking.
+		err := e.History.Try(e.Map, "edit presence", func() error {
+			presence := p.Presence()
+			if presence == nil {
+				return fmt.Errorf("presence %d is gone", p.Index)
+			}
+			return field.Set(presence, text)
+		})
+		e.Midget.Error(x+20, y+20, 250, 100, err)
+		return err == nil
+	}
+	if field.Choices != nil {
+		e.Midget.AskChoice(x, y, 120, field.Name, field.Choices, field.Get(presence), on)
+	} else {
+		e.Midget.Ask(x, y, 250, 100, field.Name, field.Get(presence), on)
+	}
+}
+
+func (p *PresencePanel) Update() error {
+	if p.Presence() == nil {
+		return Termination
+	}
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyUp:
+			p.Cursor = max(0, p.Cursor-1)
+		case ebiten.KeyDown:
+			p.Cursor = min(len(PresenceFields)-1, p.Cursor+1)
+		case ebiten.KeyEnter:
+			p.Edit(p.Cursor)
+		case ebiten.KeyEscape:
+			return Termination
+		default:
+		}
+	}
+
+	if p.IsMouseIn() && !p.IsMouseInCaption() &&
+		ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		index := p.RelativeMouse().Y / p.Style.RowHeight()
+		if index >= 0 && index < len(PresenceFields) {
+			p.Cursor = index
+			p.Edit(index)
+			return MidgetOK
+		}
+	}
+
+	err := p.Midget.Update()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return MidgetOK
+	}
+	return nil
+}
+
+func (p PresencePanel) Draw(s *Surface) {
+	presence := p.Presence()
+	if presence == nil {
+		return
+	}
+	p.Midget.Draw(s)
+	bounds := p.Bounds
+	if p.Caption.Text != "" {
+		bounds.Min.Y = p.Caption.Bounds.Max.Y
+	}
+	row := p.Style.RowHeight()
+	for i, field := range PresenceFields {
+		y := bounds.Min.Y + i*row
+		style := p.Style
+		if i == p.Cursor {
+			style = DrawSelection(s, image.Rect(bounds.Min.X, y, bounds.Max.X, y+row))
+		}
+		style.DrawRowText(s, field.Name+": "+field.Get(presence), bounds.Min.X, y)
+	}
+}
+
+// ShowPresencePanel shows the panel for the chosen presence.
+func (e *Editor) ShowPresencePanel() {
+	if e.Chosen < 0 || e.Chosen >= len(e.Map.Presences) {
+		e.ShowMessage("No presence chosen")
+		return
+	}
+	h := e.Midget.Style.CaptionHeight + len(PresenceFields)*e.Midget.Style.RowHeight()
+	panel := &PresencePanel{Midget: MakeMidget(Bounds(20, 20, 200, h)), Editor: e, Index: e.Chosen}
+	panel.SetCaption(fmt.Sprintf("Presence %d", e.Chosen))
+	e.Midget.Add(panel)
+}
+
+// PutPresence puts the presence of the editor at the hovered tile.
+func (e *Editor) PutPresence() {
+	err := e.History.PutPresence(e.Map, e.Tile, e.Presence)
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if err == nil {
+		e.Chosen = len(e.Map.Presences) - 1
+	}
+}
+
+// RemovePresence removes the chosen presence.
+func (e *Editor) RemovePresence() {
+	if e.Chosen < 0 || e.Chosen >= len(e.Map.Presences) {
+		return
+	}
+	e.History.RemovePresence(e.Map, e.Chosen)
+	e.Chosen = -1
+}
+
+// MapMouse returns the map pixel under the mouse.
+func (e *Editor) MapMouse() Point {
+	return e.Camera.Min.Add(e.Hover.Div(max(MinZoom, e.Zoom)))
+}
+
+// UpdatePresence chooses and drags presences with the mouse.
+// The drag is recorded as a single step in the history.
+func (e *Editor) UpdatePresence() {
+	at := e.MapMouse()
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		e.Chosen = e.Map.PresenceAt(at)
+		if e.Chosen < 0 {
+			return
+		}
+		chosen := e.Map.Presences[e.Chosen]
+		e.Grab = at.Sub(image.Pt(chosen.X, chosen.Y))
+		e.Moving = e.Map.TakeSnapshot()
+		return
+	}
+	if e.Moving == nil || e.Chosen < 0 || e.Chosen >= len(e.Map.Presences) {
+		return
+	}
+	if ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+		before := e.Moving
+		e.Moving = nil
+		chosen := e.Map.Presences[e.Chosen]
+		moved := before.Presences[e.Chosen]
+		if moved.X != chosen.X || moved.Y != chosen.Y {
+			e.History.Push(Step{Name: "move presence", Before: before, After: e.Map.TakeSnapshot()})
+		}
+		return
+	}
+	to := at.Sub(e.Grab)
+	e.Map.Presences[e.Chosen].X = max(0, to.X)
+	e.Map.Presences[e.Chosen].Y = max(0, to.Y)
+}
@@ -0,0 +1,174 @@
+//go:build !headless
+
+package masite
+
+import (
+	"image"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func (f Flag) Render(screen *Surface, bounds Rectangle) {
+
+	if f.Is(FlagOnTop) {
+		color := RGBA{R: 0, G: 127, B: 127, A: 128}
+		DrawRect(screen, bounds, 2, color)
+	}
+	if f.Is(FlagSolid) {
+		color := RGBA{R: 127, G: 127, B: 127, A: 240}
+		DrawRect(screen, bounds.Inset(2), 2, color)
+	}
+	if f.Is(FlagBless) {
+		color := RGBA{R: 255, G: 255, B: 0, A: 128}
+		DrawRect(screen, bounds.Inset(4), 2, color)
+	}
+
+	if f.Is(FlagHarm) {
+		color := RGBA{R: 255, G: 0, B: 0, A: 128}
+		DrawRect(screen, bounds.Inset(6), 2, color)
+	}
+}
+
+var blockColor = RGBA{R: 66, B: 66, G: 66, A: 0xaa}
+
+// var presenceColor = RGBA{R: 00, B: 66, G: 66, A: 0xaa}
+var presenceColor = RGBA{R: 240, B: 66, G: 66, A: 0xaa}
+
+func (m *Map) RenderPresences(screen *Surface, camera Rectangle) {
+
+	starty := camera.Min.Y / m.Th
+	if starty < 0 {
+		starty = 0
+	}
+
+	for _, presence := range m.Presences {
+
+		atx := presence.X - camera.Min.X
+		aty := presence.Y - camera.Min.Y
+
+		if m.Sprites.Surface == nil || m.Flags {
+			to := Bounds(atx, aty, m.Tw, m.Th)
+			FillRect(screen, to, presenceColor)
+			// draw colored rectangle if sprites are not available
+			// or if flags mode is set
+		}
+
+		if m.Sprites.Surface == nil {
+			continue
+		}
+
+		aty = aty - presence.Height + FeetHeight
+		// "shift up so the "feet" stand on the position of the presence.
+		ab := m.Sprites.Surface.Bounds()
+		tilew := ab.Dx() / m.Tw
+		id := presence.Offset
+		idx := id % tilew
+		idy := id / tilew
+		fx := idx * m.Tw
+		fy := idy * m.Th
+		from := image.Rect(fx, fy, fx+presence.Width, fy+presence.Height)
+		sub := m.Sprites.Surface.SubImage(from).(*Surface)
+		opts := ebiten.DrawImageOptions{}
+		opts.GeoM.Translate(float64(atx), float64(aty))
+		if sub != nil {
+			screen.DrawImage(sub, &opts)
+		}
+	}
+}
+
+// Render renders the visible layers of the map and the presences.
+func (m *Map) Render(screen *Surface, camera Rectangle) {
+	if !m.Base.Hidden {
+		m.RenderRows(screen, camera, m.Rows, false)
+	}
+	for _, layer := range m.Layers {
+		if layer.Hidden {
+			continue
+		}
+		if layer.Kind == FlagLayer {
+			m.RenderFlags(screen, camera, layer.Rows)
+		} else {
+			m.RenderRows(screen, camera, layer.Rows, true)
+		}
+	}
+	m.RenderPresences(screen, camera)
+}
+
+// RenderRows renders the tiles in rows.
+// If skipEmpty is set empty cells are not drawn, so lower layers show through.
+func (m *Map) RenderRows(screen *Surface, camera Rectangle, rows []Row, skipEmpty bool) {
+	ab := m.Surface.Bounds()
+
+	starty := camera.Min.Y / m.Th
+	if starty < 0 {
+		starty = 0
+	}
+	endy := min(camera.Max.Y/m.Th+1, len(rows))
+
+	// This draws the whole layer. Only draw visible part using a camera.
+	for ty := starty; ty < endy; ty++ {
+		row := rows[ty]
+
+		startx := max(camera.Min.X/m.Tw, 0)
+		endx := min(camera.Max.X/m.Tw+1, len(row.Cells))
+		for tx := startx; tx < endx; tx++ {
+			cell := row.Cells[tx]
+			if skipEmpty && cell.Empty() {
+				continue
+			}
+			id := int(cell.Index)
+			if cell.Flag&FlagExtended != 0 {
+				id += SMS_EXTENDED_MIN
+			}
+			tilew := ab.Dx() / m.Tw
+			idx := id % tilew
+			idy := id / tilew
+			fx := idx * m.Tw
+			fy := idy * m.Th
+
+			from := image.Rect(fx, fy, fx+m.Tw, fy+m.Th)
+			sub := m.Surface.SubImage(from).(*Surface)
+			opts := ebiten.DrawImageOptions{}
+			if cell.Flag&FlagHorizontalFlip != 0 {
+				opts.GeoM.Scale(-1, 1)
+				opts.GeoM.Translate(float64(m.Tw), 0)
+			}
+			if cell.Flag&FlagVerticalFlip != 0 {
+				opts.GeoM.Scale(1, -1)
+				opts.GeoM.Translate(0, float64(m.Th))
+			}
+
+			atx := int(tx)*m.Tw - camera.Min.X
+			aty := int(ty)*m.Th - camera.Min.Y
+
+			opts.GeoM.Translate(float64(atx), float64(aty))
+
+			if sub != nil {
+				screen.DrawImage(sub, &opts)
+			}
+
+			to := Bounds(atx, aty, m.Tw, m.Th)
+			if m.Flags {
+				cell.Flag.Render(screen, to)
+			}
+		}
+	}
+}
+
+// RenderFlags renders only the flags of the cells in rows.
+func (m *Map) RenderFlags(screen *Surface, camera Rectangle, rows []Row) {
+	starty := max(camera.Min.Y/m.Th, 0)
+	endy := min(camera.Max.Y/m.Th+1, len(rows))
+	for ty := starty; ty < endy; ty++ {
+		row := rows[ty]
+		startx := max(camera.Min.X/m.Tw, 0)
+		endx := min(camera.Max.X/m.Tw+1, len(row.Cells))
+		for tx := startx; tx < endx; tx++ {
+			atx := tx*m.Tw - camera.Min.X
+			aty := ty*m.Th - camera.Min.Y
+			row.Cells[tx].Flag.Render(screen, Bounds(atx, aty, m.Tw, m.Th))
+		}
+	}
+}
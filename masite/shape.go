@@ -0,0 +1,84 @@
+package masite
+
+import "image"
+
+// LinePoints returns the tiles on the straight line from from to to,
+// using Bresenham's algorithm.
+func LinePoints(from, to Point) []Point {
+	dx := abs(to.X - from.X)
+	dy := -abs(to.Y - from.Y)
+	sx, sy := 1, 1
+	if from.X > to.X {
+		sx = -1
+	}
+	if from.Y > to.Y {
+		sy = -1
+	}
+	res := []Point{}
+	at := from
+	err := dx + dy
+	for {
+		res = append(res, at)
+		if at == to {
+			return res
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			at.X += sx
+		}
+		if e2 <= dx {
+			err += dx
+			at.Y += sy
+		}
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// RectPoints returns the tiles of the rectangle with corners from and to,
+// both included. If filled is false only the border is returned.
+func RectPoints(from, to Point, filled bool) []Point {
+	r := image.Rectangle{Min: from, Max: to}.Canon()
+	res := []Point{}
+	for y := r.Min.Y; y <= r.Max.Y; y++ {
+		for x := r.Min.X; x <= r.Max.X; x++ {
+			border := x == r.Min.X || x == r.Max.X || y == r.Min.Y || y == r.Max.Y
+			if filled || border {
+				res = append(res, image.Pt(x, y))
+			}
+		}
+	}
+	return res
+}
+
+// PutPoints puts the cell at all the tiles, or only its flag if flagsOnly.
+func (m *Map) PutPoints(points []Point, cell Cell, flagsOnly bool) {
+	for _, at := range points {
+		if flagsOnly {
+			m.PutFlag(at, cell.Flag)
+		} else {
+			m.Put(at, cell)
+		}
+	}
+}
+
+// Replace replaces all cells in the active layer that are equal to from
+// by to. If flagsOnly, it replaces the flags of all cells with the flags
+// of from by those of to, whatever their tiles.
+func (m *Map) Replace(from, to Cell, flagsOnly bool) {
+	rows := m.ActiveRows()
+	for y := range rows {
+		for x := range rows[y].Cells {
+			cell := rows[y].Cells[x]
+			if cell == from || flagsOnly && cell.Flag == from.Flag {
+				m.PutPoints([]Point{image.Pt(x, y)}, to, flagsOnly)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package masite
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SheetCell returns the cell for the tile at x, y in the tile sheet.
+// Tiles past 255 use the extended flag.
+func (m *Map) SheetCell(x, y int) Cell {
+	perRow := 1
+	if m.Surface != nil {
+		perRow = max(1, m.Surface.Bounds().Dx()/m.Tw)
+	}
+	idx := max(0, x+y*perRow)
+	cell := Cell{}
+	if idx >= SMS_EXTENDED_MIN {
+		idx -= SMS_EXTENDED_MIN
+		cell.Flag |= FlagExtended
+	}
+	cell.Index = byte(idx)
+	return cell
+}
+
+// SheetBlock returns a block of the tiles in the rectangle r of the tile sheet.
+func (m *Map) SheetBlock(r Rectangle) *Block {
+	r = r.Canon()
+	b := NewBlock(r.Dx(), r.Dy())
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			b.Rows[y].Cells[x] = m.SheetCell(r.Min.X+x, r.Min.Y+y)
+		}
+	}
+	return b
+}
+
+// Stamp is a named block, for objects such as altars and doors
+// that are placed often.
+type Stamp struct {
+	Name  string `json:"name" xml:"name,attr"`
+	Block *Block `json:"block" xml:"block"`
+}
+
+// Stamps is a library of stamps for a tile set.
+type Stamps struct {
+	XMLName xml.Name `json:"-" xml:"stamps"`
+	Tileset string   `json:"tileset" xml:"tileset,attr"`
+	Stamps  []Stamp  `json:"stamps" xml:"stamp"`
+}
+
+// StampsSuffix ends the name of a stamp library before the extension.
+const StampsSuffix = ".stamps"
+
+// StampsName returns the name of the stamp library for the tile set from,
+// which is stored next to the map named mapName.
+// For example map/m0003-church.xml with tiles img/church.png
+// uses map/church.stamps.xml.
+func StampsName(mapName, from string) string {
+	base := filepath.Base(from)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(filepath.Dir(mapName), base+StampsSuffix+string(MasiteFormat))
+}
+
+// LoadStamps loads a stamp library.
+// If it does not exist yet an empty library is returned.
+func LoadStamps(name string) (*Stamps, error) {
+	res := &Stamps{}
+	buf, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = FormatFor(name).Unmarshal(buf, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Stamps) Save(name string) error {
+	buf, err := FormatFor(name).Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, buf, 0644)
+}
+
+// Find returns the stamp with the given name or nil if not found.
+func (s *Stamps) Find(name string) *Stamp {
+	for i := range s.Stamps {
+		if s.Stamps[i].Name == name {
+			return &s.Stamps[i]
+		}
+	}
+	return nil
+}
+
+// Add adds a stamp, replacing any stamp with the same name.
+func (s *Stamps) Add(name string, b *Block) {
+	if found := s.Find(name); found != nil {
+		found.Block = b
+		return
+	}
+	s.Stamps = append(s.Stamps, Stamp{Name: name, Block: b})
+}
+
+// Remove removes the stamp with the given name.
+func (s *Stamps) Remove(name string) {
+	s.Stamps = slices.DeleteFunc(s.Stamps, func(stamp Stamp) bool {
+		return stamp.Name == name
+	})
+}
+
+// Names returns the names of all stamps.
+func (s *Stamps) Names() []string {
+	res := []string{}
+	for _, stamp := range s.Stamps {
+		res = append(res, stamp.Name)
+	}
+	return res
+}
@@ -0,0 +1,288 @@
+//go:build !headless
+
+package masite
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Style classes, which a theme styles differently from other midgets.
+const (
+	ClassError    = "error"
+	ClassWarning  = "warning"
+	ClassInfo     = "info"
+	ClassSelected = "selected"
+)
+
+// StyleClasses are the classes a theme can style.
+var StyleClasses = []string{ClassError, ClassWarning, ClassInfo, ClassSelected}
+
+// Theme is the look of the midgets: the style of midgets without a class,
+// and the styles of the classes.
+type Theme struct {
+	Name    string
+	Style   Style
+	Classes map[string]Style
+}
+
+// For returns the style of a class, or the style of midgets without a
+// class if the theme does not style it.
+func (t *Theme) For(class string) Style {
+	if style, ok := t.Classes[class]; ok {
+		return style
+	}
+	return t.Style
+}
+
+// SetFont sets the font of all styles of the theme.
+func (t *Theme) SetFont(font *Font) {
+	t.Style.Font = font
+	for class, style := range t.Classes {
+		style.Font = font
+		t.Classes[class] = style
+	}
+}
+
+// ActiveTheme is the theme new midgets are styled with.
+// Editor.SetTheme changes it and restyles the editor.
+var ActiveTheme = DefaultTheme()
+
+// DefaultTheme is dark blue and translucent, so the map shows through.
+func DefaultTheme() *Theme {
+	s := Style{}
+	s.Cursor = RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x55}
+	s.Border = RGBA{R: 0x55, G: 0x55, B: 0x55, A: 0xff}
+	s.Shadow = RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xaa}
+	s.Filled = RGBA{R: 0x00, G: 0x00, B: 0x55, A: 0xaa}
+	s.Close = RGBA{R: 0xff, G: 0xaa, B: 0xaa, A: 0xaa}
+	s.Text = RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	s.Stroke = 1
+	s.Padding = 2
+	s.CaptionHeight = CaptionHeight
+	s.Font = DefaultFont
+
+	t := &Theme{Name: "default", Style: s, Classes: map[string]Style{}}
+	t.Classes[ClassError] = s.With(RGBA{R: 0x55, A: 0xaa}, RGBA{R: 0xff, G: 0xcc, B: 0xcc, A: 0xff})
+	t.Classes[ClassWarning] = s.With(RGBA{R: 0x55, G: 0x33, A: 0xaa}, RGBA{R: 0xff, G: 0xee, B: 0xaa, A: 0xff})
+	t.Classes[ClassInfo] = s.With(RGBA{G: 0x22, B: 0x55, A: 0xaa}, s.Text)
+	t.Classes[ClassSelected] = s.With(RGBA{}, s.Text)
+	return t
+}
+
+// HighContrastTheme is opaque black and white, with classes in colours
+// that can be told apart with colour blindness.
+func HighContrastTheme() *Theme {
+	black := RGBA{A: 0xff}
+	white := RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	s := Style{}
+	s.Cursor = RGBA{R: 0xf0, G: 0xe4, B: 0x42, A: 0xff}
+	s.Border = white
+	s.Shadow = black
+	s.Filled = black
+	s.Close = white
+	s.Text = white
+	s.Stroke = 2
+	s.Padding = 3
+	s.CaptionHeight = CaptionHeight + 2
+	s.Font = DefaultFont
+
+	t := &Theme{Name: "high-contrast", Style: s, Classes: map[string]Style{}}
+	t.Classes[ClassError] = s.With(RGBA{R: 0xd5, G: 0x5e, A: 0xff}, black)
+	t.Classes[ClassWarning] = s.With(RGBA{R: 0xe6, G: 0x9f, A: 0xff}, black)
+	t.Classes[ClassInfo] = s.With(RGBA{G: 0x72, B: 0xb2, A: 0xff}, white)
+	selected := s.With(s.Cursor, black)
+	selected.Cursor = white
+	t.Classes[ClassSelected] = selected
+	return t
+}
+
+// Themes are the built-in themes by name.
+var Themes = map[string]func() *Theme{
+	"default":       DefaultTheme,
+	"high-contrast": HighContrastTheme,
+}
+
+// With returns the style with other fill and text colours.
+func (s Style) With(filled, text RGBA) Style {
+	s.Filled = filled
+	s.Text = text
+	return s
+}
+
+// ThemeStyle is a style in a theme file. Fields that are not set keep the
+// value of the style it is applied to. Colours are #rgb, #rrggbb or
+// #rrggbbaa, not premultiplied, as in CSS.
+type ThemeStyle struct {
+	Cursor  string `json:"cursor,omitempty"`
+	Border  string `json:"border,omitempty"`
+	Shadow  string `json:"shadow,omitempty"`
+	Filled  string `json:"filled,omitempty"`
+	Close   string `json:"close,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Stroke  *int   `json:"stroke,omitempty"`
+	Padding *int   `json:"padding,omitempty"`
+	Caption *int   `json:"caption,omitempty"` // Height of captions.
+}
+
+// Apply returns the style with the fields of the theme style that are set.
+func (t ThemeStyle) Apply(s Style) (Style, error) {
+	colours := []struct {
+		from string
+		to   *RGBA
+	}{
+		{t.Cursor, &s.Cursor}, {t.Border, &s.Border}, {t.Shadow, &s.Shadow},
+		{t.Filled, &s.Filled}, {t.Close, &s.Close}, {t.Text, &s.Text},
+	}
+	for _, c := range colours {
+		if c.from == "" {
+			continue
+		}
+		col, err := ParseColour(c.from)
+		if err != nil {
+			return s, err
+		}
+		*c.to = col
+	}
+	sizes := []struct {
+		name string
+		from *int
+		to   *int
+	}{
+		{"stroke", t.Stroke, &s.Stroke}, {"padding", t.Padding, &s.Padding},
+		{"caption", t.Caption, &s.CaptionHeight},
+	}
+	for _, size := range sizes {
+		if size.from == nil {
+			continue
+		}
+		if *size.from < 0 {
+			return s, fmt.Errorf("%s %d is negative", size.name, *size.from)
+		}
+		*size.to = *size.from
+	}
+	return s, nil
+}
+
+// ParseColour parses a colour written as #rgb, #rrggbb or #rrggbbaa.
+func ParseColour(s string) (RGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if !ok || len(hex) != 8 || err != nil {
+		return RGBA{}, fmt.Errorf("colour %q is not #rgb, #rrggbb or #rrggbbaa", s)
+	}
+	col := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(col).(RGBA), nil
+}
+
+// ThemeFile is a theme as stored in a JSON file, for example:
+//
+//	{
+//		"name": "bright",
+//		"base": "high-contrast",
+//		"font": "font8x8.png",
+//		"style": {"filled": "#202020", "stroke": 1, "caption": 20},
+//		"classes": {"selected": {"filled": "#0072b2", "text": "#fff"}}
+//	}
+//
+// It changes the base theme, default if not set. The colours of the
+// classes are those of the base theme unless they are set in classes, the
+// other fields of style apply to the classes too.
+type ThemeFile struct {
+	Name       string                `json:"name"`
+	Base       string                `json:"base,omitempty"`
+	Font       string                `json:"font,omitempty"`        // Image of a font, see LoadFont.
+	FontWidth  int                   `json:"font_width,omitempty"`  // 8 if not set.
+	FontHeight int                   `json:"font_height,omitempty"` // 8 if not set.
+	Style      ThemeStyle            `json:"style"`
+	Classes    map[string]ThemeStyle `json:"classes,omitempty"`
+}
+
+// Theme makes the theme of the file. The font is loaded relative to dir.
+func (f ThemeFile) Theme(dir string) (*Theme, error) {
+	base, ok := Themes[f.Base]
+	if f.Base == "" {
+		base, ok = DefaultTheme, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown base theme %q", f.Base)
+	}
+	theme := base()
+	if f.Name != "" {
+		theme.Name = f.Name
+	}
+	style, err := f.Style.Apply(theme.Style)
+	if err != nil {
+		return nil, fmt.Errorf("style: %w", err)
+	}
+	theme.Style = style
+	for class, cstyle := range theme.Classes {
+		cstyle.Stroke, cstyle.Padding, cstyle.CaptionHeight = style.Stroke, style.Padding, style.CaptionHeight
+		theme.Classes[class] = cstyle
+	}
+	for class, tstyle := range f.Classes {
+		if !slices.Contains(StyleClasses, class) {
+			return nil, fmt.Errorf("unknown style class %q, expected one of %s",
+				class, strings.Join(StyleClasses, ", "))
+		}
+		cstyle, err := tstyle.Apply(theme.For(class))
+		if err != nil {
+			return nil, fmt.Errorf("class %s: %w", class, err)
+		}
+		theme.Classes[class] = cstyle
+	}
+	if f.Font != "" {
+		name := f.Font
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		font, err := LoadFont(FromName(name), cmp.Or(f.FontWidth, 8), cmp.Or(f.FontHeight, 8))
+		if err != nil {
+			return nil, fmt.Errorf("font: %w", err)
+		}
+		theme.SetFont(font)
+	}
+	return theme, nil
+}
+
+// LoadTheme returns the built-in theme with the name, or loads a theme
+// file.
+func LoadTheme(name string) (*Theme, error) {
+	if theme, ok := Themes[name]; ok {
+		return theme(), nil
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	file := ThemeFile{}
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if file.Name == "" {
+		file.Name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	theme, err := file.Theme(filepath.Dir(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return theme, nil
+}
+
+// IsThemeFile returns true if the named file may be a theme file.
+func IsThemeFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".json")
+}
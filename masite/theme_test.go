@@ -0,0 +1,134 @@
+//go:build !headless
+
+package masite
+
+import (
+	"testing"
+)
+
+func TestParseColour(t *testing.T) {
+	tests := []struct {
+		text string
+		want RGBA
+		err  bool
+	}{
+		{"#fff", RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, false},
+		{"#f80", RGBA{R: 0xff, G: 0x88, B: 0x00, A: 0xff}, false},
+		{"#102030", RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xff}, false},
+		{"#10203080", RGBA{R: 0x08, G: 0x10, B: 0x18, A: 0x80}, false}, // premultiplied.
+		{"#00000000", RGBA{}, false},
+		{"fff", RGBA{}, true},
+		{"#ff", RGBA{}, true},
+		{"#12345", RGBA{}, true},
+		{"#ggg", RGBA{}, true},
+		{"#1020304050", RGBA{}, true},
+		{"", RGBA{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseColour(tt.text)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseColour(%q) error %v, want error %t", tt.text, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseColour(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestThemeStyleApply(t *testing.T) {
+	base := DefaultTheme().Style
+	one, negative := 1, -1
+	tests := []struct {
+		name  string
+		style ThemeStyle
+		want  func(s *Style)
+		err   bool
+	}{
+		{"empty", ThemeStyle{}, func(s *Style) {}, false},
+		{"colours", ThemeStyle{Filled: "#000", Text: "#ff0000"}, func(s *Style) {
+			s.Filled = RGBA{A: 0xff}
+			s.Text = RGBA{R: 0xff, A: 0xff}
+		}, false},
+		{"sizes", ThemeStyle{Stroke: &one, Padding: &one, Caption: &one}, func(s *Style) {
+			s.Stroke, s.Padding, s.CaptionHeight = 1, 1, 1
+		}, false},
+		{"bad colour", ThemeStyle{Border: "blue"}, nil, true},
+		{"negative stroke", ThemeStyle{Stroke: &negative}, nil, true},
+		{"negative padding", ThemeStyle{Padding: &negative}, nil, true},
+		{"negative caption", ThemeStyle{Caption: &negative}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.style.Apply(base)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := base
+		tt.want(&want)
+		if got != want {
+			t.Errorf("%s: style %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+func TestThemeFileTheme(t *testing.T) {
+	one, negative := 1, -1
+	blue := RGBA{G: 0x72, B: 0xb2, A: 0xff}
+	tests := []struct {
+		name string
+		file ThemeFile
+		want func(theme *Theme) // Changes the base theme to the wanted one.
+		err  bool
+	}{
+		{"default", ThemeFile{}, func(theme *Theme) {}, false},
+		{"name and base", ThemeFile{Name: "mine", Base: "high-contrast"}, func(theme *Theme) {
+			*theme = *HighContrastTheme()
+			theme.Name = "mine"
+		}, false},
+		{"sizes apply to the classes", ThemeFile{Style: ThemeStyle{Stroke: &one, Filled: "#000"}},
+			func(theme *Theme) {
+				theme.Style.Stroke = 1
+				theme.Style.Filled = RGBA{A: 0xff}
+				for class, style := range theme.Classes {
+					style.Stroke = 1
+					theme.Classes[class] = style
+				}
+			}, false},
+		{"class override", ThemeFile{Base: "high-contrast",
+			Classes: map[string]ThemeStyle{ClassSelected: {Filled: "#0072b2"}}},
+			func(theme *Theme) {
+				*theme = *HighContrastTheme()
+				selected := theme.Classes[ClassSelected]
+				selected.Filled = blue
+				theme.Classes[ClassSelected] = selected
+			}, false},
+		{"unknown base", ThemeFile{Base: "neon"}, nil, true},
+		{"unknown class", ThemeFile{Classes: map[string]ThemeStyle{"title": {}}}, nil, true},
+		{"bad class colour", ThemeFile{Classes: map[string]ThemeStyle{ClassInfo: {Text: "#12"}}}, nil, true},
+		{"negative padding", ThemeFile{Style: ThemeStyle{Padding: &negative}}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.file.Theme("")
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := DefaultTheme()
+		tt.want(want)
+		if got.Name != want.Name || got.Style != want.Style {
+			t.Errorf("%s: theme %s %+v, want %s %+v", tt.name, got.Name, got.Style, want.Name, want.Style)
+		}
+		for _, class := range StyleClasses {
+			if got.For(class) != want.For(class) {
+				t.Errorf("%s: class %s %+v, want %+v", tt.name, class, got.For(class), want.For(class))
+			}
+		}
+	}
+}
@@ -4,28 +4,64 @@ import "text/scanner"
 import "bytes"
 import "strconv"
 import "fmt"
+import "errors"
+import "slices"
+import "strings"
+import "os"
 
 type TilaFunc = func(t *Tila, args ...any) any
 
+// Tila is a small command language to script the editor.
+// A statement is either a command with arguments, name arg arg,
+// an assignment, name = expression, or one of if, while, for, proc,
+// return, break and continue. See the README for the syntax.
 type Tila struct {
 	scanner.Scanner
 	Env       map[Ident]any
+	Scopes    []map[Ident]any // Variables of the procs being called.
 	Commands  map[Ident]TilaFunc
 	Operators map[Operator]TilaFunc
 	In        *bytes.Buffer
 	Out       *bytes.Buffer
 	Err       *bytes.Buffer
+	Depth     int // Calls being run, one inside the other.
+	MaxDepth  int // Most calls inside each other, such as of a recursive proc.
+	MaxLoops  int // Most rounds of a while or for loop, 0 for no limit.
 }
 
+// TilaMaxDepth is the default MaxDepth.
+const TilaMaxDepth = 1000
+
+// TilaMaxLoops is the default MaxLoops, so a loop that does not end
+// stops in about a second.
+const TilaMaxLoops = 1000000
+
+// TilaMaxList is the most ints range returns.
+const TilaMaxList = 1 << 20
+
 func NewTila() *Tila {
 	res := &Tila{}
 	res.In = &bytes.Buffer{}
 	res.Out = &bytes.Buffer{}
 	res.Err = &bytes.Buffer{}
+	res.MaxDepth = TilaMaxDepth
+	res.MaxLoops = TilaMaxLoops
 	res.Env = make(map[Ident]any)
 	res.Commands = make(map[Ident]TilaFunc)
 	res.Operators = make(map[Operator]TilaFunc)
 	res.Scanner.Whitespace = 1<<'\t' | 1<<' '
+	res.Commands["get"] = (*Tila).Get
+	res.Commands["set"] = (*Tila).Set
+	res.Commands["help"] = (*Tila).Help
+	res.Commands["print"] = (*Tila).Print
+	res.Commands["len"] = TilaCommand(TilaLen)
+	res.Commands["range"] = TilaCommand(TilaRange)
+	res.Commands["append"] = TilaCommand(TilaAppend)
+	res.Commands["source"] = TilaCommand((*Tila).Source)
+	res.Operators["$"] = (*Tila).Get
+	for _, op := range []Operator{"+", "-", "*", "/", "%", "!", "==", "!=", "<", "<=", ">", ">="} {
+		res.Operators[op] = TilaOperator
+	}
 	return res
 }
 
@@ -52,8 +88,7 @@ func Value(token rune, text string) (res any) {
 		return v
 	case scanner.Ident:
 		return Ident(text)
-	case scanner.String:
-		return
+	case scanner.String, scanner.Char:
 		v, err := strconv.Unquote(text)
 		if err != nil {
 			return err
@@ -84,109 +119,117 @@ func (t *Tila) Exec(line []any) any {
 		if cmd, ok := t.Commands[ident]; ok {
 			return cmd(t, line...)
 		} else {
-			return fmt.Errorf("unknown command :%s", string(ident))
+			return fmt.Errorf("unknown command: %s", string(ident))
 		}
 	}
 	if oper, ok := name.(Operator); ok {
 		if cmd, ok := t.Operators[oper]; ok {
 			return cmd(t, line...)
 		} else {
-			return fmt.Errorf("unknown operator :%s", string(oper))
+			return fmt.Errorf("unknown operator: %s", string(oper))
 		}
 	}
 	return name
 }
 
+// Run parses and runs the script. It returns the results of the
+// statements, or the first error, which is also written to Err, unless
+// Run is called by a command, such as source, so it is written once.
+// The results that are not nil are written to Out.
 func (t *Tila) Run(script string) any {
-	t.Scanner.Init(bytes.NewBuffer([]byte(script)))
-	t.Scanner.Whitespace = 1<<'\t' | 1<<' '
-	line := []any{}
+	block, err := t.Parse(script)
+	if err != nil {
+		t.report(err)
+		return err
+	}
 	all := []any{}
-	minus := false
-	for token := t.Scanner.Scan(); token != scanner.EOF; token = t.Scanner.Scan() {
-		if token == '\n' || token == '\r' && len(line) > 0 {
-			res := t.Exec(line)
-			if err, isErr := res.(error); isErr {
-				fmt.Fprintf(t.Err, "%s: %s\n", t.Scanner.Pos(), err)
-				return err
-			} else {
-				all = append(all, res)
-				fmt.Fprintf(t.Out, "%v\n", res)
-			}
-			line = []any{}
-		} else if token == '-' {
-			minus = true
-		} else {
-			val := Value(token, t.Scanner.TokenText())
-			if minus {
-				minus = false
-				ival, ok := val.(int)
-				if ok {
-					line = append(line, -ival)
-				} else {
-					line = append(line, Operator("-"), val)
-				}
-			} else {
-				line = append(line, val)
-			}
+	for _, stmt := range block.Statements {
+		res, err := stmt.Eval(t)
+		var ret *tilaReturn
+		if errors.As(err, &ret) {
+			res, err = ret.Value, nil
 		}
-	}
-	if len(line) > 0 {
-		res := t.Exec(line)
-		if err, isErr := res.(error); isErr {
-			fmt.Fprintf(t.Err, "%s: %s\n", t.Scanner.Pos(), err)
+		if err != nil {
+			err = tilaErrorAt(stmt, err)
+			t.report(err)
 			return err
-		} else {
-			all = append(all, res)
-			fmt.Fprintf(t.Out, "%v\n", res)
+		}
+		all = append(all, res)
+		if res != nil {
+			fmt.Fprintf(t.Out, "%s\n", tilaFormat(res))
+		}
+		if ret != nil {
+			break
 		}
 	}
-
 	return all
 }
 
-func TilaArg[T any](args []any) (T, error) {
-	var zero T
-	if len(args) < 2 {
-		return zero, fmt.Errorf("%s: needs 1 argument", args[0])
-	}
-	if val, ok := args[1].(T); ok {
-		return val, nil
-	} else {
-		return zero, fmt.Errorf("%s: variable type not correct: %v expect %T",
-			args[0], args[1], zero)
+// RunFile runs the script in the named file like Run.
+// Positions in errors have the name of the file.
+func (t *Tila) RunFile(name string) any {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.report(err)
+		return err
 	}
+	filename := t.Scanner.Filename
+	t.Scanner.Filename = name
+	defer func() { t.Scanner.Filename = filename }()
+	return t.Run(string(buf))
 }
 
-func TilaArg2[T, U any](args []any) (T, U, error) {
-	var zero1 T
-	var zero2 U
+// Source runs the script file given as argument in the same variables
+// and commands, so it can define procs.
+func (t *Tila) Source(name string) error {
+	if res := t.RunFile(name); tilaIsError(res) {
+		return res.(error)
+	}
+	return nil
+}
 
-	var r1 T
-	var r2 U
-	if len(args) < 3 {
-		return zero1, zero2, fmt.Errorf("%s: needs 1 argument", args[0])
+// report writes the error to Err, unless a command is being run, which
+// returns the error to the Run that called it.
+func (t *Tila) report(err error) {
+	if t.Depth == 0 {
+		fmt.Fprintf(t.Err, "%s\n", err)
 	}
-	if val, ok := args[1].(T); ok {
-		r1 = val
-	} else {
-		return zero1, zero2, fmt.Errorf("%s: variable type not correct: %v expect %T",
-			args[0], args[1], zero1)
+}
+
+func tilaIsError(res any) bool {
+	_, ok := res.(error)
+	return ok
+}
+
+// Lookup returns the variable of the innermost proc being called,
+// or the global variable.
+func (t *Tila) Lookup(name Ident) (any, bool) {
+	if len(t.Scopes) > 0 {
+		if val, ok := t.Scopes[len(t.Scopes)-1][name]; ok {
+			return val, true
+		}
 	}
-	if val, ok := args[2].(U); ok {
-		r2 = val
-	} else {
-		return zero1, zero2, fmt.Errorf("%s: variable type not correct: %v expect %T",
-			args[0], args[1], zero2)
+	val, ok := t.Env[name]
+	return val, ok
+}
+
+// Assign sets the variable in the innermost proc being called,
+// unless it is a global variable, or sets the global variable.
+func (t *Tila) Assign(name Ident, val any) {
+	if len(t.Scopes) > 0 {
+		if _, global := t.Env[name]; !global {
+			t.Scopes[len(t.Scopes)-1][name] = val
+			return
+		}
 	}
-	return r1, r2, nil
+	t.Env[name] = val
 }
 
 func (t *Tila) Set(args ...any) any {
 	if ident, val, err := TilaArg2[Ident, any](args); err != nil {
 		return err
 	} else {
-		t.Env[ident] = val
+		t.Assign(ident, val)
 		return val
 	}
 }
@@ -195,10 +238,65 @@ func (t *Tila) Get(args ...any) any {
 	if ident, err := TilaArg[Ident](args); err != nil {
 		return err
 	} else {
-		if val, ok := t.Env[ident]; ok {
+		if val, ok := t.Lookup(ident); ok {
 			return val
 		} else {
-			return fmt.Errorf("get: variable not set: %v", args[1])
+			return fmt.Errorf("variable not set: %v", args[1])
+		}
+	}
+}
+
+// Help lists the available commands.
+func (t *Tila) Help(args ...any) any {
+	names := []string{}
+	for name := range t.Commands {
+		names = append(names, string(name))
+	}
+	slices.Sort(names)
+	return "available commands: " + strings.Join(names, ", ")
+}
+
+// Print writes its arguments to Out, separated by spaces.
+func (t *Tila) Print(args ...any) any {
+	parts := []string{}
+	for _, arg := range args[1:] {
+		parts = append(parts, tilaFormat(arg))
+	}
+	fmt.Fprintf(t.Out, "%s\n", strings.Join(parts, " "))
+	return nil
+}
+
+// TilaLen returns the length of a list or a string.
+func TilaLen(val any) (int, error) {
+	switch v := val.(type) {
+	case []any:
+		return len(v), nil
+	case string:
+		return len(v), nil
+	default:
+		return 0, fmt.Errorf("not a list or string: %s", tilaDescribe(val))
+	}
+}
+
+// TilaRange returns a list of ints: range to, range from to, or
+// range from to step.
+func TilaRange(ints ...int) ([]any, error) {
+	switch len(ints) {
+	case 1:
+		return tilaRange(0, ints[0], 1)
+	case 2:
+		return tilaRange(ints[0], ints[1], 1)
+	case 3:
+		if ints[2] == 0 {
+			return nil, fmt.Errorf("step may not be 0")
 		}
+		return tilaRange(ints[0], ints[1], ints[2])
+	default:
+		return nil, fmt.Errorf("needs 1 to 3 arguments")
 	}
 }
+
+// TilaAppend returns a new list with the items appended to the list.
+func TilaAppend(list []any, items ...any) []any {
+	return append(append([]any{}, list...), items...)
+}
@@ -0,0 +1,447 @@
+package masite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestTilaLex(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{"wrap -2", []string{"wrap", "-", "2"}},
+		{"x == y != z", []string{"x", "==", "y", "!=", "z"}},
+		{"a<=b>=c<d", []string{"a", "<=", "b", ">=", "c", "<", "d"}},
+		{"a && b || !c", []string{"a", "&&", "b", "||", "!", "c"}},
+		{"print \"a b\"\r\nx", []string{"print", "\"a b\"", "\n", "x"}},
+		{"l[0]; $x", []string{"l", "[", "0", "]", ";", "$", "x"}},
+		{"f(1.5, 'c') // comment", []string{"f", "(", "1.5", ",", "'c'", ")"}},
+	}
+	for _, tt := range tests {
+		tokens, err := NewTila().Lex(tt.script)
+		if err != nil {
+			t.Errorf("Lex(%q): %v", tt.script, err)
+			continue
+		}
+		got := []string{}
+		for _, tok := range tokens {
+			if tok.Kind != scanner.EOF {
+				got = append(got, tok.Text)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lex(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestTilaLexPositions(t *testing.T) {
+	tokens, err := NewTila().Lex("set x 1\n  put 2 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"set": "1:1", "x": "1:5", "put": "2:3", "3": "2:9"}
+	for _, tok := range tokens {
+		if at, ok := want[tok.Text]; ok && fmt.Sprintf("%d:%d", tok.At.Line, tok.At.Column) != at {
+			t.Errorf("%s at %s, want %s", tok.Text, tok.At, at)
+		}
+	}
+}
+
+// The positions in the errors are those of scripts without a file name,
+// which are reported as <input>.
+func TestTilaParseErrors(t *testing.T) {
+	tests := []struct {
+		script     string
+		want       string
+		incomplete bool
+	}{
+		{"if x > 1 {", "1:11: missing }", true},
+		{"print (1 + 2", "1:13: expected ), got end of script", true},
+		{"l = [1, 2", "1:10: expected , or ], got end of script", true},
+		{"x = 1 +", "1:8: unexpected end of script", true},
+		{"print \"abc", "1:11: literal not terminated", false},
+		{"}", "1:1: unexpected }", false},
+		{"for 1 in l {}", "1:5: expected a name, got 1", false},
+		{"for i of l {}", "1:7: expected in, got of", false},
+		{"proc if {}", "1:6: expected a name, got if", false},
+		{"print 1 + 2", "1:9: operator + in the arguments of a command needs parentheses, as in (a + b)", false},
+		{"wrap $x - 1", "1:9: operator - in the arguments of a command needs parentheses, as in (a - b)", false},
+		{"wrap $x-1", "1:8: operator - in the arguments of a command needs parentheses, as in (a - b)", false},
+		{"x = (1 + 2) )", "1:13: unexpected )", false},
+	}
+	for _, tt := range tests {
+		_, err := NewTila().Parse(tt.script)
+		if err == nil {
+			t.Errorf("Parse(%q): no error, want %s", tt.script, tt.want)
+			continue
+		}
+		if err.Error() != "<input>:"+tt.want {
+			t.Errorf("Parse(%q): %s, want %s", tt.script, err, tt.want)
+		}
+		if IsIncomplete(err) != tt.incomplete {
+			t.Errorf("Parse(%q): incomplete %t, want %t", tt.script, IsIncomplete(err), tt.incomplete)
+		}
+	}
+}
+
+// runTila runs the script in a new Tila and returns its output.
+func runTila(t *testing.T, script string) (string, error) {
+	t.Helper()
+	tila := NewTila()
+	res := tila.Run(script)
+	err, _ := res.(error)
+	return strings.TrimSuffix(tila.Out.String(), "\n"), err
+}
+
+func TestTilaEval(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"7 / 2; 7 % 2; 7.0 / 2", "3\n1\n3.5"},
+		{"-3 - -2", "-1"},
+		{"x = 4; -x", "4\n-4"},
+		{"1 < 2 && 2 <= 2", "true"},
+		{"0 || \"a\"", "a"},
+		{"!0 == true", "true"},
+		{"\"a\" + 1 + 'b'", "a1b"},
+		{"\"abc\" < \"abd\"", "true"},
+		{"[1, 2] + [3]", "[1, 2, 3]"},
+		{"l = [1, \"a\", [2]]; l[1]; l[2][0]", "[1, \"a\", [2]]\na\n2"},
+		{"s = \"tila\"; s[3]", "tila\na"},
+		{"set x 5; print $x; y = x * 2", "5\n5\n10"},
+		{"x = 1; if x > 1 { print big } elif x == 1 { print one } else { print small }", "1\none"},
+		{"x = 0\nif x {\n  print yes\n}\nelse {\n  print no\n}", "0\nno"},
+		{"i = 0; while i < 3 { i = i + 1 }; i", "0\n3"},
+		{"t = 0; for i in range(1, 4) { t = t + i }; t", "0\n6"},
+		{"for c in \"ab\" { print $c }", "a\nb"},
+		{"for i in 5 { if i == 1 { continue }; if i == 3 { break }; print $i }", "0\n2"},
+		{"proc double n { return n * 2 }; double 4", "8"},
+		{"proc fact n { if n < 2 { return 1 }; return n * fact(n - 1) }; fact(5)", "120"},
+		{"n = 1; proc global { n = 2; return n }; global; n", "1\n2\n2"},
+		{"proc local a { b = a + 1; return b }; local 1; b = 5; local 2; b", "2\n5\n3\n3"},
+		{"proc noop {}; noop", ""},
+		{"x = 3; return x + 1; print no", "3\n4"},
+	}
+	for _, tt := range tests {
+		got, err := runTila(t, tt.script)
+		if err != nil {
+			t.Errorf("Run(%q): %v", tt.script, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestTilaErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"nothing 1", "1:1: unknown command: nothing"},
+		{"x = y + 1", "1:5: variable not set: y"},
+		{"print $y", "1:7: variable not set: y"},
+		{"x = 1 / 0", "1:7: operator /: division by zero"},
+		{"x = 1\nx = x + [1] * 2", "2:13: operator *: can not apply to [1] and 2"},
+		{"x = -\"a\"", "1:5: operator -: can not apply to a"},
+		{"l = [1, 2]\nprint $l[2]", "2:10: index 2 out of range 0-1"},
+		{"l = [1, 2]; l[\"a\"]", "1:15: index is not an int: string \"a\""},
+		{"x = 5; x[0]", "1:9: can not index int 5"},
+		{"for i in 1.5 {}", "1:10: for: can not loop over float 1.5"},
+		{"set x", "1:1: set: needs at least 2 arguments, got 1"},
+		{"get 1", "1:5: get: argument 1: expected word, got int 1"},
+		{"len 5", "1:1: len: not a list or string: int 5"},
+		{"range 1 \"a\"", "1:9: range: argument 2: expected int, got string \"a\""},
+		{"range 1 5 0", "1:1: range: step may not be 0"},
+		{"range 1000000000", "1:1: range: 1000000000 ints, at most 1048576 allowed"},
+		{"range -9223372036854775807 9223372036854775807", "1:1: range: 18446744073709551614 ints, at most 1048576 allowed"},
+		{"append 1 2", "1:8: append: argument 1: expected list, got int 1"},
+		{"append", "1:1: append: needs at least 1 argument, got 0"},
+		{"break", "1:1: break outside of loop"},
+		{"proc f { continue }\nwhile 1 { f }", "1:10: continue outside of loop"},
+		{"proc f a b { return a + b }\nf 1", "2:1: f: needs 2 arguments, got 1"},
+		{"proc f a {\n  return a / 0\n}\nx = f(1)", "2:12: operator /: division by zero"},
+		{"proc f a {\n  len $a\n}\nf [1]\nf 2", "2:3: len: not a list or string: int 2"},
+		{"proc f { m = 3 }; f; print $m", "1:28: variable not set: m"},
+		{"proc f a { b = a + 1 }; f 1; get b", "1:30: variable not set: b"},
+		{"proc f { f }; f", "1:10: f: calls nested deeper than 1000"},
+	}
+	for _, tt := range tests {
+		_, err := runTila(t, tt.script)
+		if err == nil {
+			t.Errorf("Run(%q): no error, want %s", tt.script, tt.want)
+			continue
+		}
+		if err.Error() != "<input>:"+tt.want {
+			t.Errorf("Run(%q): %s, want %s", tt.script, err, tt.want)
+		}
+		var terr *TilaError
+		if !errors.As(err, &terr) {
+			t.Errorf("Run(%q): %T is not a TilaError", tt.script, err)
+		}
+	}
+}
+
+func TestTilaLimits(t *testing.T) {
+	tila := NewTila()
+	tila.MaxLoops = 10
+	if _, ok := tila.Run("i = 0; while i < 10 { i = i + 1 }").([]any); !ok {
+		t.Errorf("10 rounds stopped at %s", tila.Err)
+	}
+	res := tila.Run("while 1 {}")
+	if err, ok := res.(error); !ok || err.Error() != "<input>:1:1: while: more than 10 rounds" {
+		t.Errorf("endless while: %v", res)
+	}
+	res = tila.Run("for i in 1000000000 {}")
+	if err, ok := res.(error); !ok || err.Error() != "<input>:1:1: for: more than 10 rounds" {
+		t.Errorf("for over a billion: %v", res)
+	}
+	if _, ok := tila.Run("for i in 10 {}; for c in \"0123456789\" {}").([]any); !ok {
+		t.Errorf("10 rounds of for stopped at %s", tila.Err)
+	}
+	if tila := NewTila(); tila.MaxLoops != TilaMaxLoops {
+		t.Errorf("MaxLoops %d by default, want %d", tila.MaxLoops, TilaMaxLoops)
+	}
+
+	name := filepath.Join(t.TempDir(), "self.tila")
+	if err := os.WriteFile(name, []byte("source "+strconv.Quote(name)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tila.MaxDepth = 5
+	res = tila.RunFile(name)
+	if err, ok := res.(error); !ok || !strings.HasSuffix(err.Error(), "source: calls nested deeper than 5") {
+		t.Errorf("file sourcing itself: %v", res)
+	}
+	if tila.Depth != 0 {
+		t.Errorf("depth %d after the calls, want 0", tila.Depth)
+	}
+}
+
+// TestTilaSourceErrorOutput writes an error in a sourced file, and of a
+// file that is not there, once.
+func TestTilaSourceErrorOutput(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "inner.tila")
+	if err := os.WriteFile(inner, []byte("print $nope\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{inner, filepath.Join(dir, "missing.tila")} {
+		tila := NewTila()
+		tila.Run("source " + strconv.Quote(name))
+		if lines := strings.Count(tila.Err.String(), "\n"); lines != 1 {
+			t.Errorf("source %s: %d lines of errors, want 1: %q", name, lines, tila.Err)
+		}
+	}
+}
+
+func TestTilaErrorOutput(t *testing.T) {
+	tila := NewTila()
+	tila.Scanner.Filename = "test.tila"
+	tila.Run("print 1\nprint $nope\nprint 3")
+	if got, want := tila.Out.String(), "1\n"; got != want {
+		t.Errorf("Out = %q, want %q", got, want)
+	}
+	if got, want := tila.Err.String(), "test.tila:2:7: variable not set: nope\n"; got != want {
+		t.Errorf("Err = %q, want %q", got, want)
+	}
+}
+
+func TestTilaCommand(t *testing.T) {
+	tila := NewTila()
+	tila.Commands["add"] = TilaCommand(func(x, y float64) float64 { return x + y })
+	tila.Commands["join"] = TilaCommand(func(sep string, words ...Ident) string {
+		parts := []string{}
+		for _, word := range words {
+			parts = append(parts, string(word))
+		}
+		return strings.Join(parts, sep)
+	})
+	tila.Commands["count"] = TilaCommand(func(t *Tila, list []any) (int, error) {
+		if len(list) == 0 {
+			return 0, errors.New("empty list")
+		}
+		return len(list), nil
+	})
+	tila.Commands["nothing"] = TilaCommand(func() {})
+	tests := []struct {
+		args []any
+		want any
+	}{
+		{[]any{Ident("add"), 1, 2.5}, 3.5},
+		{[]any{Ident("add"), 1}, "add: needs 2 arguments, got 1"},
+		{[]any{Ident("add"), 1, "2"}, "add: argument 2: expected float, got string \"2\""},
+		{[]any{Ident("join"), "-", Ident("a"), "b"}, "a-b"},
+		{[]any{Ident("join"), "-"}, ""},
+		{[]any{Ident("join")}, "join: needs at least 1 argument, got 0"},
+		{[]any{Ident("join"), "-", 1}, "join: argument 2: expected word, got int 1"},
+		{[]any{Ident("count"), []any{1, 2}}, 2},
+		{[]any{Ident("count"), []any{}}, "count: empty list"},
+		{[]any{Ident("count"), nil}, "count: empty list"},
+		{[]any{Ident("nothing")}, nil},
+	}
+	for _, tt := range tests {
+		got := tila.Exec(tt.args)
+		if err, ok := got.(error); ok {
+			got = err.Error()
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Exec(%v) = %#v, want %#v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestTilaArg(t *testing.T) {
+	args := []any{Ident("cmd"), Ident("word"), 2}
+	if name, n, err := TilaArg2[string, int](args); err != nil || name != "word" || n != 2 {
+		t.Errorf("TilaArg2 = %q %d %v", name, n, err)
+	}
+	_, _, err := TilaArg2[Ident, string](args)
+	var aerr *TilaArgError
+	if !errors.As(err, &aerr) || aerr.Index != 2 {
+		t.Errorf("TilaArg2 error %v, want an error in argument 2", err)
+	}
+	if _, err := TilaArg[int](args[:1]); err == nil || err.Error() != "cmd: needs at least 1 argument, got 0" {
+		t.Errorf("TilaArg error %v", err)
+	}
+}
+
+// newTilaTestMap returns an empty map for the map commands.
+func newTilaTestMap(w, h int) *Map {
+	return &Map{Width: w, Height: h, Tw: TW, Th: TH, Prefix: PRE, Rows: MakeRows(w, h)}
+}
+
+func TestTilaMap(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"put 1 2 5; get 1 2", "[5, \"\"]"},
+		{"put 1 2 300 HS; get 1 2", "[44, \"EHS\"]"},
+		{"put 0 0 [7, \"S\"]; get 0 0", "[7, \"S\"]"},
+		{"fill 1 1 2 2 3; get 2 2; get 3 3", "4\n[3, \"\"]\n[0, \"\"]"},
+		{"fill 2 2 9 9 1", "4"},
+		{"fill 0 0 4 4 1; replace 1 [1, \"S\"] flags; get 3 3", "16\n[1, \"S\"]"},
+		{"put 0 0 1; put 1 0 [2, \"S\"]; replace 3 [0, \"H\"] flags; get 0 0; get 1 0; get 2 0",
+			"[1, \"H\"]\n[2, \"S\"]\n[0, \"H\"]"},
+		{"put 0 0 9; wrap 1; get 3 0", "1\n[9, \"\"]"},
+		{"put 0 0 9; roll -1; get 0 1", "-1\n[9, \"\"]"},
+		{"resize 8 6; get 7 5", "8 6\n[0, \"\"]"},
+		{"presence add 1 1 door; presence add 2 2; presence count; presence remove 0; presence count", "0\n1\n2\n0\n1"},
+		{"prefix; prefix room", "map\nroom"},
+		{"x = 3; put $x 0 ($x + 1); y = get(x, 0)[0]", "3\n4"},
+	}
+	for _, tt := range tests {
+		m := newTilaTestMap(4, 4)
+		tila := NewMapTila(MapBinding{Map: func() *Map { return m }})
+		res := tila.Run(tt.script)
+		if err, ok := res.(error); ok {
+			t.Errorf("Run(%q): %v", tt.script, err)
+			continue
+		}
+		if got := strings.TrimSuffix(tila.Out.String(), "\n"); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestTilaMapErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"get 9 9", "1:1: get: 9 9 outside of map"},
+		{"put 1 \"a\" 5", "1:7: put: argument 2: expected int, got string \"a\""},
+		{"put 1 1", "1:1: put: needs a cell"},
+		{"put 1 1 600", "1:9: put: argument 3: index out of range 0-511: 600"},
+		{"put 1 1 [1]", "1:9: put: argument 3: cell must be [index, flags]: [1]"},
+		{"fill 1 1 2", "1:1: fill: needs at least 4 arguments, got 3"},
+		{"wrap \"a\"", "1:6: wrap: argument 1: expected int, got string \"a\""},
+		{"resize 1 x", "1:10: resize: argument 2: expected int, got word x"},
+		{"resize 0 1", "1:1: resize: size must be positive: 0 1"},
+		{"resize 1 5000", "1:1: resize: size must be at most 1024: 1 5000"},
+		{"replace 1 2 all", "1:13: replace: argument 3: expected flags, got all"},
+		{"presence jump", "1:10: presence: argument 1: expected add, remove or count, got jump"},
+		{"presence add 1 x", "1:16: presence: argument 3: expected int, got word x"},
+		{"presence remove 3", "1:1: presence: no presence 3"},
+		{"offset 1000", "1:1: offset: out of range 0-447: 1000"},
+		{"select 0 0 1 1", "1:1: select: no selection here"},
+		{"load x", "1:1: load: not possible here"},
+	}
+	for _, tt := range tests {
+		m := newTilaTestMap(4, 4)
+		tila := NewMapTila(MapBinding{Map: func() *Map { return m }})
+		res := tila.Run(tt.script)
+		err, ok := res.(error)
+		if !ok {
+			t.Errorf("Run(%q): no error, want %s", tt.script, tt.want)
+			continue
+		}
+		if err.Error() != "<input>:"+tt.want {
+			t.Errorf("Run(%q): %s, want %s", tt.script, err, tt.want)
+		}
+	}
+}
+
+func TestTilaMapChange(t *testing.T) {
+	m := newTilaTestMap(4, 4)
+	changes := []string{}
+	tila := NewMapTila(MapBinding{
+		Map: func() *Map { return m },
+		Change: func(name string, op func() error) error {
+			changes = append(changes, name)
+			return op()
+		},
+	})
+	tila.Run("put 0 0 1; get 0 0; fill 0 0 2 2 2; wrap 1; prefix; prefix x; presence count")
+	if want := []string{"put", "fill", "wrap", "prefix"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes %q, want %q", changes, want)
+	}
+}
+
+func TestTilaMapUndo(t *testing.T) {
+	m := newTilaTestMap(4, 4)
+	h := &History{}
+	tila := NewMapTila(MapBinding{
+		Map:    func() *Map { return m },
+		Change: func(name string, op func() error) error { return h.Try(m, name, op) },
+	})
+	run := func(script string) {
+		h.Batch(func() *Map { return m }, script, func() { tila.Run(script) })
+	}
+	run("put 0 0 1; put 1 0 2; offset 10; prefix room")
+	run("presence count; get 0 0; offset")
+	run("put 9 9 1")
+	if len(h.Done) != 1 {
+		t.Fatalf("%d undo steps, want 1", len(h.Done))
+	}
+	tila.Run("put 2 0 3")
+	if len(h.Done) != 2 {
+		t.Fatalf("%d undo steps after a command outside a batch, want 2", len(h.Done))
+	}
+	h.Undo(m)
+	h.Undo(m)
+	if m.Get(image.Pt(0, 0)).Index != 0 || m.Offset != 0 || m.Prefix != PRE {
+		t.Errorf("undo left %v, offset %d, prefix %s", m.Get(image.Pt(0, 0)), m.Offset, m.Prefix)
+	}
+	h.Redo(m)
+	if m.Get(image.Pt(1, 0)).Index != 2 || m.Offset != 10 || m.Prefix != "room" {
+		t.Errorf("redo left %v, offset %d, prefix %s", m.Get(image.Pt(1, 0)), m.Offset, m.Prefix)
+	}
+	if len(h.Undone) != 1 {
+		t.Errorf("%d redo steps, want 1", len(h.Undone))
+	}
+}
@@ -0,0 +1,218 @@
+package masite
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// TilaArgError is an error in the arguments of a command. Index counts
+// from 1 like the args of a TilaFunc, and is 0 if the number of
+// arguments is wrong, so the error can be reported at the argument.
+type TilaArgError struct {
+	Command any
+	Index   int
+	Msg     string
+}
+
+func (e *TilaArgError) Error() string {
+	if e.Index < 1 {
+		return fmt.Sprintf("%s: %s", e.Command, e.Msg)
+	}
+	return fmt.Sprintf("%s: argument %d: %s", e.Command, e.Index, e.Msg)
+}
+
+// tilaCount returns an error for a wrong number of arguments.
+func tilaCount(args []any, need int, variadic bool) error {
+	got := len(args) - 1
+	if got == need || variadic && got > need {
+		return nil
+	}
+	words := "arguments"
+	if need == 1 {
+		words = "argument"
+	}
+	if variadic {
+		return &TilaArgError{Command: args[0], Msg: fmt.Sprintf("needs at least %d %s, got %d", need, words, got)}
+	}
+	return &TilaArgError{Command: args[0], Msg: fmt.Sprintf("needs %d %s, got %d", need, words, got)}
+}
+
+var (
+	tilaIdentType = reflect.TypeFor[Ident]()
+	tilaErrorType = reflect.TypeFor[error]()
+	tilaTilaType  = reflect.TypeFor[*Tila]()
+)
+
+// tilaConvert converts a value to the type of a parameter. Ints are also
+// floats, and bare words are also strings.
+func tilaConvert(val any, typ reflect.Type) (reflect.Value, bool) {
+	if val == nil {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Slice:
+			return reflect.Zero(typ), true
+		}
+		return reflect.Value{}, false
+	}
+	v := reflect.ValueOf(val)
+	if v.Type().AssignableTo(typ) {
+		res := reflect.New(typ).Elem()
+		res.Set(v)
+		return res, true
+	}
+	switch {
+	case typ.Kind() == reflect.Float64 && v.Kind() == reflect.Int:
+		return reflect.ValueOf(float64(v.Int())).Convert(typ), true
+	case typ.Kind() == reflect.String && v.Kind() == reflect.String:
+		return v.Convert(typ), true
+	}
+	return reflect.Value{}, false
+}
+
+// tilaTypeName is the name of a type as used in Tila.
+func tilaTypeName(typ reflect.Type) string {
+	switch {
+	case typ == nil:
+		return "nil"
+	case typ == tilaIdentType:
+		return "word"
+	case typ.Kind() == reflect.Int:
+		return "int"
+	case typ.Kind() == reflect.Float64:
+		return "float"
+	case typ.Kind() == reflect.String:
+		return "string"
+	case typ.Kind() == reflect.Bool:
+		return "bool"
+	case typ.Kind() == reflect.Slice:
+		return "list"
+	case typ.Kind() == reflect.Interface:
+		return "value"
+	default:
+		return typ.String()
+	}
+}
+
+// tilaDescribe describes a value with its type for errors.
+func tilaDescribe(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	default:
+		return tilaTypeName(reflect.TypeOf(val)) + " " + tilaFormat(val)
+	}
+}
+
+// tilaArgValue converts args[i] to typ, or returns an error at argument i.
+func tilaArgValue(args []any, i int, typ reflect.Type) (reflect.Value, error) {
+	v, ok := tilaConvert(args[i], typ)
+	if !ok {
+		return v, &TilaArgError{Command: args[0], Index: i,
+			Msg: fmt.Sprintf("expected %s, got %s", tilaTypeName(typ), tilaDescribe(args[i]))}
+	}
+	return v, nil
+}
+
+// TilaArgAt returns args[i] as a T.
+func TilaArgAt[T any](args []any, i int) (T, error) {
+	var zero T
+	if len(args) <= i {
+		return zero, tilaCount(args, i, true)
+	}
+	v, err := tilaArgValue(args, i, reflect.TypeFor[T]())
+	if err != nil {
+		return zero, err
+	}
+	return v.Interface().(T), nil
+}
+
+// TilaArg returns the first argument as a T.
+func TilaArg[T any](args []any) (T, error) {
+	return TilaArgAt[T](args, 1)
+}
+
+// TilaArg2 returns the first two arguments as a T and a U.
+func TilaArg2[T, U any](args []any) (T, U, error) {
+	var zero1 T
+	var zero2 U
+	if len(args) < 3 {
+		return zero1, zero2, tilaCount(args, 2, true)
+	}
+	r1, err := TilaArgAt[T](args, 1)
+	if err != nil {
+		return zero1, zero2, err
+	}
+	r2, err := TilaArgAt[U](args, 2)
+	if err != nil {
+		return zero1, zero2, err
+	}
+	return r1, r2, nil
+}
+
+// TilaCommand makes a command of a Go function, so the signature of the
+// function checks the arguments. The function may take a *Tila first, and
+// be variadic. It may return nothing, a value, an error, or a value and an
+// error. For example:
+//
+//	TilaCommand(func(list []any, items ...any) []any { ... })
+func TilaCommand(fun any) TilaFunc {
+	fv := reflect.ValueOf(fun)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		panic("TilaCommand: not a function")
+	}
+	first := 0
+	if ft.NumIn() > 0 && ft.In(0) == tilaTilaType {
+		first = 1
+	}
+	need := ft.NumIn() - first
+	if ft.IsVariadic() {
+		need--
+	}
+	return func(t *Tila, args ...any) any {
+		if err := tilaCount(args, need, ft.IsVariadic()); err != nil {
+			return err
+		}
+		in := []reflect.Value{}
+		if first > 0 {
+			in = append(in, reflect.ValueOf(t))
+		}
+		for i := 1; i < len(args); i++ {
+			typ := ft.In(min(first+i-1, ft.NumIn()-1))
+			if ft.IsVariadic() && first+i-1 >= ft.NumIn()-1 {
+				typ = typ.Elem()
+			}
+			v, err := tilaArgValue(args, i, typ)
+			if err != nil {
+				return err
+			}
+			in = append(in, v)
+		}
+		return tilaOut(args[0], fv.Call(in))
+	}
+}
+
+// tilaOut converts the results of a function called by TilaCommand to
+// the result of a command.
+func tilaOut(name any, out []reflect.Value) any {
+	var res any
+	for _, v := range out {
+		if v.Type() != tilaErrorType {
+			res = v.Interface()
+			continue
+		}
+		if v.IsNil() {
+			continue
+		}
+		err := v.Interface().(error)
+		var terr *TilaError
+		var aerr *TilaArgError
+		if errors.As(err, &terr) || errors.As(err, &aerr) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return res
+}
@@ -0,0 +1,544 @@
+package masite
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// tilaBreak is the signal of break and continue, which loops catch.
+type tilaBreak struct {
+	TilaAt
+	Continue bool
+}
+
+func (b *tilaBreak) Error() string {
+	if b.Continue {
+		return "continue outside of loop"
+	}
+	return "break outside of loop"
+}
+
+// tilaReturn is the signal of return, which procs catch.
+type tilaReturn struct {
+	Value any
+}
+
+func (r *tilaReturn) Error() string {
+	return "return outside of proc"
+}
+
+// tilaErrorAt returns err as a TilaError at the node, unless it already is
+// one, so errors are reported where they happen. A TilaArgError is
+// reported at the argument when the node is a call.
+func tilaErrorAt(node TilaNode, err error) error {
+	var terr *TilaError
+	if err == nil || errors.As(err, &terr) {
+		return err
+	}
+	var brk *tilaBreak
+	if errors.As(err, &brk) {
+		// Not wrapped, so loops around the call do not catch it.
+		return &TilaError{At: brk.Pos(), Msg: brk.Error()}
+	}
+	at := node.Pos()
+	var aerr *TilaArgError
+	if call, ok := node.(*TilaCall); ok && errors.As(err, &aerr) {
+		if aerr.Index > 0 && aerr.Index <= len(call.Args) {
+			at = call.Args[aerr.Index-1].Pos()
+		}
+	}
+	return &TilaError{At: at, Msg: err.Error(), Err: err}
+}
+
+// Truth returns whether a value counts as true in a condition.
+// nil, false, zero, the empty string and the empty list are false.
+func Truth(val any) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case Ident:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+func (n *TilaLiteral) Eval(t *Tila) (any, error) {
+	return n.Value, nil
+}
+
+func (n *TilaVar) Eval(t *Tila) (any, error) {
+	if get, ok := t.Operators["$"]; ok {
+		res, err := tilaResult(get(t, Operator("$"), n.Name))
+		return res, tilaErrorAt(n, err)
+	}
+	if val, ok := t.Lookup(n.Name); ok {
+		return val, nil
+	}
+	return nil, tilaErrorAt(n, fmt.Errorf("variable not set: %s", n.Name))
+}
+
+func (n *TilaWord) Eval(t *Tila) (any, error) {
+	return n.Name, nil
+}
+
+func (n *TilaList) Eval(t *Tila) (any, error) {
+	return t.EvalAll(n.Items)
+}
+
+func (n *TilaIndex) Eval(t *Tila) (any, error) {
+	x, err := n.X.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.Index.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := index.(int)
+	if !ok {
+		return nil, tilaErrorAt(n.Index, fmt.Errorf("index is not an int: %s", tilaDescribe(index)))
+	}
+	switch v := x.(type) {
+	case []any:
+		if i < 0 || i >= len(v) {
+			return nil, tilaErrorAt(n.Index, fmt.Errorf("index %d out of range 0-%d", i, len(v)-1))
+		}
+		return v[i], nil
+	case string:
+		if i < 0 || i >= len(v) {
+			return nil, tilaErrorAt(n.Index, fmt.Errorf("index %d out of range 0-%d", i, len(v)-1))
+		}
+		return v[i : i+1], nil
+	default:
+		return nil, tilaErrorAt(n, fmt.Errorf("can not index %s", tilaDescribe(x)))
+	}
+}
+
+func (n *TilaUnary) Eval(t *Tila) (any, error) {
+	x, err := n.X.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.Operate(n.Op, x)
+	return res, tilaErrorAt(n, err)
+}
+
+func (n *TilaBinary) Eval(t *Tila) (any, error) {
+	x, err := n.X.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "&&":
+		if !Truth(x) {
+			return x, nil
+		}
+		return n.Y.Eval(t)
+	case "||":
+		if Truth(x) {
+			return x, nil
+		}
+		return n.Y.Eval(t)
+	}
+	y, err := n.Y.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.Operate(n.Op, x, y)
+	return res, tilaErrorAt(n, err)
+}
+
+// Eval calls the command. A name without arguments that is not a command
+// but a variable is the value of the variable. Calls can be nested up to
+// MaxDepth, so a proc or a sourced file that calls itself stops.
+func (n *TilaCall) Eval(t *Tila) (any, error) {
+	if _, ok := t.Commands[n.Name]; !ok && len(n.Args) == 0 {
+		if val, ok := t.Lookup(n.Name); ok {
+			return val, nil
+		}
+	}
+	args, err := t.EvalAll(n.Args)
+	if err != nil {
+		return nil, err
+	}
+	if t.Depth >= t.MaxDepth {
+		return nil, tilaErrorAt(n, fmt.Errorf("%s: calls nested deeper than %d", n.Name, t.MaxDepth))
+	}
+	t.Depth++
+	defer func() { t.Depth-- }()
+	res, err := tilaResult(t.Exec(append([]any{n.Name}, args...)))
+	return res, tilaErrorAt(n, err)
+}
+
+func (n *TilaAssign) Eval(t *Tila) (any, error) {
+	val, err := n.Value.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	t.Assign(n.Name, val)
+	return val, nil
+}
+
+// Eval evaluates the statements, and returns the value of the last one.
+func (n *TilaBlock) Eval(t *Tila) (any, error) {
+	var res any
+	for _, stmt := range n.Statements {
+		var err error
+		if res, err = stmt.Eval(t); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (n *TilaIf) Eval(t *Tila) (any, error) {
+	for i, cond := range n.Conds {
+		ok, err := cond.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		if Truth(ok) {
+			return n.Blocks[i].Eval(t)
+		}
+	}
+	if n.Else != nil {
+		return n.Else.Eval(t)
+	}
+	return nil, nil
+}
+
+// loop evaluates the body of a loop, and returns whether to stop.
+func loop(t *Tila, body *TilaBlock) (bool, error) {
+	_, err := body.Eval(t)
+	var brk *tilaBreak
+	switch {
+	case err == nil:
+		return false, nil
+	case errors.As(err, &brk):
+		return !brk.Continue, nil
+	default:
+		return true, err
+	}
+}
+
+// Eval loops while the condition is true, at most MaxLoops rounds if it
+// is set.
+func (n *TilaWhile) Eval(t *Tila) (any, error) {
+	for rounds := 0; ; rounds++ {
+		ok, err := n.Cond.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		if !Truth(ok) {
+			return nil, nil
+		}
+		if t.MaxLoops > 0 && rounds >= t.MaxLoops {
+			return nil, tilaErrorAt(n, fmt.Errorf("while: more than %d rounds", t.MaxLoops))
+		}
+		if stop, err := loop(t, n.Body); stop {
+			return nil, err
+		}
+	}
+}
+
+// Eval loops over the items of a list, the characters of a string or the
+// ints from 0 up to an int, at most MaxLoops rounds if it is set.
+func (n *TilaFor) Eval(t *Tila) (any, error) {
+	over, err := n.Over.Eval(t)
+	if err != nil {
+		return nil, err
+	}
+	count, item := 0, func(i int) any { return i }
+	switch v := over.(type) {
+	case []any:
+		count, item = len(v), func(i int) any { return v[i] }
+	case int:
+		count = max(v, 0)
+	case string:
+		runes := []rune(v)
+		count, item = len(runes), func(i int) any { return string(runes[i]) }
+	default:
+		return nil, tilaErrorAt(n.Over, fmt.Errorf("for: can not loop over %s", tilaDescribe(over)))
+	}
+	for i := range count {
+		if t.MaxLoops > 0 && i >= t.MaxLoops {
+			return nil, tilaErrorAt(n, fmt.Errorf("for: more than %d rounds", t.MaxLoops))
+		}
+		t.Assign(n.Name, item(i))
+		if stop, err := loop(t, n.Body); stop {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Eval defines the proc as a command. It is called with a scope of its own,
+// in which the arguments are set to the names of the parameters.
+func (n *TilaProc) Eval(t *Tila) (any, error) {
+	t.Commands[n.Name] = func(t *Tila, args ...any) any {
+		if len(args)-1 != len(n.Params) {
+			return tilaCount(args, len(n.Params), false)
+		}
+		scope := map[Ident]any{}
+		for i, param := range n.Params {
+			scope[param] = args[i+1]
+		}
+		t.Scopes = append(t.Scopes, scope)
+		defer func() { t.Scopes = t.Scopes[:len(t.Scopes)-1] }()
+		res, err := n.Body.Eval(t)
+		var ret *tilaReturn
+		if errors.As(err, &ret) {
+			return ret.Value
+		}
+		if err != nil {
+			return tilaErrorAt(n, err)
+		}
+		return res
+	}
+	return nil, nil
+}
+
+func (n *TilaReturn) Eval(t *Tila) (any, error) {
+	ret := &tilaReturn{}
+	if n.Value != nil {
+		val, err := n.Value.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		ret.Value = val
+	}
+	return nil, ret
+}
+
+func (n *TilaBreak) Eval(t *Tila) (any, error) {
+	return nil, &tilaBreak{TilaAt: n.TilaAt, Continue: n.Continue}
+}
+
+// tilaResult splits the result of a command in a value and an error.
+func tilaResult(res any) (any, error) {
+	if err, ok := res.(error); ok {
+		return nil, err
+	}
+	return res, nil
+}
+
+// EvalAll evaluates the nodes in order.
+func (t *Tila) EvalAll(nodes []TilaNode) ([]any, error) {
+	res := []any{}
+	for _, node := range nodes {
+		val, err := node.Eval(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+// Operate applies the operator to the operands with the function in
+// Operators, so operators can be redefined.
+func (t *Tila) Operate(op Operator, operands ...any) (any, error) {
+	fun, ok := t.Operators[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator: %s", op)
+	}
+	return tilaResult(fun(t, append([]any{op}, operands...)...))
+}
+
+// TilaOperator is the default implementation of the operators.
+// Numbers are ints unless one of the operands is a float, + also joins
+// strings and lists, and the comparisons also compare strings.
+func TilaOperator(t *Tila, args ...any) any {
+	op := args[0].(Operator)
+	if len(args) == 2 {
+		switch x := args[1].(type) {
+		case int:
+			if op == "-" {
+				return -x
+			}
+		case float64:
+			if op == "-" {
+				return -x
+			}
+		}
+		if op == "!" {
+			return !Truth(args[1])
+		}
+		return fmt.Errorf("operator %s: can not apply to %v", op, args[1])
+	}
+	if len(args) != 3 {
+		return fmt.Errorf("operator %s: needs 1 or 2 operands", op)
+	}
+	x, y := args[1], args[2]
+
+	switch op {
+	case "==":
+		return tilaEqual(x, y)
+	case "!=":
+		return !tilaEqual(x, y)
+	}
+
+	xi, xok := x.(int)
+	yi, yok := y.(int)
+	if xok && yok {
+		switch op {
+		case "+":
+			return xi + yi
+		case "-":
+			return xi - yi
+		case "*":
+			return xi * yi
+		case "/", "%":
+			if yi == 0 {
+				return fmt.Errorf("operator %s: division by zero", op)
+			}
+			if op == "/" {
+				return xi / yi
+			}
+			return xi % yi
+		case "<":
+			return xi < yi
+		case "<=":
+			return xi <= yi
+		case ">":
+			return xi > yi
+		case ">=":
+			return xi >= yi
+		}
+	}
+	xf, xok := tilaFloat(x)
+	yf, yok := tilaFloat(y)
+	if xok && yok {
+		switch op {
+		case "+":
+			return xf + yf
+		case "-":
+			return xf - yf
+		case "*":
+			return xf * yf
+		case "/":
+			if yf == 0 {
+				return fmt.Errorf("operator %s: division by zero", op)
+			}
+			return xf / yf
+		case "<":
+			return xf < yf
+		case "<=":
+			return xf <= yf
+		case ">":
+			return xf > yf
+		case ">=":
+			return xf >= yf
+		}
+	}
+	xl, xok := x.([]any)
+	yl, yok := y.([]any)
+	if xok && yok && op == "+" {
+		return append(append([]any{}, xl...), yl...)
+	}
+	xs, xok := tilaString(x)
+	ys, yok := tilaString(y)
+	if xok || yok {
+		switch op {
+		case "+":
+			return fmt.Sprint(x) + fmt.Sprint(y)
+		case "<":
+			return xok && yok && xs < ys
+		case "<=":
+			return xok && yok && xs <= ys
+		case ">":
+			return xok && yok && xs > ys
+		case ">=":
+			return xok && yok && xs >= ys
+		}
+	}
+	return fmt.Errorf("operator %s: can not apply to %v and %v", op, x, y)
+}
+
+func tilaFloat(val any) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func tilaString(val any) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case Ident:
+		return string(v), true
+	default:
+		return "", false
+	}
+}
+
+func tilaEqual(x, y any) bool {
+	if xf, ok := tilaFloat(x); ok {
+		yf, ok := tilaFloat(y)
+		return ok && xf == yf
+	}
+	if xs, ok := tilaString(x); ok {
+		ys, ok := tilaString(y)
+		return ok && xs == ys
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// tilaRange returns the ints from from up to to, not including to.
+// tilaRange returns the ints from from up to to by step, at most
+// TilaMaxList of them.
+func tilaRange(from, to, step int) ([]any, error) {
+	// The distance and the count are unsigned, so they do not overflow.
+	count := uint64(0)
+	if step > 0 && to > from {
+		count = (uint64(to) - uint64(from) + uint64(step) - 1) / uint64(step)
+	} else if step < 0 && to < from {
+		count = (uint64(from) - uint64(to) + uint64(-step) - 1) / uint64(-step)
+	}
+	if count > TilaMaxList {
+		return nil, fmt.Errorf("%d ints, at most %d allowed", count, TilaMaxList)
+	}
+	res := make([]any, 0, count)
+	for i := from; step > 0 && i < to || step < 0 && i > to; i += step {
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+// tilaFormat formats a value for print and the output.
+func tilaFormat(val any) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []any:
+		items := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				items = append(items, fmt.Sprintf("%q", s))
+			} else {
+				items = append(items, tilaFormat(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(val)
+	}
+}
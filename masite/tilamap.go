@@ -0,0 +1,382 @@
+package masite
+
+import (
+	"fmt"
+	"image"
+)
+
+// MapBinding connects the map commands of Tila to a map.
+// Only Map is required.
+type MapBinding struct {
+	Map       func() *Map
+	Load      func(name string) error                  // Loads a map to work on.
+	Save      func(name string) error                  // Saves the map.
+	Change    func(name string, op func() error) error // Changes the map, for undo.
+	Selection *Rectangle                               // Selected tiles.
+}
+
+// NewMapTila returns a Tila with the map commands bound to a map,
+// so maps can be scripted without an editor.
+func NewMapTila(b MapBinding) *Tila {
+	t := NewTila()
+	BindMap(t, b)
+	return t
+}
+
+// tilaCell converts an index or a list of an index and flags to a cell.
+// Indexes of 256 and above are extended tiles.
+func tilaCell(arg any) (Cell, error) {
+	switch v := arg.(type) {
+	case int:
+		if v < 0 || v >= 2*SMS_EXTENDED_MIN {
+			return Cell{}, fmt.Errorf("index out of range 0-%d: %d", 2*SMS_EXTENDED_MIN-1, v)
+		}
+		if v >= SMS_EXTENDED_MIN {
+			return Cell{Index: byte(v - SMS_EXTENDED_MIN), Flag: FlagExtended}, nil
+		}
+		return Cell{Index: byte(v)}, nil
+	case []any:
+		if len(v) != 2 {
+			return Cell{}, fmt.Errorf("cell must be [index, flags]: %v", arg)
+		}
+		cell, err := tilaCell(v[0])
+		if err != nil {
+			return Cell{}, err
+		}
+		flag, err := tilaFlag(v[1])
+		cell.Flag |= flag
+		return cell, err
+	default:
+		return Cell{}, fmt.Errorf("not a cell: %v", arg)
+	}
+}
+
+// tilaFlag converts a number or letters like HS to flags.
+func tilaFlag(arg any) (Flag, error) {
+	var flag Flag
+	switch v := arg.(type) {
+	case int:
+		return Flag(v), nil
+	case string:
+		return flag, flag.UnmarshalText([]byte(v))
+	case Ident:
+		return flag, flag.UnmarshalText([]byte(v))
+	default:
+		return flag, fmt.Errorf("not a flag: %v", arg)
+	}
+}
+
+// tilaCellArgs returns the cell in args[i], with the flags in args[i+1]
+// if given.
+func tilaCellArgs(args []any, i int) (Cell, error) {
+	if len(args) <= i {
+		return Cell{}, &TilaArgError{Command: args[0], Msg: "needs a cell"}
+	}
+	cell, err := tilaCell(args[i])
+	if err != nil {
+		return cell, &TilaArgError{Command: args[0], Index: i, Msg: err.Error()}
+	}
+	if len(args) > i+1 {
+		flag, err := tilaFlag(args[i+1])
+		if err != nil {
+			return cell, &TilaArgError{Command: args[0], Index: i + 1, Msg: err.Error()}
+		}
+		cell.Flag |= flag
+	}
+	return cell, nil
+}
+
+// tilaInts returns n arguments from args[from] on as ints.
+func tilaInts(args []any, from, n int) ([]int, error) {
+	if len(args)-from < n {
+		return nil, tilaCount(args, from+n-1, true)
+	}
+	res := []int{}
+	for i := from; i < from+n; i++ {
+		v, err := TilaArgAt[int](args, i)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// BindMap binds the map commands to t:
+//
+//	get x y                      cell at x y as [index, flags]
+//	put x y cell [flags]         put an index or [index, flags]
+//	fill x y w h cell [flags]    fill a rectangle
+//	replace from to [flags]      replace cells, or only flags of equal flags
+//	wrap dx, roll dy, resize w h
+//	offset [n], prefix [name], layer [name]
+//	load file, save file, export file, validate
+//	presence add x y [kin], presence remove i, presence count
+//	selection, select x y w h
+func BindMap(t *Tila, b MapBinding) {
+	if b.Change == nil {
+		b.Change = func(name string, op func() error) error { return op() }
+	}
+	if b.Save == nil {
+		b.Save = func(name string) error { return b.Map().Save(name) }
+	}
+	withMap := func(cmd func(m *Map, args ...any) any) TilaFunc {
+		return func(t *Tila, args ...any) any {
+			m := b.Map()
+			if m == nil {
+				return fmt.Errorf("%s: no map", args[0])
+			}
+			return cmd(m, args...)
+		}
+	}
+	// change runs a command that changes the map as one step,
+	// which is not recorded if the command fails.
+	change := func(cmd func(m *Map, args ...any) any) TilaFunc {
+		return withMap(func(m *Map, args ...any) any {
+			var res any
+			b.Change(fmt.Sprint(args[0]), func() error {
+				res = cmd(m, args...)
+				err, _ := res.(error)
+				return err
+			})
+			return res
+		})
+	}
+
+	getVar := t.Commands["get"]
+	getCell := withMap(func(m *Map, args ...any) any {
+		at, err := tilaInts(args, 1, 2)
+		if err != nil {
+			return err
+		}
+		if !m.Inside(image.Pt(at[0], at[1])) {
+			return fmt.Errorf("get: %d %d outside of map", at[0], at[1])
+		}
+		cell := m.Get(image.Pt(at[0], at[1]))
+		return []any{int(cell.Index), cell.Flag.String()}
+	})
+	t.Commands["get"] = func(t *Tila, args ...any) any {
+		if len(args) == 3 {
+			return getCell(t, args...)
+		}
+		return getVar(t, args...)
+	}
+	t.Commands["put"] = change(func(m *Map, args ...any) any {
+		at, err := tilaInts(args, 1, 2)
+		if err != nil {
+			return err
+		}
+		cell, err := tilaCellArgs(args, 3)
+		if err != nil {
+			return err
+		}
+		if !m.Editable(image.Pt(at[0], at[1])) {
+			return fmt.Errorf("put: %d %d outside of map or layer locked", at[0], at[1])
+		}
+		m.Put(image.Pt(at[0], at[1]), cell)
+		return nil
+	})
+	t.Commands["fill"] = change(func(m *Map, args ...any) any {
+		r, err := tilaInts(args, 1, 4)
+		if err != nil {
+			return err
+		}
+		cell, err := tilaCellArgs(args, 5)
+		if err != nil {
+			return err
+		}
+		bounds := m.Clip(Bounds(r[0], r[1], r[2], r[3]))
+		if bounds.Empty() {
+			return 0
+		}
+		m.PutPoints(RectPoints(bounds.Min, bounds.Max.Sub(image.Pt(1, 1)), true), cell, false)
+		return bounds.Dx() * bounds.Dy()
+	})
+	t.Commands["replace"] = change(func(m *Map, args ...any) any {
+		if len(args) < 3 || len(args) > 4 {
+			return fmt.Errorf("replace: needs a cell to replace and a cell to replace it by")
+		}
+		from, err := tilaCell(args[1])
+		if err != nil {
+			return &TilaArgError{Command: args[0], Index: 1, Msg: err.Error()}
+		}
+		to, err := tilaCell(args[2])
+		if err != nil {
+			return &TilaArgError{Command: args[0], Index: 2, Msg: err.Error()}
+		}
+		flagsOnly := len(args) == 4
+		if flagsOnly && args[3] != Ident("flags") {
+			return &TilaArgError{Command: args[0], Index: 3, Msg: fmt.Sprintf("expected flags, got %v", args[3])}
+		}
+		m.Replace(from, to, flagsOnly)
+		return nil
+	})
+	t.Commands["wrap"] = change(func(m *Map, args ...any) any {
+		dx, err := TilaArg[int](args)
+		if err != nil {
+			return err
+		}
+		m.Wrap(dx)
+		return dx
+	})
+	t.Commands["roll"] = change(func(m *Map, args ...any) any {
+		dy, err := TilaArg[int](args)
+		if err != nil {
+			return err
+		}
+		m.Roll(dy)
+		return dy
+	})
+	t.Commands["resize"] = change(func(m *Map, args ...any) any {
+		w, h, err := TilaArg2[int, int](args)
+		if err != nil {
+			return err
+		}
+		if err := m.Resize(w, h); err != nil {
+			return err
+		}
+		return fmt.Sprintf("%d %d", w, h)
+	})
+	setOffset := change(func(m *Map, args ...any) any {
+		offset, err := TilaArg[int](args)
+		if err != nil {
+			return err
+		}
+		if offset < 0 || offset > SMS_PATTERN_MAX {
+			return fmt.Errorf("offset: out of range 0-%d: %d", SMS_PATTERN_MAX, offset)
+		}
+		m.Offset = offset
+		return offset
+	})
+	t.Commands["offset"] = withMap(func(m *Map, args ...any) any {
+		if len(args) == 1 {
+			return m.Offset
+		}
+		return setOffset(t, args...)
+	})
+	setPrefix := change(func(m *Map, args ...any) any {
+		prefix := fmt.Sprint(args[1])
+		if prefix == "" {
+			return fmt.Errorf("prefix: may not be empty")
+		}
+		m.Prefix = prefix
+		return prefix
+	})
+	t.Commands["prefix"] = withMap(func(m *Map, args ...any) any {
+		if len(args) == 1 {
+			return m.Prefix
+		}
+		return setPrefix(t, args...)
+	})
+	t.Commands["layer"] = withMap(func(m *Map, args ...any) any {
+		if len(args) > 1 {
+			i := m.FindLayer(fmt.Sprint(args[1]))
+			if i < 0 {
+				return fmt.Errorf("layer: no layer %v", args[1])
+			}
+			m.SetActive(i)
+		}
+		return m.LayerName(m.Active)
+	})
+	t.Commands["load"] = func(t *Tila, args ...any) any {
+		name, err := TilaArg[string](args)
+		if err != nil {
+			return err
+		}
+		if b.Load == nil {
+			return fmt.Errorf("load: not possible here")
+		}
+		if err := b.Load(name); err != nil {
+			return err
+		}
+		return name
+	}
+	t.Commands["save"] = withMap(func(m *Map, args ...any) any {
+		name, err := TilaArg[string](args)
+		if err != nil {
+			return err
+		}
+		if err := b.Save(name); err != nil {
+			return err
+		}
+		return name
+	})
+	t.Commands["export"] = withMap(func(m *Map, args ...any) any {
+		name, err := TilaArg[string](args)
+		if err != nil {
+			return err
+		}
+		if err := m.Export(name, BasicFormat); err != nil {
+			return err
+		}
+		return name
+	})
+	t.Commands["validate"] = withMap(func(m *Map, args ...any) any {
+		errs := m.Validate(DefaultVRAM())
+		if len(errs) > 0 {
+			return fmt.Errorf("validate: %w", errs[0])
+		}
+		return "ok"
+	})
+	changePresence := change(func(m *Map, args ...any) any {
+		switch args[1] {
+		case Ident("add"):
+			at, err := tilaInts(args, 2, 2)
+			if err != nil {
+				return err
+			}
+			presence := Presence{}
+			if len(args) > 4 {
+				if err := presence.Kin.UnmarshalText([]byte(fmt.Sprint(args[4]))); err != nil {
+					return &TilaArgError{Command: args[0], Index: 4, Msg: err.Error()}
+				}
+			}
+			if err := m.PutPresence(image.Pt(at[0], at[1]), presence); err != nil {
+				return err
+			}
+			return len(m.Presences) - 1
+		case Ident("remove"):
+			i, err := TilaArgAt[int](args, 2)
+			if err != nil {
+				return err
+			}
+			if i < 0 || i >= len(m.Presences) {
+				return fmt.Errorf("presence: no presence %d", i)
+			}
+			m.RemovePresence(i)
+			return i
+		default:
+			return &TilaArgError{Command: args[0], Index: 1, Msg: fmt.Sprintf("expected add, remove or count, got %v", args[1])}
+		}
+	})
+	t.Commands["presence"] = withMap(func(m *Map, args ...any) any {
+		if len(args) < 2 {
+			return fmt.Errorf("presence: needs add, remove or count")
+		}
+		if args[1] == Ident("count") {
+			return len(m.Presences)
+		}
+		return changePresence(t, args...)
+	})
+	t.Commands["selection"] = func(t *Tila, args ...any) any {
+		if b.Selection == nil {
+			return fmt.Errorf("selection: no selection here")
+		}
+		r := *b.Selection
+		if r.Empty() {
+			return []any{}
+		}
+		return []any{r.Min.X, r.Min.Y, r.Dx(), r.Dy()}
+	}
+	t.Commands["select"] = withMap(func(m *Map, args ...any) any {
+		if b.Selection == nil {
+			return fmt.Errorf("select: no selection here")
+		}
+		r, err := tilaInts(args, 1, 4)
+		if err != nil {
+			return err
+		}
+		*b.Selection = m.Clip(Bounds(r[0], r[1], r[2], r[3]))
+		return t.Commands["selection"](t, Ident("selection"))
+	})
+}
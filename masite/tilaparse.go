@@ -0,0 +1,675 @@
+package masite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/scanner"
+)
+
+// TilaNode is a node of a parsed Tila script.
+type TilaNode interface {
+	Pos() scanner.Position
+	Eval(t *Tila) (any, error)
+}
+
+// TilaAt is the position of a node in the script.
+type TilaAt struct {
+	At scanner.Position
+}
+
+func (a TilaAt) Pos() scanner.Position {
+	return a.At
+}
+
+// TilaLiteral is a number or a string.
+type TilaLiteral struct {
+	TilaAt
+	Value any
+}
+
+// TilaVar is a variable, written $name, or just name in an expression.
+type TilaVar struct {
+	TilaAt
+	Name Ident
+}
+
+// TilaWord is a bare word in the arguments of a command,
+// which is passed to the command as an Ident.
+type TilaWord struct {
+	TilaAt
+	Name Ident
+}
+
+// TilaList is a list, written [a, b, c].
+type TilaList struct {
+	TilaAt
+	Items []TilaNode
+}
+
+// TilaIndex is an element of a list or a string, written list[index].
+type TilaIndex struct {
+	TilaAt
+	X     TilaNode
+	Index TilaNode
+}
+
+// TilaUnary is an operator with one operand, like -x or !x.
+type TilaUnary struct {
+	TilaAt
+	Op Operator
+	X  TilaNode
+}
+
+// TilaBinary is an operator with two operands, like x + y.
+type TilaBinary struct {
+	TilaAt
+	Op   Operator
+	X, Y TilaNode
+}
+
+// TilaCall is a call of a command, either as a statement, name arg arg,
+// or in an expression, name(arg, arg).
+type TilaCall struct {
+	TilaAt
+	Name Ident
+	Args []TilaNode
+}
+
+// TilaAssign is an assignment, name = expression.
+type TilaAssign struct {
+	TilaAt
+	Name  Ident
+	Value TilaNode
+}
+
+// TilaBlock is a list of statements, in braces or a whole script.
+type TilaBlock struct {
+	TilaAt
+	Statements []TilaNode
+}
+
+// TilaIf is if cond { } elif cond { } else { }.
+type TilaIf struct {
+	TilaAt
+	Conds  []TilaNode
+	Blocks []*TilaBlock
+	Else   *TilaBlock
+}
+
+// TilaWhile is while cond { }.
+type TilaWhile struct {
+	TilaAt
+	Cond TilaNode
+	Body *TilaBlock
+}
+
+// TilaFor is for name in list { }.
+type TilaFor struct {
+	TilaAt
+	Name Ident
+	Over TilaNode
+	Body *TilaBlock
+}
+
+// TilaProc defines a command, proc name param param { }.
+type TilaProc struct {
+	TilaAt
+	Name   Ident
+	Params []Ident
+	Body   *TilaBlock
+}
+
+// TilaReturn is return with an optional value.
+type TilaReturn struct {
+	TilaAt
+	Value TilaNode
+}
+
+// TilaBreak is break or continue.
+type TilaBreak struct {
+	TilaAt
+	Continue bool
+}
+
+// tilaOp is the kind of tokens of operators of two characters.
+const tilaOp = -100
+
+type tilaToken struct {
+	Kind rune
+	Text string
+	At   scanner.Position
+}
+
+// tilaPairs are the operators of two characters.
+var tilaPairs = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+// Lex splits the script in tokens. Newlines are tokens, since they end
+// statements.
+func (t *Tila) Lex(script string) ([]tilaToken, error) {
+	var err error
+	t.Scanner.Init(strings.NewReader(script))
+	t.Scanner.Whitespace = 1<<'\t' | 1<<' ' | 1<<'\r'
+	t.Scanner.Error = func(s *scanner.Scanner, msg string) {
+		if err == nil {
+			err = &TilaError{At: s.Pos(), Msg: msg, Incomplete: s.Peek() == scanner.EOF}
+		}
+	}
+	tokens := []tilaToken{}
+	for kind := t.Scanner.Scan(); kind != scanner.EOF; kind = t.Scanner.Scan() {
+		tok := tilaToken{Kind: kind, Text: t.Scanner.TokenText(), At: t.Scanner.Position}
+		for _, pair := range tilaPairs {
+			if tok.Text == pair[:1] && t.Scanner.Peek() == rune(pair[1]) {
+				t.Scanner.Next()
+				tok.Kind = tilaOp
+				tok.Text = pair
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(tokens, tilaToken{Kind: scanner.EOF, At: t.Scanner.Pos()}), nil
+}
+
+// Parse parses a script into a block.
+func (t *Tila) Parse(script string) (*TilaBlock, error) {
+	tokens, err := t.Lex(script)
+	if err != nil {
+		return nil, err
+	}
+	p := &tilaParser{tokens: tokens}
+	return p.parseBlockBody(scanner.EOF)
+}
+
+type tilaParser struct {
+	tokens []tilaToken
+	index  int
+}
+
+func (p *tilaParser) peek() tilaToken {
+	return p.tokens[p.index]
+}
+
+func (p *tilaParser) next() tilaToken {
+	tok := p.tokens[p.index]
+	if tok.Kind != scanner.EOF {
+		p.index++
+	}
+	return tok
+}
+
+// TilaError is an error in a script, at the line and column where it
+// happened.
+type TilaError struct {
+	At         scanner.Position
+	Msg        string
+	Incomplete bool  // The script ended early, so more lines may complete it.
+	Err        error // The error of the command or operator, if any.
+}
+
+func (e *TilaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.At, e.Msg)
+}
+
+func (e *TilaError) Unwrap() error {
+	return e.Err
+}
+
+// IsIncomplete returns whether err is a TilaError for a script that ended
+// early, as when a block is not closed yet.
+func IsIncomplete(err error) bool {
+	var terr *TilaError
+	return errors.As(err, &terr) && terr.Incomplete
+}
+
+func (p *tilaParser) errorf(tok tilaToken, format string, args ...any) error {
+	return &TilaError{At: tok.At, Msg: fmt.Sprintf(format, args...), Incomplete: tok.Kind == scanner.EOF}
+}
+
+func (tok tilaToken) String() string {
+	switch tok.Kind {
+	case scanner.EOF:
+		return "end of script"
+	case '\n':
+		return "end of line"
+	default:
+		return tok.Text
+	}
+}
+
+// isPunct returns whether the token is the operator or punctuation text.
+func (tok tilaToken) isPunct(text string) bool {
+	switch tok.Kind {
+	case scanner.Ident, scanner.Int, scanner.Float, scanner.String,
+		scanner.RawString, scanner.Char, scanner.EOF:
+		return false
+	}
+	return tok.Text == text
+}
+
+// isKeyword returns whether the token is the keyword.
+func (tok tilaToken) isKeyword(word string) bool {
+	return tok.Kind == scanner.Ident && tok.Text == word
+}
+
+// isEnd returns whether the token ends a statement.
+func (tok tilaToken) isEnd() bool {
+	return tok.Kind == scanner.EOF || tok.Kind == '\n' || tok.isPunct(";") || tok.isPunct("}")
+}
+
+// adjacent returns whether the next token follows the previous one
+// without space, as for list[index].
+func (p *tilaParser) adjacent() bool {
+	if p.index < 1 {
+		return false
+	}
+	prev := p.tokens[p.index-1]
+	return p.peek().At.Offset == prev.At.Offset+len(prev.Text)
+}
+
+func (p *tilaParser) expect(text string) (tilaToken, error) {
+	tok := p.next()
+	if !tok.isPunct(text) {
+		return tok, p.errorf(tok, "expected %s, got %s", text, tok)
+	}
+	return tok, nil
+}
+
+func (p *tilaParser) expectIdent() (tilaToken, error) {
+	tok := p.next()
+	if tok.Kind != scanner.Ident || tilaKeywords[tok.Text] {
+		return tok, p.errorf(tok, "expected a name, got %s", tok)
+	}
+	return tok, nil
+}
+
+func (p *tilaParser) skipLines() {
+	for p.peek().Kind == '\n' {
+		p.next()
+	}
+}
+
+// tilaKeywords can not be used as names.
+var tilaKeywords = map[string]bool{
+	"if": true, "elif": true, "else": true, "while": true, "for": true, "in": true,
+	"proc": true, "return": true, "break": true, "continue": true,
+	"true": true, "false": true, "nil": true,
+}
+
+// parseBlockBody parses statements up to the end token, which is not consumed.
+func (p *tilaParser) parseBlockBody(end rune) (*TilaBlock, error) {
+	block := &TilaBlock{TilaAt: TilaAt{p.peek().At}}
+	for {
+		for tok := p.peek(); tok.Kind == '\n' || tok.isPunct(";"); tok = p.peek() {
+			p.next()
+		}
+		tok := p.peek()
+		if tok.Kind == end {
+			return block, nil
+		}
+		if tok.Kind == scanner.EOF {
+			return nil, p.errorf(tok, "missing }")
+		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		block.Statements = append(block.Statements, stmt)
+		if tok := p.peek(); !tok.isEnd() {
+			return nil, p.errorf(tok, "unexpected %s", tok)
+		}
+		if tok := p.peek(); tok.isPunct("}") && end != '}' {
+			return nil, p.errorf(tok, "unexpected }")
+		}
+	}
+}
+
+func (p *tilaParser) parseBlock() (*TilaBlock, error) {
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	block, err := p.parseBlockBody('}')
+	if err != nil {
+		return nil, err
+	}
+	p.next()
+	return block, nil
+}
+
+func (p *tilaParser) parseStatement() (TilaNode, error) {
+	tok := p.peek()
+	if tok.Kind != scanner.Ident {
+		return p.parseExpr()
+	}
+	at := TilaAt{tok.At}
+	switch tok.Text {
+	case "if":
+		return p.parseIf()
+	case "while":
+		p.next()
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		return &TilaWhile{TilaAt: at, Cond: cond, Body: body}, nil
+	case "for":
+		p.next()
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if in := p.next(); !in.isKeyword("in") {
+			return nil, p.errorf(in, "expected in, got %s", in)
+		}
+		over, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		return &TilaFor{TilaAt: at, Name: Ident(name.Text), Over: over, Body: body}, nil
+	case "proc":
+		p.next()
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		proc := &TilaProc{TilaAt: at, Name: Ident(name.Text)}
+		for p.peek().Kind == scanner.Ident {
+			param, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			proc.Params = append(proc.Params, Ident(param.Text))
+		}
+		if proc.Body, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+		return proc, nil
+	case "return":
+		p.next()
+		ret := &TilaReturn{TilaAt: at}
+		if !p.peek().isEnd() {
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			ret.Value = value
+		}
+		return ret, nil
+	case "break", "continue":
+		p.next()
+		return &TilaBreak{TilaAt: at, Continue: tok.Text == "continue"}, nil
+	}
+	if tilaKeywords[tok.Text] {
+		return p.parseExpr()
+	}
+	p.next()
+	if p.peek().isPunct("=") {
+		p.next()
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &TilaAssign{TilaAt: at, Name: Ident(tok.Text), Value: value}, nil
+	}
+	if p.isOperatorNext() {
+		p.index--
+		return p.parseExpr()
+	}
+	call := &TilaCall{TilaAt: at, Name: Ident(tok.Text)}
+	for !p.peek().isEnd() {
+		if op := p.peek(); p.isBinaryNext() {
+			return nil, p.errorf(op, "operator %s in the arguments of a command needs parentheses, as in (a %s b)", op, op)
+		}
+		arg, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+	return call, nil
+}
+
+// isOperatorNext returns whether a name at the start of a statement is
+// followed by a binary operator or an index, so the statement is an
+// expression rather than a command.
+func (p *tilaParser) isOperatorNext() bool {
+	if p.peek().isPunct("[") {
+		return p.adjacent()
+	}
+	return p.isBinaryNext()
+}
+
+// isBinaryNext returns whether the next token is a binary operator.
+// A - after a space and followed by an operand without space is a sign
+// instead, as in wrap -2 or wrap -$x.
+func (p *tilaParser) isBinaryNext() bool {
+	tok := p.peek()
+	for _, level := range tilaLevels {
+		for _, op := range level {
+			if !tok.isPunct(op) {
+				continue
+			}
+			if op != "-" || p.adjacent() {
+				return true
+			}
+			next := p.tokens[p.index+1]
+			return next.At.Offset != tok.At.Offset+len(tok.Text)
+		}
+	}
+	return false
+}
+
+func (p *tilaParser) parseIf() (TilaNode, error) {
+	res := &TilaIf{TilaAt: TilaAt{p.next().At}}
+	for {
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		block, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		res.Conds = append(res.Conds, cond)
+		res.Blocks = append(res.Blocks, block)
+
+		// elif and else may be on the next line.
+		index := p.index
+		p.skipLines()
+		switch tok := p.peek(); {
+		case tok.isKeyword("elif"):
+			p.next()
+			continue
+		case tok.isKeyword("else"):
+			p.next()
+			if res.Else, err = p.parseBlock(); err != nil {
+				return nil, err
+			}
+			return res, nil
+		default:
+			p.index = index
+			return res, nil
+		}
+	}
+}
+
+// parseArg parses an argument of a command statement. A bare word is
+// passed as an Ident, anything else is an operand of an expression.
+func (p *tilaParser) parseArg() (TilaNode, error) {
+	tok := p.peek()
+	if tok.Kind == scanner.Ident && !tilaKeywords[tok.Text] {
+		p.next()
+		return &TilaWord{TilaAt: TilaAt{tok.At}, Name: Ident(tok.Text)}, nil
+	}
+	return p.parseUnary()
+}
+
+// tilaLevels are the binary operators by increasing precedence.
+var tilaLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *tilaParser) parseExpr() (TilaNode, error) {
+	return p.parseLevel(0)
+}
+
+func (p *tilaParser) parseLevel(level int) (TilaNode, error) {
+	if level >= len(tilaLevels) {
+		return p.parseUnary()
+	}
+	x, err := p.parseLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		found := false
+		for _, op := range tilaLevels[level] {
+			found = found || tok.isPunct(op)
+		}
+		if !found {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parseLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &TilaBinary{TilaAt: TilaAt{tok.At}, Op: Operator(tok.Text), X: x, Y: y}
+	}
+}
+
+func (p *tilaParser) parseUnary() (TilaNode, error) {
+	tok := p.peek()
+	if !tok.isPunct("-") && !tok.isPunct("!") {
+		return p.parsePostfix()
+	}
+	p.next()
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if lit, ok := x.(*TilaLiteral); ok && tok.Text == "-" {
+		switch v := lit.Value.(type) {
+		case int:
+			return &TilaLiteral{TilaAt: TilaAt{tok.At}, Value: -v}, nil
+		case float64:
+			return &TilaLiteral{TilaAt: TilaAt{tok.At}, Value: -v}, nil
+		}
+	}
+	return &TilaUnary{TilaAt: TilaAt{tok.At}, Op: Operator(tok.Text), X: x}, nil
+}
+
+func (p *tilaParser) parsePostfix() (TilaNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isPunct("[") && p.adjacent() {
+		tok := p.next()
+		index, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		x = &TilaIndex{TilaAt: TilaAt{tok.At}, X: x, Index: index}
+	}
+	return x, nil
+}
+
+func (p *tilaParser) parsePrimary() (TilaNode, error) {
+	tok := p.next()
+	at := TilaAt{tok.At}
+	switch tok.Kind {
+	case scanner.Int, scanner.Float, scanner.String, scanner.RawString, scanner.Char:
+		value := Value(tok.Kind, tok.Text)
+		if err, ok := value.(error); ok {
+			return nil, p.errorf(tok, "%s", err)
+		}
+		return &TilaLiteral{TilaAt: at, Value: value}, nil
+	case scanner.Ident:
+		switch tok.Text {
+		case "true":
+			return &TilaLiteral{TilaAt: at, Value: true}, nil
+		case "false":
+			return &TilaLiteral{TilaAt: at, Value: false}, nil
+		case "nil":
+			return &TilaLiteral{TilaAt: at, Value: nil}, nil
+		}
+		if tilaKeywords[tok.Text] {
+			return nil, p.errorf(tok, "unexpected %s", tok)
+		}
+		if !p.peek().isPunct("(") {
+			return &TilaVar{TilaAt: at, Name: Ident(tok.Text)}, nil
+		}
+		p.next()
+		call := &TilaCall{TilaAt: at, Name: Ident(tok.Text)}
+		items, err := p.parseItems(")")
+		call.Args = items
+		return call, err
+	}
+	switch {
+	case tok.isPunct("$"):
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &TilaVar{TilaAt: at, Name: Ident(name.Text)}, nil
+	case tok.isPunct("("):
+		p.skipLines()
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipLines()
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tok.isPunct("["):
+		items, err := p.parseItems("]")
+		return &TilaList{TilaAt: at, Items: items}, err
+	}
+	return nil, p.errorf(tok, "unexpected %s", tok)
+}
+
+// parseItems parses expressions separated by commas up to the end,
+// which may be on other lines.
+func (p *tilaParser) parseItems(end string) ([]TilaNode, error) {
+	items := []TilaNode{}
+	for {
+		p.skipLines()
+		if p.peek().isPunct(end) {
+			p.next()
+			return items, nil
+		}
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skipLines()
+		if tok := p.peek(); !tok.isPunct(",") && !tok.isPunct(end) {
+			return nil, p.errorf(tok, "expected , or %s, got %s", end, tok)
+		}
+		if p.peek().isPunct(",") {
+			p.next()
+		}
+	}
+}
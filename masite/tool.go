@@ -0,0 +1,66 @@
+//go:build !headless
+
+package masite
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// Tool is the tool the mouse uses in the editor.
+type Tool int
+
+const (
+	PaintTool    Tool = iota // Paint cells, flags or presences.
+	SelectTool               // Select a rectangle of cells.
+	LineTool                 // Draw a straight line.
+	RectTool                 // Draw a hollow rectangle.
+	FillRectTool             // Draw a filled rectangle.
+	ReplaceTool              // Replace all cells like the clicked one.
+	PresenceTool             // Choose and drag presences.
+	LastTool
+)
+
+func (t Tool) String() string {
+	switch t {
+	case PaintTool:
+		return "paint"
+	case SelectTool:
+		return "select"
+	case LineTool:
+		return "line"
+	case RectTool:
+		return "rectangle"
+	case FillRectTool:
+		return "filled rectangle"
+	case ReplaceTool:
+		return "replace"
+	case PresenceTool:
+		return "presence"
+	case LastTool:
+		return "last"
+	default:
+		return "unknown"
+	}
+}
+
+// IsShape returns true if the tool draws a shape by dragging the mouse.
+func (t Tool) IsShape() bool {
+	return t == LineTool || t == RectTool || t == FillRectTool
+}
+
+// ToolKeys are the keys that select the tools, in order.
+var ToolKeys = []Key{
+	ebiten.Key1, ebiten.Key2, ebiten.Key3, ebiten.Key4, ebiten.Key5, ebiten.Key6, ebiten.Key7,
+}
+
+// ShapePoints returns the tiles the shape tool draws from from to to.
+func ShapePoints(tool Tool, from, to Point) []Point {
+	switch tool {
+	case LineTool:
+		return LinePoints(from, to)
+	case RectTool:
+		return RectPoints(from, to, false)
+	case FillRectTool:
+		return RectPoints(from, to, true)
+	default:
+		return nil
+	}
+}
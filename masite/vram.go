@@ -0,0 +1,217 @@
+package masite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The SMS has 16KB of VRAM. In mode 4 the pattern table takes up
+// the first 448 tiles of 32 bytes, since the name table is at $3800,
+// and the sprite attribute table at $3F00.
+const (
+	SMS_TILE_SIZE    = 32
+	SMS_NAME_TABLE   = 0x3800
+	SMS_PATTERN_MAX  = SMS_NAME_TABLE/SMS_TILE_SIZE - 1
+	SMS_EXTENDED_MIN = 256
+)
+
+// Area is an area of tiles reserved in the VRAM pattern table.
+// Min and Max are both inclusive, like the TILE_*_MIN and TILE_*_MAX
+// constants in lox.bas.
+type Area struct {
+	Name string
+	Min  int
+	Max  int
+}
+
+func (a Area) Len() int {
+	return a.Max - a.Min + 1
+}
+
+func (a Area) Contains(tile int) bool {
+	return tile >= a.Min && tile <= a.Max
+}
+
+func (a Area) Overlaps(b Area) bool {
+	return a.Min <= b.Max && b.Min <= a.Max
+}
+
+func (a Area) String() string {
+	return fmt.Sprintf("%s=%d-%d", a.Name, a.Min, a.Max)
+}
+
+// VRAM is the layout of the VRAM pattern table as a list of areas.
+type VRAM struct {
+	Areas []Area
+}
+
+// DefaultVRAM returns the VRAM layout documented in lox.bas.
+func DefaultVRAM() VRAM {
+	return VRAM{Areas: []Area{
+		{Name: "hud", Min: 0, Max: 31},
+		{Name: "font", Min: 32, Max: 127},
+		{Name: "map", Min: 128, Max: 191},
+		{Name: "sprite", Min: 256, Max: 383},
+	}}
+}
+
+// ParseVRAM parses a VRAM layout in the form name=min-max,name=min-max.
+func ParseVRAM(text string) (VRAM, error) {
+	res := VRAM{}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, span, ok := strings.Cut(part, "=")
+		if !ok {
+			return res, fmt.Errorf("vram: area needs name=min-max: %s", part)
+		}
+		smin, smax, ok := strings.Cut(span, "-")
+		if !ok {
+			smax = smin
+		}
+		amin, err := strconv.Atoi(strings.TrimSpace(smin))
+		if err != nil {
+			return res, fmt.Errorf("vram: area %s: %w", name, err)
+		}
+		amax, err := strconv.Atoi(strings.TrimSpace(smax))
+		if err != nil {
+			return res, fmt.Errorf("vram: area %s: %w", name, err)
+		}
+		res.Areas = append(res.Areas, Area{Name: strings.TrimSpace(name), Min: amin, Max: amax})
+	}
+	return res, nil
+}
+
+func (v VRAM) String() string {
+	parts := []string{}
+	for _, area := range v.Areas {
+		parts = append(parts, area.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Find finds the area with the given name.
+func (v VRAM) Find(name string) (Area, bool) {
+	for _, area := range v.Areas {
+		if area.Name == name {
+			return area, true
+		}
+	}
+	return Area{}, false
+}
+
+// AreaFor returns the area reserved for the map. This is the area
+// named after the map prefix, or the area named "map" otherwise.
+func (v VRAM) AreaFor(m *Map) (Area, bool) {
+	if area, ok := v.Find(m.Prefix); ok {
+		return area, true
+	}
+	return v.Find(PRE)
+}
+
+// Check checks that the areas are valid and do not overlap each other.
+func (v VRAM) Check() []error {
+	errs := []error{}
+	for i, area := range v.Areas {
+		if area.Min > area.Max {
+			errs = append(errs, fmt.Errorf("vram: area %s is empty", area))
+		}
+		if area.Min < 0 || area.Max > SMS_PATTERN_MAX {
+			errs = append(errs, fmt.Errorf("vram: area %s outside pattern table 0-%d",
+				area, SMS_PATTERN_MAX))
+		}
+		for _, other := range v.Areas[i+1:] {
+			if area.Overlaps(other) {
+				errs = append(errs, fmt.Errorf("vram: area %s overlaps %s", area, other))
+			}
+		}
+	}
+	return errs
+}
+
+// Tile returns the VRAM tile the cell uses in the map.
+func (m *Map) Tile(cell Cell) int {
+	tile := int(cell.Index) + m.Offset
+	if cell.Flag.Is(FlagExtended) {
+		tile += SMS_EXTENDED_MIN
+	}
+	return tile
+}
+
+// Tiles returns the sorted VRAM tiles used by the map.
+func (m *Map) Tiles() []int {
+	seen := map[int]bool{}
+	for _, row := range m.Merged().Rows {
+		for _, cell := range row.Cells {
+			seen[m.Tile(cell)] = true
+		}
+	}
+	res := []int{}
+	for tile := range seen {
+		res = append(res, tile)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// CheckMap checks that the tiles the map uses are inside of
+// the area that is reserved for it.
+func (v VRAM) CheckMap(m *Map) []error {
+	area, ok := v.AreaFor(m)
+	if !ok {
+		return []error{fmt.Errorf("vram: map %s: no area %s or %s", m.Prefix, m.Prefix, PRE)}
+	}
+	errs := []error{}
+	for _, tile := range m.Tiles() {
+		if area.Contains(tile) {
+			continue
+		}
+		err := fmt.Errorf("vram: map %s: tile %d outside of area %s", m.Prefix, tile, area)
+		for _, other := range v.Areas {
+			if other.Contains(tile) {
+				err = fmt.Errorf("vram: map %s: tile %d in area %s instead of %s",
+					m.Prefix, tile, other, area)
+			}
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Report writes a report of the VRAM layout and the tile usage of the maps
+// to out. It returns the problems found, if any.
+func (v VRAM) Report(out io.Writer, maps ...*Map) []error {
+	errs := v.Check()
+	fmt.Fprintf(out, "VRAM pattern table: 0-%d\n", SMS_PATTERN_MAX)
+	for _, area := range v.Areas {
+		fmt.Fprintf(out, "%-8s %3d-%3d (%d tiles)\n", area.Name, area.Min, area.Max, area.Len())
+	}
+	for _, m := range maps {
+		tiles := m.Tiles()
+		if len(tiles) > 0 {
+			fmt.Fprintf(out, "map %s: offset %d, %d tiles used, %d-%d\n",
+				m.Prefix, m.Offset, len(tiles), tiles[0], tiles[len(tiles)-1])
+		}
+		errs = append(errs, v.CheckMap(m)...)
+	}
+	for _, err := range errs {
+		fmt.Fprintf(out, "%s\n", err)
+	}
+	if len(errs) == 0 {
+		fmt.Fprintf(out, "VRAM OK\n")
+	}
+	return errs
+}
+
+// ReportString returns the report as a string.
+func (v VRAM) ReportString(maps ...*Map) (string, []error) {
+	buf := &bytes.Buffer{}
+	errs := v.Report(buf, maps...)
+	return buf.String(), errs
+}
@@ -0,0 +1,363 @@
+//go:build !headless
+
+package masite
+
+import (
+	"image"
+	"strings"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// IsClicked returns true if the left mouse button was just pressed in r.
+func IsClicked(r Rectangle) bool {
+	return AbsoluteMouse().In(r) && ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft)
+}
+
+// Button calls On when it is clicked, that is when the mouse is pressed
+// and released on it.
+type Button struct {
+	Midget
+	Label   string
+	On      func()
+	Pressed bool
+}
+
+func NewButton(bounds Rectangle, label string, on func()) *Button {
+	b := &Button{Midget: MakeMidget(bounds), Label: label, On: on}
+	b.Lock = true
+	return b
+}
+
+func (b *Button) Update() error {
+	switch {
+	case IsClicked(b.Bounds):
+		b.Pressed = true
+		return MidgetOK
+	case b.Pressed && ActiveInput.IsMouseButtonJustReleased(ebiten.MouseButtonLeft):
+		b.Pressed = false
+		if b.IsMouseIn() && b.On != nil {
+			b.On()
+		}
+		return MidgetOK
+	case b.Pressed:
+		return MidgetOK
+	}
+	return nil
+}
+
+func (b Button) Draw(s *Surface) {
+	b.Midget.Draw(s)
+	if b.Pressed || b.IsMouseIn() {
+		b.Style.DrawCursor(s, b.Bounds.Inset(1))
+	}
+	b.Style.DrawLabel(s, b.Label, b.Bounds, true)
+}
+
+func (m *Midget) Button(x, y, w, h int, label string, on func()) *Button {
+	b := NewButton(Bounds(x, y, w, h), label, on)
+	m.Add(b)
+	return b
+}
+
+// Checkbox toggles a setting when clicked, and calls On if set.
+type Checkbox struct {
+	Midget
+	Label string
+	Value *bool
+	On    func(checked bool)
+}
+
+func NewCheckbox(bounds Rectangle, label string, value *bool) *Checkbox {
+	c := &Checkbox{Midget: MakeMidget(bounds), Label: label, Value: value}
+	c.Lock = true
+	return c
+}
+
+// Box returns the bounds of the box that shows the check.
+func (c *Checkbox) Box() Rectangle {
+	size := min(c.Bounds.Dy()-4, CaptionCloseSize)
+	y := c.Bounds.Min.Y + (c.Bounds.Dy()-size)/2
+	return Bounds(c.Bounds.Min.X+2, y, size, size)
+}
+
+func (c *Checkbox) Update() error {
+	if !IsClicked(c.Bounds) {
+		return nil
+	}
+	*c.Value = !*c.Value
+	if c.On != nil {
+		c.On(*c.Value)
+	}
+	return MidgetOK
+}
+
+func (c Checkbox) Draw(s *Surface) {
+	box := c.Box()
+	c.Style.DrawBox(s, box)
+	if *c.Value {
+		DrawX(s, box.Inset(2), c.Style.Stroke, c.Style.Border)
+	}
+	label := c.Bounds
+	label.Min.X = box.Max.X + 2
+	c.Style.DrawLabel(s, c.Label, label, false)
+}
+
+func (m *Midget) Checkbox(x, y, w, h int, label string, value *bool) *Checkbox {
+	c := NewCheckbox(Bounds(x, y, w, h), label, value)
+	m.Add(c)
+	return c
+}
+
+// List shows items to choose from, with the arrow keys, by clicking or
+// with Enter. It scrolls when the items do not fit, with Page Up,
+// Page Down and the mouse wheel.
+type List struct {
+	Midget
+	Items []string
+	Index int                  // Index of the selected item.
+	Top   int                  // Index of the first item shown.
+	On    func(index int) bool // Returns true to close the list.
+}
+
+func NewList(bounds Rectangle, items []string, on func(index int) bool) *List {
+	return &List{Midget: MakeMidget(bounds), Items: items, On: on}
+}
+
+// Inner returns the bounds of the items.
+func (l *List) Inner() Rectangle {
+	bounds := l.Bounds
+	if l.Caption.Text != "" {
+		bounds.Min.Y = l.Caption.Bounds.Max.Y
+	}
+	return bounds
+}
+
+// Shown returns how many items fit in the list.
+func (l *List) Shown() int {
+	return max(1, l.Inner().Dy()/l.Style.RowHeight())
+}
+
+// Select selects the item at index, and scrolls to show it.
+func (l *List) Select(index int) {
+	l.Index = max(0, min(index, len(l.Items)-1))
+	if l.Index < l.Top {
+		l.Top = l.Index
+	}
+	if l.Index >= l.Top+l.Shown() {
+		l.Top = l.Index - l.Shown() + 1
+	}
+}
+
+// ScrollBy scrolls the list without changing the selection.
+func (l *List) ScrollBy(items int) {
+	l.Top = max(0, min(l.Top+items, len(l.Items)-l.Shown()))
+}
+
+// Choose calls On with the selected item.
+func (l *List) Choose() error {
+	if l.Index < 0 || l.Index >= len(l.Items) {
+		return MidgetOK
+	}
+	if l.On(l.Index) {
+		return Termination
+	}
+	return MidgetOK
+}
+
+// ItemAt returns the index of the item at the point, or -1 if none.
+func (l *List) ItemAt(at Point) int {
+	inner := l.Inner()
+	if !at.In(inner) {
+		return -1
+	}
+	index := l.Top + (at.Y-inner.Min.Y)/l.Style.RowHeight()
+	if index >= len(l.Items) {
+		return -1
+	}
+	return index
+}
+
+func (l *List) Update() error {
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyUp:
+			l.Select(l.Index - 1)
+		case ebiten.KeyDown:
+			l.Select(l.Index + 1)
+		case ebiten.KeyPageUp:
+			l.Select(l.Index - l.Shown())
+		case ebiten.KeyPageDown:
+			l.Select(l.Index + l.Shown())
+		case ebiten.KeyHome:
+			l.Select(0)
+		case ebiten.KeyEnd:
+			l.Select(len(l.Items) - 1)
+		case ebiten.KeyEnter:
+			return l.Choose()
+		case ebiten.KeyEscape:
+			return Termination
+		default:
+		}
+	}
+	if l.IsMouseIn() {
+		if _, dy := ActiveInput.Wheel(); dy != 0 {
+			l.ScrollBy(-int(dy))
+			return MidgetOK
+		}
+		if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			if index := l.ItemAt(AbsoluteMouse()); index >= 0 {
+				l.Select(index)
+				return l.Choose()
+			}
+		}
+	}
+	err := l.Midget.Update()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return MidgetOK
+	}
+	return nil
+}
+
+func (l List) Draw(s *Surface) {
+	l.Midget.Draw(s)
+	inner := l.Inner()
+	hover := l.ItemAt(AbsoluteMouse())
+	height := l.Style.RowHeight()
+	for i := l.Top; i < len(l.Items) && i < l.Top+l.Shown(); i++ {
+		y := inner.Min.Y + (i-l.Top)*height
+		row := image.Rect(inner.Min.X, y, inner.Max.X, y+height)
+		style := l.Style
+		if i == l.Index {
+			style = DrawSelection(s, row)
+		} else if i == hover {
+			l.Style.DrawCursor(s, row)
+		}
+		style.DrawRowText(s, l.Items[i], inner.Min.X, y)
+	}
+	l.Style.DrawScrollBar(s, inner, l.Top, l.Shown(), len(l.Items))
+}
+
+// DrawScrollBar draws a scroll bar at the right of r if not all items fit,
+// as high as the part of the items shown.
+func (s Style) DrawScrollBar(surface *Surface, r Rectangle, top, shown, items int) {
+	if items <= shown {
+		return
+	}
+	h := r.Dy() * shown / items
+	y := r.Min.Y + r.Dy()*top/items
+	FillRect(surface, Bounds(r.Max.X-3, y, 2, max(2, h)), s.Border)
+}
+
+// AskList asks to choose one of the items in a list of the given size.
+func (m *Midget) AskList(x, y, w, h int, prompt string, items []string, on func(index int) bool) *List {
+	l := NewList(Bounds(x, y, w, h), items, on)
+	l.SetCaption(prompt)
+	m.Add(l)
+	return l
+}
+
+// TextArea shows text wrapped to its width, which scrolls with the arrow
+// keys, Page Up, Page Down, Home, End and the mouse wheel.
+// Enter or Escape closes it.
+type TextArea struct {
+	Midget
+	Text  string
+	Lines []string // Text wrapped to the width.
+	Top   int      // Index of the first line shown.
+}
+
+func NewTextArea(bounds Rectangle, title, text string) *TextArea {
+	t := &TextArea{Midget: MakeMidget(bounds)}
+	t.SetCaption(title)
+	t.SetText(text)
+	return t
+}
+
+// Inner returns the bounds of the text.
+func (t *TextArea) Inner() Rectangle {
+	bounds := t.Bounds
+	if t.Caption.Text != "" {
+		bounds.Min.Y = t.Caption.Bounds.Max.Y
+	}
+	bounds.Min.X += t.Style.Padding
+	bounds.Max.X -= t.Style.Padding + 2 // room for the scroll bar.
+	return bounds
+}
+
+// SetText sets the text and wraps it.
+func (t *TextArea) SetText(text string) {
+	t.Text = text
+	t.Lines = t.Style.Font.Wrap(text, t.Inner().Dx())
+	t.ScrollBy(0)
+}
+
+// Shown returns how many lines fit in the text area.
+func (t *TextArea) Shown() int {
+	return max(1, t.Inner().Dy()/t.Style.Font.Height)
+}
+
+func (t *TextArea) ScrollBy(lines int) {
+	t.Top = max(0, min(t.Top+lines, len(t.Lines)-t.Shown()))
+}
+
+func (t *TextArea) Update() error {
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyUp:
+			t.ScrollBy(-1)
+		case ebiten.KeyDown:
+			t.ScrollBy(1)
+		case ebiten.KeyPageUp:
+			t.ScrollBy(1 - t.Shown())
+		case ebiten.KeyPageDown:
+			t.ScrollBy(t.Shown() - 1)
+		case ebiten.KeyHome:
+			t.Top = 0
+		case ebiten.KeyEnd:
+			t.ScrollBy(len(t.Lines))
+		case ebiten.KeyEnter, ebiten.KeyEscape:
+			return Termination
+		default:
+		}
+	}
+	if t.IsMouseIn() {
+		if _, dy := ActiveInput.Wheel(); dy != 0 {
+			t.ScrollBy(-int(dy * 3))
+			return MidgetOK
+		}
+	}
+	err := t.Midget.Update()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return MidgetOK
+	}
+	return nil
+}
+
+func (t TextArea) Draw(s *Surface) {
+	t.Midget.Draw(s)
+	inner := t.Inner()
+	end := min(len(t.Lines), t.Top+t.Shown())
+	t.Style.DrawText(s, strings.Join(t.Lines[t.Top:end], "\n"), inner.Min.X, inner.Min.Y)
+	inner.Max.X += t.Style.Padding + 2
+	t.Style.DrawScrollBar(s, inner, t.Top, t.Shown(), len(t.Lines))
+}
+
+// ShowText shows text in a text area with the given title.
+func (m *Midget) ShowText(x, y, w, h int, title, text string) *TextArea {
+	t := NewTextArea(Bounds(x, y, w, h), title, text)
+	m.Add(t)
+	return t
+}
@@ -0,0 +1,396 @@
+package masite
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+import (
+	"github.com/xmasengine/lox/bank"
+)
+
+// Opposite returns the direction back through an exit in direction d.
+func (d Direction) Opposite() Direction {
+	switch d {
+	case North:
+		return South
+	case East:
+		return West
+	case South:
+		return North
+	case West:
+		return East
+	case In:
+		return Out
+	case Out:
+		return In
+	case Up:
+		return Down
+	case Down:
+		return Up
+	default:
+		return d
+	}
+}
+
+// Step returns where a map linked in direction d is placed in the world
+// layout, relative to the map it is linked from.
+// In, out, up and down are placed diagonally so they do not cover the
+// neighbours on the same level.
+func (d Direction) Step() Point {
+	switch d {
+	case North:
+		return image.Pt(0, -1)
+	case East:
+		return image.Pt(1, 0)
+	case South:
+		return image.Pt(0, 1)
+	case West:
+		return image.Pt(-1, 0)
+	case In, Down:
+		return image.Pt(1, 1)
+	case Out, Up:
+		return image.Pt(-1, -1)
+	default:
+		return image.Pt(0, 0)
+	}
+}
+
+// DirectionNames returns the names of all directions, for choosing one.
+func DirectionNames() []string {
+	res := []string{}
+	for d := North; d < LastDirection; d++ {
+		res = append(res, d.String())
+	}
+	return res
+}
+
+// MapName returns the name of a map file as used in Exit.Name,
+// which is the file name without directory and extension.
+func MapName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// World is all the maps in a directory, linked by their exits.
+type World struct {
+	Dir    string
+	Names  []string          // Sorted names of the maps.
+	Maps   map[string]*Map   // Maps by name.
+	Files  map[string]string // Files of the maps by name.
+	Places map[string]Point  // Places of the maps in the layout.
+}
+
+// LoadWorld reads every map in the directory, in any format LoadMap
+// supports, without loading the images. Stamp libraries are skipped.
+func LoadWorld(dir string) (*World, error) {
+	files := []string{}
+	for _, format := range slices.Concat(XMLFormats, JSONFormats) {
+		found, err := filepath.Glob(filepath.Join(dir, "*"+string(format)))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	w := &World{Dir: dir, Maps: map[string]*Map{}, Files: map[string]string{}}
+	for _, file := range files {
+		name := MapName(file)
+		if strings.HasSuffix(name, StampsSuffix) {
+			continue
+		}
+		if other, ok := w.Files[name]; ok {
+			return nil, fmt.Errorf("world: %s and %s are both map %s", other, file, name)
+		}
+		m, err := ReadMap(file)
+		if err != nil {
+			return nil, fmt.Errorf("world: %s: %w", file, err)
+		}
+		w.Names = append(w.Names, name)
+		w.Maps[name] = m
+		w.Files[name] = file
+	}
+	slices.Sort(w.Names)
+	w.Layout()
+	return w, nil
+}
+
+// Find returns the name of the map an exit name refers to.
+// The name may also have a directory or an extension.
+func (w *World) Find(name string) (string, bool) {
+	name = MapName(name)
+	_, ok := w.Maps[name]
+	return name, ok
+}
+
+// Layout places the maps on a grid following their exits, starting with
+// the first map. Maps that are not linked to placed maps start a new group
+// to the right. If a place is taken the nearest free place is used.
+func (w *World) Layout() {
+	w.Places = map[string]Point{}
+	taken := map[Point]bool{}
+	place := func(name string, at Point) {
+		for r := 0; taken[at]; r++ {
+			at = nearestFree(taken, at, r)
+		}
+		w.Places[name] = at
+		taken[at] = true
+	}
+	right := 0
+	for _, start := range w.Names {
+		if _, ok := w.Places[start]; ok {
+			continue
+		}
+		place(start, image.Pt(right, 0))
+		queue := []string{start}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			for d := North; d < LastDirection; d++ {
+				exit := w.Maps[name].Exits.Exit(d)
+				next, ok := w.Find(exit.Name)
+				if !ok || exit.Name == "" {
+					continue
+				}
+				if _, placed := w.Places[next]; placed {
+					continue
+				}
+				place(next, w.Places[name].Add(d.Step()))
+				queue = append(queue, next)
+			}
+		}
+		for _, at := range w.Places {
+			right = max(right, at.X+2)
+		}
+	}
+}
+
+// nearestFree returns the first free place at most r away from at,
+// row by row from the top left, or at itself if all are taken.
+func nearestFree(taken map[Point]bool, at Point, r int) Point {
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			try := at.Add(image.Pt(dx, dy))
+			if !taken[try] {
+				return try
+			}
+		}
+	}
+	return at
+}
+
+// Link links the map from to the map to through direction d,
+// and to back to from in the opposite direction.
+func (w *World) Link(from string, d Direction, to string) error {
+	fm, ok := w.Maps[from]
+	if !ok {
+		return fmt.Errorf("world: no map %s", from)
+	}
+	tm, ok := w.Maps[to]
+	if !ok {
+		return fmt.Errorf("world: no map %s", to)
+	}
+	exit := fm.Exits.Exit(d)
+	if exit == nil {
+		return fmt.Errorf("world: no direction %s", d)
+	}
+	*exit = Exit{Name: to, Number: tm.Number}
+	*tm.Exits.Exit(d.Opposite()) = Exit{Name: from, Number: fm.Number}
+	return nil
+}
+
+// Unlink removes the exit of from in direction d, and the exit back to it.
+func (w *World) Unlink(from string, d Direction) {
+	fm, ok := w.Maps[from]
+	if !ok || fm.Exits.Exit(d) == nil {
+		return
+	}
+	exit := fm.Exits.Exit(d)
+	if to, ok := w.Find(exit.Name); ok && exit.Name != "" {
+		back := w.Maps[to].Exits.Exit(d.Opposite())
+		if back.Name != "" && MapName(back.Name) == from {
+			*back = Exit{}
+		}
+	}
+	*exit = Exit{}
+}
+
+// Save saves the named maps.
+func (w *World) Save(names ...string) error {
+	for _, name := range names {
+		m, ok := w.Maps[name]
+		if !ok {
+			return fmt.Errorf("world: no map %s", name)
+		}
+		if err := m.Save(w.Files[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that the exits lead to existing maps, that they are
+// reciprocal and that the map numbers and prefixes are unique.
+func (w *World) Validate() []error {
+	errs := []error{}
+	numbers := map[int]string{}
+	prefixes := map[string]string{}
+	for _, name := range w.Names {
+		m := w.Maps[name]
+		if other, ok := prefixes[m.Prefix]; ok {
+			errs = append(errs, fmt.Errorf("world: maps %s and %s have the same prefix %s",
+				other, name, m.Prefix))
+		} else {
+			prefixes[m.Prefix] = name
+		}
+		if other, ok := numbers[m.Number]; ok {
+			errs = append(errs, fmt.Errorf("world: maps %s and %s have the same number %d",
+				other, name, m.Number))
+		} else {
+			numbers[m.Number] = name
+		}
+		for d := North; d < LastDirection; d++ {
+			exit := m.Exits.Exit(d)
+			if exit.Name == "" {
+				continue
+			}
+			to, ok := w.Find(exit.Name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("world: %s %s: no map %s", name, d, exit.Name))
+				continue
+			}
+			if exit.Number != w.Maps[to].Number {
+				errs = append(errs, fmt.Errorf("world: %s %s: number %d, but %s has number %d",
+					name, d, exit.Number, to, w.Maps[to].Number))
+			}
+			back := w.Maps[to].Exits.Exit(d.Opposite())
+			if MapName(back.Name) != name {
+				errs = append(errs, fmt.Errorf("world: %s %s leads to %s, but %s %s does not lead back",
+					name, d, to, to, d.Opposite()))
+			}
+		}
+	}
+	return errs
+}
+
+// Renumber gives every map a unique number, starting from 1, since 0 means
+// no exit. Maps keep their number if it is set and not used by a map that
+// comes earlier, so numbers stay stable when maps are added.
+// Other maps get the lowest free number. It returns the renumbered maps.
+func (w *World) Renumber() []string {
+	used := map[int]bool{}
+	todo := []string{}
+	for _, name := range w.Names {
+		number := w.Maps[name].Number
+		if number < 1 || used[number] {
+			todo = append(todo, name)
+			continue
+		}
+		used[number] = true
+	}
+	next := 1
+	for _, name := range todo {
+		for used[next] {
+			next++
+		}
+		w.Maps[name].Number = next
+		used[next] = true
+	}
+	return todo
+}
+
+// Resolve sets the number of every exit to the number of the map it
+// leads to. It returns the changed maps, and errors for exits that lead
+// to maps that do not exist.
+func (w *World) Resolve() ([]string, []error) {
+	changed := []string{}
+	errs := []error{}
+	for _, name := range w.Names {
+		m := w.Maps[name]
+		change := false
+		for d := North; d < LastDirection; d++ {
+			exit := m.Exits.Exit(d)
+			if exit.Name == "" {
+				continue
+			}
+			to, ok := w.Find(exit.Name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("world: %s %s: no map %s", name, d, exit.Name))
+				continue
+			}
+			if exit.Number != w.Maps[to].Number {
+				exit.Number = w.Maps[to].Number
+				change = true
+			}
+		}
+		if change {
+			changed = append(changed, name)
+		}
+	}
+	return changed, errs
+}
+
+// MapLabel returns the label of the name table of the map in basic.
+func (m *Map) MapLabel() string {
+	sw, sh := m.Screens()
+	switch {
+	case m.Scroll == ScrollColumns:
+		return m.Prefix + "_columns"
+	case m.Scroll == ScrollRows:
+		return m.Prefix + "_rows"
+	case sw == 1 && sh == 1:
+		return m.Prefix + "_map"
+	default:
+		return m.Prefix + "_screens"
+	}
+}
+
+// Basic writes the map table of the world, indexed by map number.
+// For every number there is the bank of the map, and pointers to its
+// header, name table and tile bitmap. Unused numbers are 0.
+// banks has the bank number of every map by name.
+func (w *World) Basic(out io.Writer, banks map[string]int) {
+	byNumber := map[int]string{}
+	last := 0
+	for _, name := range w.Names {
+		number := w.Maps[name].Number
+		byNumber[number] = name
+		last = max(last, number)
+	}
+
+	fmt.Fprintf(out, "' Generated with masite -world\n\n")
+	fmt.Fprintf(out, "CONST WORLD_MAPS = %d\n", last+1)
+	for _, name := range w.Names {
+		fmt.Fprintf(out, "CONST MAP_%s = %d\n", bank.Label(name), w.Maps[name].Number)
+	}
+
+	table := func(label, comment string, item func(name string, m *Map) string) {
+		fmt.Fprintf(out, "\n' %s\n%s: \n", comment, label)
+		for number := 0; number <= last; number++ {
+			name, ok := byNumber[number]
+			if !ok {
+				fmt.Fprintf(out, "' %d unused\nDATA 0\n", number)
+				continue
+			}
+			fmt.Fprintf(out, "' %d %s\nDATA %s\n", number, name, item(name, w.Maps[name]))
+		}
+	}
+	table("world_banks", "Bank of every map", func(name string, m *Map) string {
+		return fmt.Sprintf("%d", banks[name])
+	})
+	table("world_headers", "Header of every map", func(name string, m *Map) string {
+		return "VARPTR " + m.Prefix + "_header"
+	})
+	table("world_names", "Name table of every map", func(name string, m *Map) string {
+		return "VARPTR " + m.MapLabel()
+	})
+	table("world_bitmaps", "Tile bitmap of every map", func(name string, m *Map) string {
+		if m.From == "" {
+			return "0"
+		}
+		return "VARPTR " + m.Prefix + "_bitmap"
+	})
+}
@@ -0,0 +1,34 @@
+package masite
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadWorldFormats(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"a.xml", "b.json", "c.mas", "d.masite"} {
+		if err := newTilaTestMap(4, 4).Save(filepath.Join(dir, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stamps := StampsName(filepath.Join(dir, "a.xml"), "tiles.png")
+	if err := os.WriteFile(stamps, []byte("<stamps></stamps>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := LoadWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(w.Names, want) {
+		t.Errorf("maps %q, want %q", w.Names, want)
+	}
+	if err := newTilaTestMap(4, 4).Save(filepath.Join(dir, "a.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWorld(dir); err == nil {
+		t.Errorf("no error for two files of map a")
+	}
+}
@@ -0,0 +1,238 @@
+//go:build !headless
+
+package masite
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+)
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Size of a map in the world view, and of the room around it.
+const (
+	WorldCellW = 96
+	WorldCellH = 48
+	WorldBoxW  = 80
+	WorldBoxH  = 32
+)
+
+var (
+	worldBoxColor  = RGBA{R: 0x00, G: 0x55, B: 0x00, A: 0xcc}
+	worldLinkColor = RGBA{R: 0xaa, G: 0xaa, B: 0xaa, A: 0xff}
+)
+
+// WorldView shows the maps of the world and their exits.
+// Click on a map to choose it, then on another map to link them.
+// Enter jumps into the chosen map, Delete removes one of its exits.
+type WorldView struct {
+	Midget
+	Editor *Editor
+	World  *World
+	Chosen string
+	Offset Point // Panning of the view.
+	Errors []error
+}
+
+// Box returns the bounds of the map placed at place.
+func (v *WorldView) Box(place Point) Rectangle {
+	bounds := v.Bounds
+	if v.Caption.Text != "" {
+		bounds.Min.Y = v.Caption.Bounds.Max.Y
+	}
+	at := image.Pt(place.X*WorldCellW, place.Y*WorldCellH).Add(bounds.Min).Add(v.Offset)
+	return Bounds(at.X+4, at.Y+4, WorldBoxW, WorldBoxH)
+}
+
+// MapAt returns the name of the map under the screen position at.
+func (v *WorldView) MapAt(at Point) (string, bool) {
+	for name, place := range v.World.Places {
+		if at.In(v.Box(place)) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Link asks in which direction to link the chosen map to the map to,
+// suggesting the direction in which it lies.
+func (v *WorldView) Link(to string) {
+	from := v.Chosen
+	_, fromOK := v.World.Maps[from]
+	if _, toOK := v.World.Maps[to]; !fromOK || !toOK {
+		return
+	}
+	delta := v.World.Places[to].Sub(v.World.Places[from])
+	def := North
+	for d := North; d < LastDirection; d++ {
+		if d.Step() == delta {
+			def = d
+			break
+		}
+	}
+	on := func(res string) bool {
+		var d Direction
+		if err := d.UnmarshalText([]byte(res)); err != nil {
+			return false
+		}
+		err := v.World.Link(from, d, to)
+		if err == nil {
+			err = v.World.Save(from, to)
+		}
+		v.Apply(err, from, to)
+		return true
+	}
+	prompt := fmt.Sprintf("Exit from %s to %s", from, to)
+	v.Editor.Midget.AskChoice(v.Box(v.World.Places[to]).Max.X, v.Box(v.World.Places[to]).Min.Y,
+		120, prompt, DirectionNames(), def.String(), on)
+}
+
+// Unlink asks which exit of the chosen map to remove.
+func (v *WorldView) Unlink() {
+	from := v.Chosen
+	if _, ok := v.World.Maps[from]; !ok {
+		return
+	}
+	on := func(res string) bool {
+		var d Direction
+		if err := d.UnmarshalText([]byte(res)); err != nil {
+			return false
+		}
+		m, ok := v.World.Maps[from]
+		if !ok {
+			return true
+		}
+		to, _ := v.World.Find(m.Exits.Exit(d).Name)
+		v.World.Unlink(from, d)
+		names := []string{from}
+		if _, ok := v.World.Maps[to]; ok {
+			names = append(names, to)
+		}
+		v.Apply(v.World.Save(names...), names...)
+		return true
+	}
+	v.Editor.Midget.AskChoice(v.Box(v.World.Places[from]).Max.X, v.Box(v.World.Places[from]).Min.Y,
+		120, "Remove exit of "+from, DirectionNames(), North.String(), on)
+}
+
+// Apply updates the layout after a change of the exits of the named maps,
+// and copies their exits to the map in the editor if it is one of them.
+func (v *WorldView) Apply(err error, names ...string) {
+	e := v.Editor
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	for _, name := range names {
+		if filepath.Clean(v.World.Files[name]) == filepath.Clean(e.Name) {
+			modified := e.Modified()
+			e.History.Change(e.Map, "exits", func() { e.Map.Exits = v.World.Maps[name].Exits })
+			if !modified { // The exits are saved already.
+				e.Saved = SavedMap(e.Map)
+			}
+		}
+	}
+	v.World.Layout()
+	v.Errors = v.World.Validate()
+}
+
+func (v *WorldView) Update() error {
+	var keys []Key
+	keys = ActiveInput.AppendJustPressedKeys(keys)
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyEscape:
+			return Termination
+		case ebiten.KeyEnter, ebiten.KeyJ:
+			if _, ok := v.World.Maps[v.Chosen]; ok {
+				v.Editor.ConfirmLoadMap(v.World.Files[v.Chosen])
+				return Termination
+			}
+		case ebiten.KeyDelete:
+			if _, ok := v.World.Maps[v.Chosen]; ok {
+				v.Unlink()
+			}
+		default:
+		}
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowLeft) {
+		v.Offset.X += PanSpeed
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowRight) {
+		v.Offset.X -= PanSpeed
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowUp) {
+		v.Offset.Y += PanSpeed
+	}
+	if ActiveInput.IsKeyPressed(ebiten.KeyArrowDown) {
+		v.Offset.Y -= PanSpeed
+	}
+
+	if err := v.Midget.Update(); err != nil {
+		return err
+	}
+	if ActiveInput.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && !v.IsMouseInCaption() {
+		name, ok := v.MapAt(AbsoluteMouse())
+		if ok && v.Chosen != "" && name != v.Chosen {
+			v.Link(name)
+		} else {
+			v.Chosen = name
+		}
+	}
+	return MidgetOK
+}
+
+func (v WorldView) Draw(s *Surface) {
+	v.Midget.Draw(s)
+	center := func(name string) Point {
+		box := v.Box(v.World.Places[name])
+		return box.Min.Add(box.Size().Div(2))
+	}
+	for _, name := range v.World.Names {
+		for d := North; d < LastDirection; d++ {
+			to, ok := v.World.Find(v.World.Maps[name].Exits.Exit(d).Name)
+			if ok && v.World.Maps[name].Exits.Exit(d).Name != "" {
+				DrawLine(s, image.Rectangle{Min: center(name), Max: center(to)}, 1, worldLinkColor)
+			}
+		}
+	}
+	for _, name := range v.World.Names {
+		box := v.Box(v.World.Places[name])
+		FillRect(s, box, worldBoxColor)
+		if name == v.Chosen {
+			v.Style.DrawCursor(s, box.Inset(-2))
+		}
+		v.Style.DrawText(s, fmt.Sprintf("%s\n#%d", name, v.World.Maps[name].Number),
+			box.Min.X+2, box.Min.Y)
+	}
+	lh := v.Style.Font.Height
+	y := v.Bounds.Max.Y - lh*(len(v.Errors)+1)
+	warning := ActiveTheme.For(ClassWarning)
+	for _, err := range v.Errors {
+		warning.DrawText(s, err.Error(), v.Bounds.Min.X+4, y)
+		y += lh
+	}
+	if len(v.Errors) == 0 {
+		v.Style.DrawText(s, "World OK", v.Bounds.Min.X+4, y)
+	}
+}
+
+// ShowWorld shows the world view of the maps in the directory of the map.
+func (e *Editor) ShowWorld() {
+	w, err := LoadWorld(filepath.Dir(e.Name))
+	e.Error = err
+	e.Midget.Error(70, 70, 270, 120, err)
+	if err != nil {
+		return
+	}
+	size := e.Size.Div(max(1, e.Scale))
+	view := &WorldView{Midget: MakeMidget(Bounds(0, 0, size.X, size.Y)), Editor: e, World: w}
+	view.Lock = true
+	if name := MapName(e.Name); w.Maps[name] != nil {
+		view.Chosen = name
+	}
+	view.Errors = w.Validate()
+	view.SetCaption("World " + w.Dir)
+	e.Midget.Add(view)
+}